@@ -10,16 +10,14 @@ import (
 	"os/signal"
 )
 
-func init() {
-	_, _ = fmt.Fprintln(os.Stdout, banner.Banner)
-}
-
 func newRunCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "run",
 		Short: "運行 x-agent 進程",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// 不能放在 init 中：沙箱 init 同样执行本二进制，banner 会混入任务输出
+			_, _ = fmt.Fprint(os.Stdout, banner.Banner)
 			if err := run(cmd); err != nil {
 				cmd.PrintErrf("run failed: %v\n", err)
 				return err
@@ -2,10 +2,14 @@ package main
 
 import (
 	"github.com/xulei1234/x-agent/cmd"
+	"github.com/xulei1234/x-agent/module/sandbox"
 	"os"
 )
 
 func main() {
+	// 沙箱 init 进程：完成隔离设置后 exec 任务命令，不会返回
+	sandbox.Main()
+
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
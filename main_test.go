@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/xulei1234/x-agent/module/sandbox"
+)
+
+func TestMain(m *testing.M) {
+	// 测试二进制链接了全部包，作为沙箱 init 被重新执行时与 x-agent 一致
+	sandbox.Main()
+	os.Exit(m.Run())
+}
+
+func TestSandboxOutputClean(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if err := exec.Command("unshare", "-m", "-p", "-n", "-f", "true").Run(); err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+
+	cmd, err := sandbox.Command(context.Background(), &sandbox.Spec{}, "echo", []string{"hi"}, os.Environ())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hi\n" {
+		t.Fatalf("out=%q", out)
+	}
+}
@@ -0,0 +1,374 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+// 虚拟化类型（PlatformInfo.Virtualization）
+const (
+	VirtBareMetal  = "bare-metal"
+	VirtKVM        = "kvm"
+	VirtVMware     = "vmware"
+	VirtXen        = "xen"
+	VirtHyperV     = "hyperv"
+	VirtVirtualBox = "virtualbox"
+	VirtUnknown    = "vm" // 有 hypervisor 标志但无法识别
+)
+
+// 云厂商（PlatformInfo.Provider），与元数据服务对应
+const (
+	CloudAWS       = "aws"
+	CloudGCP       = "gcp"
+	CloudAzure     = "azure"
+	CloudAliyun    = "aliyun"
+	CloudTencent   = "tencent"
+	CloudOpenStack = "openstack"
+)
+
+// PlatformInfo 运行平台：虚拟化、容器与云主机元数据
+type PlatformInfo struct {
+	Virtualization string `json:"virtualization"`
+	Container      string `json:"container,omitempty"` // docker/podman/lxc/kubernetes/containerd
+	Provider       string `json:"provider,omitempty"`
+	InstanceID     string `json:"instanceId,omitempty"`
+	InstanceType   string `json:"instanceType,omitempty"`
+	Zone           string `json:"zone,omitempty"`
+	Region         string `json:"region,omitempty"`
+}
+
+// readRootFile 读取 root 下的文件（测试时 root 为临时目录）
+func readRootFile(root, path string) string {
+	b, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// DetectVirtualization 按 DMI（sys_vendor/product_name 等无需 root 即可读取）、/sys/hypervisor 与 cpuinfo 判断虚拟化类型，
+// 同时根据 DMI 推断云厂商
+func DetectVirtualization(root string) (virt, provider string) {
+	vendor := readRootFile(root, "sys/class/dmi/id/sys_vendor")
+	product := readRootFile(root, "sys/class/dmi/id/product_name")
+	biosVendor := readRootFile(root, "sys/class/dmi/id/bios_vendor")
+	assetTag := readRootFile(root, "sys/class/dmi/id/chassis_asset_tag")
+	all := strings.ToLower(strings.Join([]string{vendor, product, biosVendor}, " "))
+
+	switch {
+	case strings.Contains(all, "amazon ec2"):
+		provider = CloudAWS
+	case strings.Contains(all, "google"):
+		provider = CloudGCP
+	case strings.Contains(all, "alibaba cloud"):
+		provider = CloudAliyun
+	case strings.Contains(all, "tencent cloud"):
+		provider = CloudTencent
+	case strings.Contains(all, "openstack"):
+		provider = CloudOpenStack
+	case assetTag == "7783-7084-3265-9085-8269-3286-77":
+		// Azure 虚拟机固定的机箱资产标签
+		provider = CloudAzure
+	}
+
+	switch {
+	case strings.Contains(all, "vmware"):
+		virt = VirtVMware
+	case strings.Contains(all, "virtualbox") || strings.Contains(all, "innotek"):
+		virt = VirtVirtualBox
+	case strings.Contains(vendor, "Microsoft") && strings.Contains(product, "Virtual Machine"):
+		virt = VirtHyperV
+	case strings.Contains(all, "xen") || readRootFile(root, "sys/hypervisor/type") == "xen":
+		virt = VirtXen
+	case strings.Contains(all, "qemu") || strings.Contains(all, "kvm") || provider == CloudAWS || provider == CloudGCP ||
+		provider == CloudAliyun || provider == CloudTencent || provider == CloudOpenStack:
+		// 主流云主机均为 KVM 系（AWS Nitro、GCE 等）
+		virt = VirtKVM
+	case cpuHasHypervisorFlag(readRootFile(root, "proc/cpuinfo")):
+		virt = VirtUnknown
+	default:
+		virt = VirtBareMetal
+	}
+	return virt, provider
+}
+
+func cpuHasHypervisorFlag(cpuinfo string) bool {
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) != "flags" {
+			continue
+		}
+		for _, f := range strings.Fields(v) {
+			if f == "hypervisor" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// DetectContainer 判断 agent 是否运行在容器内，返回容器类型，非容器返回空
+func DetectContainer(root string) string {
+	if _, err := os.Stat(filepath.Join(root, ".dockerenv")); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat(filepath.Join(root, "run/.containerenv")); err == nil {
+		return "podman"
+	}
+	// systemd 约定的 container= 环境变量（lxc/podman/systemd-nspawn ...）
+	for _, kv := range strings.Split(readRootFile(root, "proc/1/environ"), "\x00") {
+		if v, ok := strings.CutPrefix(kv, "container="); ok && v != "" {
+			return v
+		}
+	}
+	cg := readRootFile(root, "proc/1/cgroup")
+	switch {
+	case strings.Contains(cg, "kubepods"):
+		return "kubernetes"
+	case strings.Contains(cg, "/docker"):
+		return "docker"
+	case strings.Contains(cg, "/lxc"):
+		return "lxc"
+	case strings.Contains(cg, "containerd"):
+		return "containerd"
+	}
+	return ""
+}
+
+// metadataClient 云主机元数据服务客户端，base 为空时使用厂商默认地址
+type metadataClient struct {
+	base string
+	http *http.Client
+}
+
+func (c *metadataClient) do(ctx context.Context, method, defBase, path string, header map[string]string) (string, error) {
+	base := c.base
+	if base == "" {
+		base = defBase
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(base, "/")+path, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// lastSegment GCP 返回 projects/<n>/zones/<zone> 形式
+func lastSegment(s string) string {
+	return s[strings.LastIndexByte(s, '/')+1:]
+}
+
+// regionOfZone 可用区去掉末尾的 -a/a 得到地域（us-central1-a -> us-central1，us-east-1a -> us-east-1）
+func regionOfZone(zone string) string {
+	if i := strings.LastIndexByte(zone, '-'); i > 0 && len(zone)-i == 2 {
+		return zone[:i]
+	}
+	if n := len(zone); n > 1 && zone[n-1] >= 'a' && zone[n-1] <= 'z' && zone[n-2] >= '0' && zone[n-2] <= '9' {
+		return zone[:n-1]
+	}
+	return zone
+}
+
+// metadataFetchers 各厂商的元数据查询
+var metadataFetchers = map[string]func(ctx context.Context, c *metadataClient) (*PlatformInfo, error){
+	// AWS IMDSv2：先获取 token
+	CloudAWS: func(ctx context.Context, c *metadataClient) (*PlatformInfo, error) {
+		const base = "http://169.254.169.254"
+		token, err := c.do(ctx, http.MethodPut, base, "/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+		if err != nil {
+			return nil, err
+		}
+		h := map[string]string{"X-aws-ec2-metadata-token": token}
+		p := &PlatformInfo{}
+		if p.InstanceID, err = c.do(ctx, http.MethodGet, base, "/latest/meta-data/instance-id", h); err != nil {
+			return nil, err
+		}
+		p.InstanceType, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/instance-type", h)
+		p.Zone, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/placement/availability-zone", h)
+		if p.Region, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/placement/region", h); p.Region == "" {
+			p.Region = regionOfZone(p.Zone)
+		}
+		return p, nil
+	},
+	CloudGCP: func(ctx context.Context, c *metadataClient) (*PlatformInfo, error) {
+		const base = "http://metadata.google.internal"
+		h := map[string]string{"Metadata-Flavor": "Google"}
+		p := &PlatformInfo{}
+		var err error
+		if p.InstanceID, err = c.do(ctx, http.MethodGet, base, "/computeMetadata/v1/instance/id", h); err != nil {
+			return nil, err
+		}
+		mt, _ := c.do(ctx, http.MethodGet, base, "/computeMetadata/v1/instance/machine-type", h)
+		zone, _ := c.do(ctx, http.MethodGet, base, "/computeMetadata/v1/instance/zone", h)
+		p.InstanceType, p.Zone = lastSegment(mt), lastSegment(zone)
+		p.Region = regionOfZone(p.Zone)
+		return p, nil
+	},
+	CloudAzure: func(ctx context.Context, c *metadataClient) (*PlatformInfo, error) {
+		out, err := c.do(ctx, http.MethodGet, "http://169.254.169.254", "/metadata/instance/compute?api-version=2021-02-01&format=json",
+			map[string]string{"Metadata": "true"})
+		if err != nil {
+			return nil, err
+		}
+		var m struct {
+			VMID     string `json:"vmId"`
+			VMSize   string `json:"vmSize"`
+			Location string `json:"location"`
+			Zone     string `json:"zone"`
+		}
+		if err := json.Unmarshal([]byte(out), &m); err != nil {
+			return nil, err
+		}
+		p := &PlatformInfo{InstanceID: m.VMID, InstanceType: m.VMSize, Region: m.Location, Zone: m.Zone}
+		// Azure 可用区为 1/2/3，补上地域便于区分
+		if p.Zone != "" && p.Region != "" {
+			p.Zone = p.Region + "-" + p.Zone
+		}
+		return p, nil
+	},
+	CloudAliyun: func(ctx context.Context, c *metadataClient) (*PlatformInfo, error) {
+		const base = "http://100.100.100.200"
+		p := &PlatformInfo{}
+		var err error
+		if p.InstanceID, err = c.do(ctx, http.MethodGet, base, "/latest/meta-data/instance-id", nil); err != nil {
+			return nil, err
+		}
+		p.InstanceType, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/instance/instance-type", nil)
+		p.Zone, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/zone-id", nil)
+		p.Region, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/region-id", nil)
+		return p, nil
+	},
+	CloudTencent: func(ctx context.Context, c *metadataClient) (*PlatformInfo, error) {
+		const base = "http://metadata.tencentyun.com"
+		p := &PlatformInfo{}
+		var err error
+		if p.InstanceID, err = c.do(ctx, http.MethodGet, base, "/latest/meta-data/instance-id", nil); err != nil {
+			return nil, err
+		}
+		p.InstanceType, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/instance/instance-type", nil)
+		p.Zone, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/placement/zone", nil)
+		p.Region, _ = c.do(ctx, http.MethodGet, base, "/latest/meta-data/placement/region", nil)
+		return p, nil
+	},
+	CloudOpenStack: func(ctx context.Context, c *metadataClient) (*PlatformInfo, error) {
+		out, err := c.do(ctx, http.MethodGet, "http://169.254.169.254", "/openstack/latest/meta_data.json", nil)
+		if err != nil {
+			return nil, err
+		}
+		var m struct {
+			UUID string `json:"uuid"`
+			AZ   string `json:"availability_zone"`
+		}
+		if err := json.Unmarshal([]byte(out), &m); err != nil {
+			return nil, err
+		}
+		return &PlatformInfo{InstanceID: m.UUID, Zone: m.AZ}, nil
+	},
+}
+
+// fetchCloudMetadata 查询 provider 的元数据服务；base 为空时使用厂商默认地址
+func fetchCloudMetadata(provider, base string, timeout time.Duration) (*PlatformInfo, error) {
+	fetch, ok := metadataFetchers[provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cloud provider %q", provider)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// 元数据服务为本地链路地址，不走代理
+	c := &metadataClient{base: base, http: &http.Client{Transport: &http.Transport{Proxy: nil}}}
+	p, err := fetch(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	p.Provider = provider
+	return p, nil
+}
+
+// platformRetry 元数据查询失败后的重试间隔
+const platformRetry = 5 * time.Minute
+
+var platformCache struct {
+	mu      sync.Mutex
+	info    *PlatformInfo
+	done    bool // 元数据已成功获取或无需查询
+	lastTry time.Time
+}
+
+// platformGroup 合并并发的平台检测，元数据 HTTP 查询期间不持有 platformCache.mu
+var platformGroup singleflight.Group
+
+// GetPlatformInfo 检测虚拟化、容器与云厂商；Cloud.Metadata 开启且识别出云厂商（或 Cloud.Provider 指定）时查询元数据服务。
+// 结果缓存，元数据查询失败时每 5 分钟在后台重试，重试期间返回上次的结果
+func GetPlatformInfo() *PlatformInfo {
+	platformCache.mu.Lock()
+	info := platformCache.info
+	fresh := platformCache.done || (info != nil && time.Since(platformCache.lastTry) < platformRetry)
+	platformCache.mu.Unlock()
+	if fresh {
+		return info
+	}
+	if info != nil {
+		platformGroup.DoChan("platform", loadPlatformInfo)
+		return info
+	}
+	v, _, _ := platformGroup.Do("platform", loadPlatformInfo)
+	return v.(*PlatformInfo)
+}
+
+// loadPlatformInfo 执行一次检测与元数据查询，完成后更新缓存
+func loadPlatformInfo() (interface{}, error) {
+	info := &PlatformInfo{Container: DetectContainer("/")}
+	info.Virtualization, info.Provider = DetectVirtualization("/")
+	if p := strings.TrimSpace(viper.GetString("Cloud.Provider")); p != "" {
+		info.Provider = p
+	}
+	done := true
+	if info.Provider != "" && viper.GetBool("Cloud.Metadata") {
+		md, err := fetchCloudMetadata(info.Provider, viper.GetString("Cloud.MetadataURL"), viper.GetDuration("Cloud.Timeout"))
+		if err != nil {
+			logrus.WithError(err).WithField("provider", info.Provider).Warn("GetPlatformInfo: query cloud metadata failed")
+			done = false
+		} else {
+			info.InstanceID, info.InstanceType, info.Zone, info.Region = md.InstanceID, md.InstanceType, md.Zone, md.Region
+			logrus.WithFields(logrus.Fields{
+				"provider": info.Provider,
+				"instance": info.InstanceID,
+				"zone":     info.Zone,
+				"region":   info.Region,
+			}).Info("GetPlatformInfo: cloud metadata loaded")
+		}
+	}
+
+	platformCache.mu.Lock()
+	defer platformCache.mu.Unlock()
+	platformCache.info, platformCache.lastTry, platformCache.done = info, time.Now(), done
+	return info, nil
+}
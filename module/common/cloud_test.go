@@ -0,0 +1,257 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestDetectVirtualization(t *testing.T) {
+	cases := []struct {
+		files          map[string]string
+		virt, provider string
+	}{
+		{map[string]string{"sys/class/dmi/id/sys_vendor": "QEMU", "sys/class/dmi/id/product_name": "Standard PC (i440FX + PIIX, 1996)"}, VirtKVM, ""},
+		{map[string]string{"sys/class/dmi/id/sys_vendor": "VMware, Inc.", "sys/class/dmi/id/product_name": "VMware Virtual Platform"}, VirtVMware, ""},
+		{map[string]string{"sys/class/dmi/id/sys_vendor": "Amazon EC2", "sys/class/dmi/id/product_name": "m5.large"}, VirtKVM, CloudAWS},
+		{map[string]string{"sys/class/dmi/id/sys_vendor": "Google", "sys/class/dmi/id/product_name": "Google Compute Engine"}, VirtKVM, CloudGCP},
+		{map[string]string{
+			"sys/class/dmi/id/sys_vendor":        "Microsoft Corporation",
+			"sys/class/dmi/id/product_name":      "Virtual Machine",
+			"sys/class/dmi/id/chassis_asset_tag": "7783-7084-3265-9085-8269-3286-77",
+		}, VirtHyperV, CloudAzure},
+		{map[string]string{"sys/class/dmi/id/sys_vendor": "Xen", "sys/hypervisor/type": "xen"}, VirtXen, ""},
+		{map[string]string{"proc/cpuinfo": "processor\t: 0\nflags\t\t: fpu vme hypervisor lm"}, VirtUnknown, ""},
+		{map[string]string{"sys/class/dmi/id/sys_vendor": "Dell Inc.", "sys/class/dmi/id/product_name": "PowerEdge R740",
+			"proc/cpuinfo": "flags\t\t: fpu vme lm"}, VirtBareMetal, ""},
+	}
+	for _, c := range cases {
+		root := t.TempDir()
+		writeSys(t, root, c.files)
+		virt, provider := DetectVirtualization(root)
+		if virt != c.virt || provider != c.provider {
+			t.Fatalf("%v: got %s/%s want %s/%s", c.files, virt, provider, c.virt, c.provider)
+		}
+	}
+}
+
+func TestDetectContainer(t *testing.T) {
+	cases := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{".dockerenv": ""}, "docker"},
+		{map[string]string{"proc/1/environ": "PATH=/bin\x00container=lxc\x00"}, "lxc"},
+		{map[string]string{"proc/1/cgroup": "0::/kubepods/burstable/pod123/abc"}, "kubernetes"},
+		{map[string]string{"proc/1/cgroup": "0::/init.scope"}, ""},
+	}
+	for _, c := range cases {
+		root := t.TempDir()
+		writeSys(t, root, c.files)
+		if got := DetectContainer(root); got != c.want {
+			t.Fatalf("%v: got %q want %q", c.files, got, c.want)
+		}
+	}
+}
+
+func TestRegionOfZone(t *testing.T) {
+	for zone, want := range map[string]string{"us-east-1a": "us-east-1", "us-central1-a": "us-central1", "cn-hangzhou-h": "cn-hangzhou", "az1": "az1"} {
+		if got := regionOfZone(zone); got != want {
+			t.Fatalf("%s: got %s want %s", zone, got, want)
+		}
+	}
+}
+
+// metadataStub 本地模拟元数据服务：path -> 响应，require 为必须携带的请求头
+func metadataStub(t *testing.T, require map[string]string, routes map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range require {
+			if r.Header.Get(k) != v {
+				http.Error(w, "missing header "+k, http.StatusUnauthorized)
+				return
+			}
+		}
+		body, ok := routes[r.Method+" "+r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchCloudMetadata_AWS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			_, _ = w.Write([]byte("tok"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			_, _ = w.Write([]byte("i-0abc"))
+		case "/latest/meta-data/instance-type":
+			_, _ = w.Write([]byte("m5.large"))
+		case "/latest/meta-data/placement/availability-zone":
+			_, _ = w.Write([]byte("us-east-1a"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := fetchCloudMetadata(CloudAWS, srv.URL, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Provider != CloudAWS || p.InstanceID != "i-0abc" || p.InstanceType != "m5.large" || p.Zone != "us-east-1a" || p.Region != "us-east-1" {
+		t.Fatalf("got=%+v", p)
+	}
+}
+
+func TestFetchCloudMetadata_GCPAndAzure(t *testing.T) {
+	gcp := metadataStub(t, map[string]string{"Metadata-Flavor": "Google"}, map[string]string{
+		"GET /computeMetadata/v1/instance/id":           "1234567890",
+		"GET /computeMetadata/v1/instance/machine-type": "projects/42/machineTypes/n2-standard-4",
+		"GET /computeMetadata/v1/instance/zone":         "projects/42/zones/europe-west1-b",
+	})
+	p, err := fetchCloudMetadata(CloudGCP, gcp.URL, time.Second)
+	if err != nil || p.InstanceType != "n2-standard-4" || p.Zone != "europe-west1-b" || p.Region != "europe-west1" {
+		t.Fatalf("gcp=%+v err=%v", p, err)
+	}
+
+	azure := metadataStub(t, map[string]string{"Metadata": "true"}, map[string]string{
+		"GET /metadata/instance/compute?api-version=2021-02-01&format=json": `{"vmId":"vm-1","vmSize":"Standard_D4s_v5","location":"eastus","zone":"2"}`,
+	})
+	p, err = fetchCloudMetadata(CloudAzure, azure.URL, time.Second)
+	if err != nil || p.InstanceID != "vm-1" || p.Region != "eastus" || p.Zone != "eastus-2" {
+		t.Fatalf("azure=%+v err=%v", p, err)
+	}
+}
+
+func TestFetchCloudMetadata_Errors(t *testing.T) {
+	srv := metadataStub(t, nil, nil)
+	if _, err := fetchCloudMetadata(CloudAliyun, srv.URL, time.Second); err == nil {
+		t.Fatalf("expected error on 404")
+	}
+	if _, err := fetchCloudMetadata("unknown", srv.URL, time.Second); err == nil {
+		t.Fatalf("expected error for unknown provider")
+	}
+}
+
+func TestGetDeviceZoneRegion_FromCloudMetadata(t *testing.T) {
+	defer setupViperForLinuxTests()()
+	srv := metadataStub(t, nil, map[string]string{
+		"GET /latest/meta-data/instance-id":            "i-bp1abc",
+		"GET /latest/meta-data/instance/instance-type": "ecs.g7.xlarge",
+		"GET /latest/meta-data/zone-id":                "cn-hangzhou-h",
+		"GET /latest/meta-data/region-id":              "cn-hangzhou",
+	})
+	viper.Set("Cloud.Metadata", true)
+	viper.Set("Cloud.Provider", CloudAliyun)
+	viper.Set("Cloud.MetadataURL", srv.URL)
+	viper.Set("Cloud.Timeout", "1s")
+	platformCache.info, platformCache.done = nil, false
+	defer func() { platformCache.info, platformCache.done = nil, false }()
+
+	if got := GetDeviceZone(); got != "cn-hangzhou-h" {
+		t.Fatalf("zone=%q", got)
+	}
+	if got := GetDeviceRegion(); got != "cn-hangzhou" {
+		t.Fatalf("region=%q", got)
+	}
+	if p := GetPlatformInfo(); p.InstanceID != "i-bp1abc" || p.InstanceType != "ecs.g7.xlarge" {
+		t.Fatalf("platform=%+v", p)
+	}
+
+	// 配置优先
+	viper.Set("IDC.Zone", "idc-a")
+	viper.Set("IDC.Region", "north")
+	if GetDeviceZone() != "idc-a" || GetDeviceRegion() != "north" {
+		t.Fatalf("config should override metadata")
+	}
+}
+
+func TestGetPlatformInfo_RetryInBackground(t *testing.T) {
+	defer setupViperForLinuxTests()()
+	var (
+		mu      sync.Mutex
+		ok      bool
+		queries int
+	)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest/meta-data/instance-id" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		queries++
+		serve := ok
+		mu.Unlock()
+		if !serve {
+			http.NotFound(w, r)
+			return
+		}
+		<-release
+		_, _ = w.Write([]byte("i-retry"))
+	}))
+	defer srv.Close()
+	viper.Set("Cloud.Metadata", true)
+	viper.Set("Cloud.Provider", CloudAliyun)
+	viper.Set("Cloud.MetadataURL", srv.URL)
+	viper.Set("Cloud.Timeout", "5s")
+	platformCache.info, platformCache.done = nil, false
+	defer func() { platformCache.info, platformCache.done = nil, false }()
+
+	first := GetPlatformInfo()
+	if first.InstanceID != "" || platformCache.done {
+		t.Fatalf("expected metadata failure, platform=%+v", first)
+	}
+
+	// 到达重试时间：元数据服务变慢，调用方立即拿到上次结果，并发调用只查询一次
+	mu.Lock()
+	ok, queries = true, 0
+	mu.Unlock()
+	platformCache.mu.Lock()
+	platformCache.lastTry = time.Now().Add(-2 * platformRetry)
+	platformCache.mu.Unlock()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p := GetPlatformInfo(); p != first {
+				t.Errorf("expected cached platform while retrying, got %+v", p)
+			}
+		}()
+	}
+	wg.Wait()
+	if time.Since(start) > time.Second {
+		t.Fatalf("GetPlatformInfo blocked on metadata query")
+	}
+	close(release)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for GetPlatformInfo().InstanceID != "i-retry" {
+		if time.Now().After(deadline) {
+			t.Fatalf("background retry not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if queries != 1 {
+		t.Fatalf("expected a single metadata query, got %d", queries)
+	}
+}
@@ -8,20 +8,38 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/xulei1234/x-proto/xps"
+	"golang.org/x/sys/unix"
 	"io"
 	"os/exec"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
-// SyncExec 同步执行命令，并返回执行结果。
-// 特点：
-//  1. 使用 CombinedOutput 简化流程，减少管道/Wait 竞态
-//  2. 统一提取退出码
-//  3. 限制输出大小，避免大输出导致内存膨胀
+// 同步执行的输出模式
+const (
+	OutputSeparate = "separate" // stdout/stderr 分别采集（默认）
+	OutputCombined = "combined" // stdout/stderr 合并到 Stdout，Stderr 仅保存错误信息（兼容旧行为）
+)
+
+// SyncExec 同步执行命令（stdout/stderr 分离），并返回执行结果。
 func SyncExec(cmd *exec.Cmd) *xps.Body {
-	logrus.Infoln("==> 同步执行命令开始")
+	return SyncExecWithMode(cmd, OutputSeparate)
+}
+
+// SyncExecWithMode 同步执行命令，并返回执行结果。
+func SyncExecWithMode(cmd *exec.Cmd, mode string) *xps.Body {
+	return SyncExecTee(cmd, mode, nil, nil)
+}
+
+// SyncExecTee 同步执行命令，并返回执行结果；完整输出同时写入 stdoutTee/stderrTee（可为 nil）。
+// 特点：
+//  1. stdout/stderr 各自使用有上限的缓冲区，截断标记互相独立，超限时保留头尾
+//  2. combined 模式下两路输出写入同一缓冲区（tee 只用 stdoutTee），与旧版 CombinedOutput 行为一致
+//  3. 统一提取退出码
+func SyncExecTee(cmd *exec.Cmd, mode string, stdoutTee, stderrTee io.Writer) *xps.Body {
+	logrus.WithField("mode", mode).Infoln("==> 同步执行命令开始")
 
 	var body xps.Body
 	if cmd == nil {
@@ -30,17 +48,28 @@ func SyncExec(cmd *exec.Cmd) *xps.Body {
 		return &body
 	}
 
-	// 统一以配置兜底，避免未设置时无限输出
-	maxBytes := viper.GetInt("Cmd.MaxOutputBytes")
-	if maxBytes <= 0 {
-		// 默认 1MiB
-		maxBytes = 1 << 20
+	maxBytes := MaxOutputBytes()
+
+	combined := mode == OutputCombined
+	stdout := &cappedBuffer{max: maxBytes}
+	stderr := stdout
+	if combined {
+		// 同一个 Writer 时 exec 只用一个 goroutine 拷贝，保证 cappedBuffer 串行写入
+		w := withTee(stdout, stdoutTee)
+		cmd.Stdout = w
+		cmd.Stderr = w
+	} else {
+		stderr = &cappedBuffer{max: maxBytes}
+		cmd.Stdout = withTee(stdout, stdoutTee)
+		cmd.Stderr = withTee(stderr, stderrTee)
 	}
 
-	out, err := cmd.CombinedOutput()
-	out = clampBytes(out, maxBytes)
+	err := cmd.Run()
 
-	body.Stdout = out
+	body.Stdout = stdout.Bytes()
+	if !combined {
+		body.Stderr = stderr.Bytes()
+	}
 	body.Code = 0
 
 	if err == nil {
@@ -52,22 +81,139 @@ func SyncExec(cmd *exec.Cmd) *xps.Body {
 	code := exitCodeFromErr(err)
 	body.Code = int32(code)
 
+	if combined {
+		// 合并模式下 stderr 已在 Stdout 中，这里只附加错误文本
+		body.Stderr = []byte(err.Error())
+	} else if !isPlainExit(err) {
+		// 启动失败/被信号终止等情况没有进程输出可依赖，附加错误文本便于定位
+		body.Stderr = appendErrLine(body.Stderr, err)
+	}
+
 	// ctx/超时信息更明确（CommandContext 常见）
 	if cmd.ProcessState == nil && errors.Is(err, context.DeadlineExceeded) {
-		body.Stderr = []byte(err.Error())
 		logrus.WithError(err).Warn("==> 同步执行命令结束: deadline exceeded")
 		return &body
 	}
 
-	// ExitError 的 Stderr 在 CombinedOutput 已合在 Stdout，这里附加错误文本即可
-	body.Stderr = []byte(err.Error())
 	logrus.WithError(err).Warnf("==> 同步执行命令结束: code=%d", code)
 	return &body
 }
 
-// AsyncExec 异步执行命令：按行实时输出（stdout/stderr 都会透传到 resCh）。
-// 保证：函数退出时一定 close(resCh)，并避免无限阻塞/无限内存增长。
+// MaxOutputBytes 单次任务回传输出的上限（Cmd.MaxOutputBytes），默认 1MiB
+func MaxOutputBytes() int {
+	// 统一以配置兜底，避免未设置时无限输出
+	maxBytes := viper.GetInt("Cmd.MaxOutputBytes")
+	if maxBytes <= 0 {
+		maxBytes = 1 << 20
+	}
+	return maxBytes
+}
+
+func withTee(w io.Writer, tee io.Writer) io.Writer {
+	if tee == nil {
+		return w
+	}
+	return io.MultiWriter(w, tee)
+}
+
+// cappedBuffer 只保留前 max 字节及最后 max/4 字节的 io.Writer，中间部分丢弃但仍计数。
+// exec 对同一个 Writer 的 Stdout/Stderr 会串行写入，这里无需加锁。
+type cappedBuffer struct {
+	buf   []byte
+	tail  []byte
+	max   int
+	total int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += int64(len(p))
+	// 多保留 1 字节，交给 Bytes 判断是否需要截断标记
+	if room := b.max + 1 - len(b.buf); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.buf = append(b.buf, p[:room]...)
+	}
+	// 尾部窗口：累积到 2 倍再裁剪，摊薄拷贝开销
+	if tailMax := b.max / 4; tailMax > 0 {
+		b.tail = append(b.tail, p...)
+		if len(b.tail) > 2*tailMax {
+			b.tail = append(b.tail[:0], b.tail[len(b.tail)-tailMax:]...)
+		}
+	}
+	return len(p), nil
+}
+
+// Bytes 返回截断后的内容：超限时为 头部 + [truncated] 标记 + 尾部，总长不超过 max
+func (b *cappedBuffer) Bytes() []byte {
+	if !b.Truncated() {
+		return b.buf
+	}
+	marker := fmt.Sprintf("\n[truncated, total %d bytes]\n", b.total)
+	tail := b.tail
+	if tailMax := b.max / 4; len(tail) > tailMax {
+		tail = tail[len(tail)-tailMax:]
+	}
+	head := b.max - len(marker) - len(tail)
+	if head <= 0 {
+		// 上限过小放不下头尾，退化为只保留头部
+		return clampBytes(b.buf, b.max)
+	}
+	out := make([]byte, 0, b.max)
+	out = append(out, b.buf[:head]...)
+	out = append(out, marker...)
+	out = append(out, tail...)
+	return out
+}
+
+// TruncateHeadTail 按 cappedBuffer 的规则截断 b：超过 max 时保留头尾并插入截断标记，max<=0 返回空
+func TruncateHeadTail(b []byte, max int) []byte {
+	if max <= 0 {
+		return nil
+	}
+	if len(b) <= max {
+		return b
+	}
+	cb := &cappedBuffer{max: max}
+	_, _ = cb.Write(b)
+	return cb.Bytes()
+}
+
+// Truncated 是否发生过截断
+func (b *cappedBuffer) Truncated() bool {
+	return b.total > int64(b.max)
+}
+
+// isPlainExit 进程正常退出（非信号、非启动失败）
+func isPlainExit(err error) bool {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return false
+	}
+	if st, ok := ee.Sys().(syscall.WaitStatus); ok {
+		return st.Exited()
+	}
+	return true
+}
+
+func appendErrLine(b []byte, err error) []byte {
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	return append(b, "[error] "+err.Error()+"\n"...)
+}
+
+// AsyncExec 异步执行命令，见 AsyncExecTee。
 func AsyncExec(cmd *exec.Cmd, resCh chan<- ExecRes) {
+	AsyncExecTee(cmd, resCh, nil, nil)
+}
+
+// AsyncExecTee 异步执行命令：按行实时输出（stdout/stderr 都会透传到 resCh），
+// 完整原始输出同时写入 stdoutTee/stderrTee（可为 nil）。
+// 保证：函数退出时一定 close(resCh)，并避免无限内存增长。
+// 投递为阻塞方式，消费慢时反压子进程而不是丢弃；超出上限的行以缺口标记说明。
+// 命令启动后，close 前的最后一条消息一定是 Summary（阻塞投递），消费者需读到 close 为止。
+func AsyncExecTee(cmd *exec.Cmd, resCh chan<- ExecRes, stdoutTee, stderrTee io.Writer) {
 	defer func() {
 		// 保证消费者可退出
 		if resCh != nil {
@@ -86,10 +232,7 @@ func AsyncExec(cmd *exec.Cmd, resCh chan<- ExecRes) {
 	}
 
 	// 输出上限与单行上限
-	maxBytes := viper.GetInt("Cmd.MaxOutputBytes")
-	if maxBytes <= 0 {
-		maxBytes = 1 << 20 // 1MiB
-	}
+	maxBytes := MaxOutputBytes()
 	maxLine := viper.GetInt("Cmd.MaxLineBytes")
 	if maxLine <= 0 {
 		maxLine = 64 << 10 // 64KiB
@@ -106,8 +249,10 @@ func AsyncExec(cmd *exec.Cmd, resCh chan<- ExecRes) {
 		return
 	}
 
+	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		trySend(resCh, ExecRes{Err: fmt.Errorf("Start: %w", err)})
+		resCh <- ExecRes{Summary: &ExecSummary{Code: -1, Error: err.Error()}}
 		return
 	}
 
@@ -115,11 +260,23 @@ func AsyncExec(cmd *exec.Cmd, resCh chan<- ExecRes) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	var used int64
-	var usedMu sync.Mutex
+	var (
+		mu        sync.Mutex
+		used      int64 // 已回传字节数
+		produced  int64 // 进程实际产生的字节数
+		truncated bool
+		omitted   int64 // 超出上限未回传的行数
+	)
+
+	// 阻塞投递：消费者处理不过来时反压到读取端（进而反压到子进程的 pipe），不丢日志
+	send := func(v ExecRes) {
+		resCh <- v
+	}
 
 	consume := func(r io.Reader, stream string) {
 		defer wg.Done()
+		// 无论因何退出都要读空管道，避免子进程写满 pipe 后阻塞
+		defer func() { _, _ = io.Copy(io.Discard, r) }()
 
 		sc := bufio.NewScanner(r)
 		// Scanner 默认 token 太小，必须放大，否则长行会 ErrTooLong
@@ -128,6 +285,11 @@ func AsyncExec(cmd *exec.Cmd, resCh chan<- ExecRes) {
 
 		for sc.Scan() {
 			b := sc.Bytes()
+
+			mu.Lock()
+			produced += int64(len(b)) + 1
+			mu.Unlock()
+
 			if len(b) == 0 {
 				continue
 			}
@@ -138,43 +300,79 @@ func AsyncExec(cmd *exec.Cmd, resCh chan<- ExecRes) {
 				line = append(line, '\n')
 			}
 
-			// 总量限制：到达上限后停止继续读取，防止内存/带宽被打爆
-			usedMu.Lock()
+			// 总量限制：到达上限后只计数不回传，防止内存/带宽被打爆
+			mu.Lock()
 			if used+int64(len(line)) > int64(maxBytes) {
 				remain := int64(maxBytes) - used
+				truncated = true
+				used = int64(maxBytes)
+				if remain <= 0 {
+					omitted++
+				}
+				mu.Unlock()
 				if remain > 0 {
-					line = line[:remain]
-					used = int64(maxBytes)
-					usedMu.Unlock()
-					trySend(resCh, ExecRes{Buf: prefixStream(stream, line)})
-				} else {
-					usedMu.Unlock()
+					send(ExecRes{Buf: prefixStream(stream, line[:remain])})
 				}
-				return
+				continue
 			}
 			used += int64(len(line))
-			usedMu.Unlock()
+			mu.Unlock()
 
-			trySend(resCh, ExecRes{Buf: prefixStream(stream, line)})
+			send(ExecRes{Buf: prefixStream(stream, line)})
 		}
 
 		if err := sc.Err(); err != nil {
-			trySend(resCh, ExecRes{Err: fmt.Errorf("%s scan: %w", stream, err)})
+			mu.Lock()
+			truncated = true
+			mu.Unlock()
+			send(ExecRes{Err: fmt.Errorf("%s scan: %w", stream, err)})
+			send(ExecRes{Buf: GapMarker(-1, stream+" scan aborted: "+err.Error())})
 		}
 	}
 
-	go consume(stdout, "stdout")
-	go consume(stderr, "stderr")
+	go consume(teeReader(stdout, stdoutTee), "stdout")
+	go consume(teeReader(stderr, stderrTee), "stderr")
 
 	// 等待输出消费完成再 Wait，避免 Wait 先返回导致 pipe 未读完
 	wg.Wait()
 
+	if omitted > 0 {
+		send(ExecRes{Buf: GapMarker(omitted, fmt.Sprintf("output exceeded %d bytes", maxBytes))})
+	}
+
 	err = cmd.Wait()
+	code, sig := exitStatusFromErr(err)
+	sum := &ExecSummary{
+		Code:       code,
+		Signal:     sig,
+		DurationMs: time.Since(start).Milliseconds(),
+		Bytes:      produced,
+		Truncated:  truncated,
+	}
 	if err != nil {
+		sum.Error = err.Error()
 		// 让上游知道失败原因与退出码
-		trySend(resCh, ExecRes{Err: fmt.Errorf("wait: %w (code=%d)", err, exitCodeFromErr(err))})
-		return
+		send(ExecRes{Err: fmt.Errorf("wait: %w (code=%d)", err, code)})
 	}
+	resCh <- ExecRes{Summary: sum}
+}
+
+func teeReader(r io.Reader, tee io.Writer) io.Reader {
+	if tee == nil {
+		return r
+	}
+	return io.TeeReader(r, tee)
+}
+
+// exitStatusFromErr 返回退出码及终止信号名（未被信号终止时为空）。
+func exitStatusFromErr(err error) (int, string) {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		if st, ok := ee.Sys().(syscall.WaitStatus); ok && st.Signaled() {
+			return exitCodeFromErr(err), unix.SignalName(st.Signal())
+		}
+	}
+	return exitCodeFromErr(err), ""
 }
 
 // exitCodeFromErr 从 error 中提取退出码（兼容正常退出/信号/非 ExitError）。
@@ -216,12 +414,22 @@ func clampBytes(b []byte, maxBytes int) []byte {
 	return out
 }
 
-// trySend 非阻塞投递，避免生产者在消费者卡住时挂死。
+// GapMarker 生成日志缺口标记行，lines < 0 表示丢失行数未知。
+func GapMarker(lines int64, reason string) []byte {
+	if lines < 0 {
+		return []byte(fmt.Sprintf("[x-agent] gap: unknown lines lost (%s)\n", reason))
+	}
+	return []byte(fmt.Sprintf("[x-agent] gap: %d lines lost (%s)\n", lines, reason))
+}
+
+// trySend 非阻塞投递，避免生产者在消费者卡住时挂死，返回是否投递成功。
 // 如需严格不丢日志，可去掉 default 并调整缓冲策略。
-func trySend(ch chan<- ExecRes, v ExecRes) {
+func trySend(ch chan<- ExecRes, v ExecRes) bool {
 	select {
 	case ch <- v:
+		return true
 	default:
+		return false
 	}
 }
 
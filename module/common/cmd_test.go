@@ -48,6 +48,12 @@ func TestHelperProcess(t *testing.T) {
 			os.Stdout.WriteString("0123456789")
 		}
 		os.Exit(0)
+	case "bigerr":
+		os.Stdout.WriteString("small\n")
+		for i := 0; i < 2000; i++ {
+			os.Stderr.WriteString("0123456789")
+		}
+		os.Exit(1)
 	case "sleep":
 		time.Sleep(2 * time.Second)
 		os.Exit(0)
@@ -116,7 +122,7 @@ func TestSyncExec_FailureExitCode(t *testing.T) {
 	if body.Code != 42 {
 		t.Fatalf("expected code=42, got=%d", body.Code)
 	}
-	// CombinedOutput merges stderr into stdout; stderr field carries err.Error()
+	// separate mode: stdout/stderr carry the process output
 	if len(body.Stdout) == 0 {
 		t.Fatalf("expected stdout not empty")
 	}
@@ -148,6 +154,59 @@ func TestSyncExec_OutputClamped(t *testing.T) {
 	}
 }
 
+func TestSyncExec_SeparateStreams(t *testing.T) {
+	defer setupViperForCmdTests()()
+
+	cmd := helperCmd(t, "fail42", nil)
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1")
+
+	body := SyncExec(cmd)
+	if body.Code != 42 {
+		t.Fatalf("expected code=42, got=%d", body.Code)
+	}
+	if string(body.Stdout) != "out\n" {
+		t.Fatalf("expected clean stdout, got=%q", string(body.Stdout))
+	}
+	if string(body.Stderr) != "err\n" {
+		t.Fatalf("expected clean stderr, got=%q", string(body.Stderr))
+	}
+}
+
+func TestSyncExec_IndependentTruncation(t *testing.T) {
+	defer setupViperForCmdTests()()
+
+	viper.Set("Cmd.MaxOutputBytes", 128)
+
+	cmd := helperCmd(t, "bigerr", nil)
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1")
+
+	body := SyncExec(cmd)
+	if string(body.Stdout) != "small\n" {
+		t.Fatalf("stdout should not be truncated, got=%q", string(body.Stdout))
+	}
+	if len(body.Stderr) > 128 || !strings.Contains(string(body.Stderr), "truncated") {
+		t.Fatalf("expected truncated stderr <= 128, got=%q", string(body.Stderr))
+	}
+}
+
+func TestSyncExecWithMode_Combined(t *testing.T) {
+	defer setupViperForCmdTests()()
+
+	cmd := helperCmd(t, "fail42", nil)
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1")
+
+	body := SyncExecWithMode(cmd, OutputCombined)
+	if body.Code != 42 {
+		t.Fatalf("expected code=42, got=%d", body.Code)
+	}
+	if !strings.Contains(string(body.Stdout), "out") || !strings.Contains(string(body.Stdout), "err") {
+		t.Fatalf("expected combined stdout, got=%q", string(body.Stdout))
+	}
+	if string(body.Stderr) != "exit status 42" {
+		t.Fatalf("expected error text in stderr, got=%q", string(body.Stderr))
+	}
+}
+
 func TestSyncExec_Timeout(t *testing.T) {
 	defer setupViperForCmdTests()()
 
@@ -217,6 +276,54 @@ func TestAsyncExec_CommandFailureSendsErr(t *testing.T) {
 	}
 }
 
+func TestAsyncExec_SummaryIsLast(t *testing.T) {
+	defer setupViperForCmdTests()()
+
+	cmd := helperCmd(t, "fail42", nil)
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1")
+
+	ch := make(chan ExecRes, 128)
+	go AsyncExec(cmd, ch)
+
+	var last ExecRes
+	for r := range ch {
+		last = r
+	}
+	if last.Summary == nil {
+		t.Fatalf("expected summary as last message, got=%+v", last)
+	}
+	if last.Summary.Code != 42 || last.Summary.Signal != "" {
+		t.Fatalf("unexpected summary: %+v", last.Summary)
+	}
+	if last.Summary.Bytes != int64(len("out\nerr\n")) || last.Summary.Truncated || last.Summary.Dropped != 0 {
+		t.Fatalf("unexpected summary counters: %+v", last.Summary)
+	}
+}
+
+func TestAsyncExec_SummaryTruncatedAndSignal(t *testing.T) {
+	defer setupViperForCmdTests()()
+
+	viper.Set("Cmd.MaxOutputBytes", 16)
+
+	cmd := exec.Command("sh", "-c", "seq 1 100; kill -9 $$")
+
+	ch := make(chan ExecRes, 128)
+	go AsyncExec(cmd, ch)
+
+	var sum *ExecSummary
+	for r := range ch {
+		if r.Summary != nil {
+			sum = r.Summary
+		}
+	}
+	if sum == nil {
+		t.Fatalf("expected summary")
+	}
+	if !sum.Truncated || sum.Signal != "SIGKILL" || sum.Code != 137 {
+		t.Fatalf("unexpected summary: %+v", sum)
+	}
+}
+
 func TestTrySend_NonBlocking(t *testing.T) {
 	ch := make(chan ExecRes, 1)
 	ch <- ExecRes{Buf: []byte("full")}
@@ -233,6 +340,23 @@ func TestTrySend_NonBlocking(t *testing.T) {
 	}
 }
 
+func TestCappedBuffer_HeadAndTail(t *testing.T) {
+	b := &cappedBuffer{max: 64}
+	_, _ = b.Write([]byte("HEAD"))
+	for i := 0; i < 100; i++ {
+		_, _ = b.Write([]byte("----------"))
+	}
+	_, _ = b.Write([]byte("TAIL"))
+
+	out := string(b.Bytes())
+	if !b.Truncated() || len(out) > 64 {
+		t.Fatalf("expected truncated output <= 64, got=%d %q", len(out), out)
+	}
+	if !strings.HasPrefix(out, "HEAD") || !strings.HasSuffix(out, "TAIL") || !strings.Contains(out, "total 1008 bytes") {
+		t.Fatalf("expected head, marker and tail, got=%q", out)
+	}
+}
+
 func TestClampBytes(t *testing.T) {
 	in := []byte("abcdefghijklmnopqrstuvwxyz")
 	out := clampBytes(in, 10)
@@ -0,0 +1,303 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HardwareInfo 从 SMBIOS（/sys/firmware/dmi/tables）解析的硬件信息
+type HardwareInfo struct {
+	SMBIOSVersion string        `json:"smbiosVersion,omitempty"`
+	BIOS          BIOSInfo      `json:"bios"`
+	System        SystemInfo    `json:"system"`
+	Baseboard     BaseboardInfo `json:"baseboard"`
+	Chassis       ChassisInfo   `json:"chassis"`
+	Processors    []CPUSocket   `json:"processors"`
+	Memory        []MemoryDIMM  `json:"memory"` // 只包含已安装的内存条
+}
+
+// BIOSInfo SMBIOS type 0
+type BIOSInfo struct {
+	Vendor      string `json:"vendor,omitempty"`
+	Version     string `json:"version,omitempty"`
+	ReleaseDate string `json:"releaseDate,omitempty"`
+}
+
+// SystemInfo SMBIOS type 1
+type SystemInfo struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+	SKU          string `json:"sku,omitempty"`
+	Family       string `json:"family,omitempty"`
+}
+
+// BaseboardInfo SMBIOS type 2
+type BaseboardInfo struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+}
+
+// ChassisInfo SMBIOS type 3
+type ChassisInfo struct {
+	Type         string `json:"type,omitempty"` // Rack Mount Chassis/Blade/Desktop ...
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	AssetTag     string `json:"assetTag,omitempty"`
+}
+
+// CPUSocket SMBIOS type 4，每个 CPU 插槽一项
+type CPUSocket struct {
+	Socket       string `json:"socket"`
+	Populated    bool   `json:"populated"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Version      string `json:"version,omitempty"` // 型号，如 Intel(R) Xeon(R) Gold 6248 CPU @ 2.50GHz
+	MaxSpeedMHz  int    `json:"maxSpeedMhz,omitempty"`
+	Cores        int    `json:"cores,omitempty"`
+	Threads      int    `json:"threads,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	PartNumber   string `json:"partNumber,omitempty"`
+}
+
+// MemoryDIMM SMBIOS type 17
+type MemoryDIMM struct {
+	Locator      string `json:"locator"`
+	BankLocator  string `json:"bankLocator,omitempty"`
+	SizeMB       uint64 `json:"sizeMb"`
+	Type         string `json:"type,omitempty"`     // DDR4/DDR5 ...
+	SpeedMTs     int    `json:"speedMts,omitempty"` // 标称速率
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	PartNumber   string `json:"partNumber,omitempty"`
+}
+
+// dmiStructure 一个 SMBIOS 结构：格式化区（含 4 字节头）与字符串表
+type dmiStructure struct {
+	Type    byte
+	data    []byte
+	strings []string
+}
+
+func (s *dmiStructure) byteAt(off int) byte {
+	if off >= len(s.data) {
+		return 0
+	}
+	return s.data[off]
+}
+
+func (s *dmiStructure) word(off int) uint16 {
+	if off+2 > len(s.data) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(s.data[off:])
+}
+
+func (s *dmiStructure) dword(off int) uint32 {
+	if off+4 > len(s.data) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(s.data[off:])
+}
+
+// str 格式化区中的字符串序号（从 1 开始，0 表示无）
+func (s *dmiStructure) str(off int) string {
+	i := int(s.byteAt(off))
+	if i == 0 || i > len(s.strings) {
+		return ""
+	}
+	return strings.TrimSpace(s.strings[i-1])
+}
+
+// parseDMITable 拆分 SMBIOS 结构表，遇到 type 127（表结束）或数据截断时停止
+func parseDMITable(table []byte) []dmiStructure {
+	var out []dmiStructure
+	for len(table) >= 4 {
+		length := int(table[1])
+		if length < 4 || length > len(table) {
+			break
+		}
+		st := dmiStructure{Type: table[0], data: table[:length]}
+		// 字符串表以两个 NUL 结束
+		rest := table[length:]
+		end := -1
+		for i := 0; i+1 < len(rest); i++ {
+			if rest[i] == 0 && rest[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+		if end > 0 {
+			st.strings = strings.Split(string(rest[:end]), "\x00")
+		}
+		out = append(out, st)
+		if st.Type == 127 {
+			break
+		}
+		table = rest[end+2:]
+	}
+	return out
+}
+
+// smbiosVersion 从入口点读取版本：SMBIOS 2.x 为 _SM_，3.x 为 _SM3_
+func smbiosVersion(entry []byte) (major, minor int, ok bool) {
+	switch {
+	case len(entry) >= 9 && string(entry[:5]) == "_SM3_":
+		return int(entry[7]), int(entry[8]), true
+	case len(entry) >= 8 && string(entry[:4]) == "_SM_":
+		return int(entry[6]), int(entry[7]), true
+	}
+	return 0, 0, false
+}
+
+// dmiUUID SMBIOS 2.6 起前三段按小端存储；全 0 或全 FF 视为无效
+func dmiUUID(b []byte, littleEndian bool) string {
+	if len(b) != 16 {
+		return ""
+	}
+	zero, ff := true, true
+	for _, c := range b {
+		zero = zero && c == 0
+		ff = ff && c == 0xff
+	}
+	if zero || ff {
+		return ""
+	}
+	u := append([]byte(nil), b...)
+	if littleEndian {
+		u[0], u[1], u[2], u[3] = u[3], u[2], u[1], u[0]
+		u[4], u[5] = u[5], u[4]
+		u[6], u[7] = u[7], u[6]
+	}
+	return fmt.Sprintf("%X-%X-%X-%X-%X", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+var chassisTypes = []string{
+	1: "Other", 2: "Unknown", 3: "Desktop", 4: "Low Profile Desktop", 5: "Pizza Box", 6: "Mini Tower", 7: "Tower",
+	8: "Portable", 9: "Laptop", 10: "Notebook", 11: "Hand Held", 12: "Docking Station", 13: "All In One",
+	14: "Sub Notebook", 15: "Space-saving", 16: "Lunch Box", 17: "Main Server Chassis", 18: "Expansion Chassis",
+	19: "Sub Chassis", 20: "Bus Expansion Chassis", 21: "Peripheral Chassis", 22: "RAID Chassis",
+	23: "Rack Mount Chassis", 24: "Sealed-case PC", 25: "Multi-system", 26: "CompactPCI", 27: "AdvancedTCA",
+	28: "Blade", 29: "Blade Enclosing", 30: "Tablet", 31: "Convertible", 32: "Detachable", 33: "IoT Gateway",
+	34: "Embedded PC", 35: "Mini PC", 36: "Stick PC",
+}
+
+var memoryTypes = map[byte]string{
+	0x01: "Other", 0x02: "Unknown", 0x03: "DRAM", 0x07: "RAM", 0x0F: "SDRAM", 0x12: "DDR", 0x13: "DDR2",
+	0x14: "DDR2 FB-DIMM", 0x18: "DDR3", 0x1A: "DDR4", 0x1B: "LPDDR", 0x1C: "LPDDR2", 0x1D: "LPDDR3",
+	0x1E: "LPDDR4", 0x1F: "Logical non-volatile device", 0x20: "HBM", 0x21: "HBM2", 0x22: "DDR5", 0x23: "LPDDR5",
+	0x24: "HBM3",
+}
+
+// dimmSizeMB type 17 的 Size：0 未安装，0xFFFF 未知，bit15 置位时单位为 KB，0x7FFF 时使用 Extended Size
+func dimmSizeMB(s *dmiStructure) uint64 {
+	size := s.word(0x0C)
+	switch {
+	case size == 0 || size == 0xFFFF:
+		return 0
+	case size == 0x7FFF:
+		return uint64(s.dword(0x1C) & 0x7FFFFFFF)
+	case size&0x8000 != 0:
+		return uint64(size&0x7FFF) / 1024
+	}
+	return uint64(size)
+}
+
+// ParseDMI 解析 SMBIOS 结构表；entry 为入口点（可为空，按 SMBIOS 2.6+ 处理 UUID 字节序）
+func ParseDMI(entry, table []byte) *HardwareInfo {
+	hw := &HardwareInfo{Processors: []CPUSocket{}, Memory: []MemoryDIMM{}}
+	littleEndianUUID := true
+	if major, minor, ok := smbiosVersion(entry); ok {
+		hw.SMBIOSVersion = fmt.Sprintf("%d.%d", major, minor)
+		littleEndianUUID = major > 2 || (major == 2 && minor >= 6)
+	}
+
+	structs := parseDMITable(table)
+	for i := range structs {
+		s := &structs[i]
+		switch s.Type {
+		case 0:
+			hw.BIOS = BIOSInfo{Vendor: s.str(0x04), Version: s.str(0x05), ReleaseDate: s.str(0x08)}
+		case 1:
+			hw.System = SystemInfo{
+				Manufacturer: s.str(0x04),
+				Product:      s.str(0x05),
+				Version:      s.str(0x06),
+				Serial:       s.str(0x07),
+				SKU:          s.str(0x19),
+				Family:       s.str(0x1A),
+			}
+			if len(s.data) >= 0x18 {
+				hw.System.UUID = dmiUUID(s.data[0x08:0x18], littleEndianUUID)
+			}
+		case 2:
+			hw.Baseboard = BaseboardInfo{Manufacturer: s.str(0x04), Product: s.str(0x05), Version: s.str(0x06), Serial: s.str(0x07)}
+		case 3:
+			hw.Chassis = ChassisInfo{Manufacturer: s.str(0x04), Serial: s.str(0x07), AssetTag: s.str(0x08)}
+			if t := int(s.byteAt(0x05) & 0x7F); t < len(chassisTypes) {
+				hw.Chassis.Type = chassisTypes[t]
+			}
+		case 4:
+			cpu := CPUSocket{
+				Socket:       s.str(0x04),
+				Populated:    s.byteAt(0x18)&0x40 != 0,
+				Manufacturer: s.str(0x07),
+				Version:      s.str(0x10),
+				MaxSpeedMHz:  int(s.word(0x14)),
+				Serial:       s.str(0x20),
+				PartNumber:   s.str(0x22),
+				Cores:        int(s.byteAt(0x23)),
+				Threads:      int(s.byteAt(0x25)),
+			}
+			// 超过 255 时使用 SMBIOS 3.0 的 Core Count 2/Thread Count 2
+			if cpu.Cores == 0xFF {
+				cpu.Cores = int(s.word(0x2A))
+			}
+			if cpu.Threads == 0xFF {
+				cpu.Threads = int(s.word(0x2E))
+			}
+			hw.Processors = append(hw.Processors, cpu)
+		case 17:
+			size := dimmSizeMB(s)
+			if size == 0 {
+				continue
+			}
+			hw.Memory = append(hw.Memory, MemoryDIMM{
+				Locator:      s.str(0x10),
+				BankLocator:  s.str(0x11),
+				SizeMB:       size,
+				Type:         memoryTypes[s.byteAt(0x12)],
+				SpeedMTs:     int(s.word(0x15)),
+				Manufacturer: s.str(0x17),
+				Serial:       s.str(0x18),
+				PartNumber:   s.str(0x1A),
+			})
+		}
+	}
+	return hw
+}
+
+// ReadDMI 读取 sysRoot（通常为 /sys）下的 SMBIOS 表，一般需要 root 权限
+func ReadDMI(sysRoot string) (*HardwareInfo, error) {
+	dir := filepath.Join(sysRoot, "firmware/dmi/tables")
+	table, err := os.ReadFile(filepath.Join(dir, "DMI"))
+	if err != nil {
+		return nil, err
+	}
+	entry, _ := os.ReadFile(filepath.Join(dir, "smbios_entry_point"))
+	return ParseDMI(entry, table), nil
+}
+
+// GetHardwareInfo 采集本机硬件信息
+func GetHardwareInfo() (*HardwareInfo, error) {
+	return ReadDMI("/sys")
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var smbiosEntry30 = []byte("_SM3_\x00\x18\x03\x02\x00")
+
+// dmiStruct 构造一个 SMBIOS 结构：formatted 不含 4 字节头
+func dmiStruct(typ byte, formatted []byte, strs ...string) []byte {
+	b := []byte{typ, byte(4 + len(formatted)), 0, 0}
+	b = append(b, formatted...)
+	for _, s := range strs {
+		b = append(b, s...)
+		b = append(b, 0)
+	}
+	if len(strs) == 0 {
+		b = append(b, 0)
+	}
+	return append(b, 0)
+}
+
+func dmiTestTable() []byte {
+	var t []byte
+	// type 0：vendor=1 version=2 date=3
+	t = append(t, dmiStruct(0, []byte{1, 2, 0, 0, 3, 0}, "Dell Inc.", "2.17.1", "03/15/2023")...)
+
+	// type 1：UUID 前三段小端存储
+	sys := make([]byte, 0x1B-4)
+	sys[0], sys[1], sys[2], sys[3] = 1, 2, 0, 3
+	copy(sys[0x08-4:], []byte{0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x78, 0x56, 0x9A, 0xBC, 0xDE, 0xF0, 0x12, 0x34, 0x56, 0x78})
+	sys[0x19-4], sys[0x1A-4] = 4, 5
+	t = append(t, dmiStruct(1, sys, "Dell Inc.", "PowerEdge R740", "ABC1234", "SKU=0715", "PowerEdge")...)
+
+	// type 3：Rack Mount Chassis
+	t = append(t, dmiStruct(3, []byte{1, 23, 0, 2, 0}, "Dell Inc.", "ABC1234")...)
+
+	// type 4：已安装插槽（status bit6），20 核 40 线程
+	cpu := make([]byte, 0x28-4)
+	cpu[0x04-4], cpu[0x07-4], cpu[0x10-4] = 1, 2, 3
+	binary.LittleEndian.PutUint16(cpu[0x14-4:], 4000)
+	cpu[0x18-4] = 0x41
+	cpu[0x23-4], cpu[0x25-4] = 20, 40
+	t = append(t, dmiStruct(4, cpu, "CPU1", "Intel", "Intel(R) Xeon(R) Gold 6248 CPU @ 2.50GHz")...)
+	// 空插槽
+	empty := make([]byte, 0x28-4)
+	empty[0x04-4] = 1
+	t = append(t, dmiStruct(4, empty, "CPU2")...)
+
+	// type 17：16GB DDR4，另一条未安装，另一条使用 Extended Size
+	dimm := func(size uint16, ext uint32, locator string) []byte {
+		d := make([]byte, 0x22-4)
+		binary.LittleEndian.PutUint16(d[0x0C-4:], size)
+		d[0x10-4], d[0x11-4] = 1, 2
+		d[0x12-4] = 0x1A
+		binary.LittleEndian.PutUint16(d[0x15-4:], 2933)
+		d[0x17-4], d[0x18-4], d[0x1A-4] = 3, 4, 5
+		binary.LittleEndian.PutUint32(d[0x1C-4:], ext)
+		return dmiStruct(17, d, locator, "BANK 0", "Samsung", "S123", "M393A4K40DB3")
+	}
+	t = append(t, dimm(16384, 0, "A1")...)
+	t = append(t, dimm(0, 0, "A2")...)
+	t = append(t, dimm(0x7FFF, 65536, "A3")...)
+
+	t = append(t, dmiStruct(127, nil)...)
+	// 表结束后的数据忽略
+	return append(t, dmiStruct(1, make([]byte, 0x18))...)
+}
+
+func writeDMITables(t *testing.T, root string, entry, table []byte) {
+	t.Helper()
+	dir := filepath.Join(root, "firmware/dmi/tables")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "smbios_entry_point"), entry, 0o400); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "DMI"), table, 0o400); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadDMI(t *testing.T) {
+	root := t.TempDir()
+	writeDMITables(t, root, smbiosEntry30, dmiTestTable())
+	hw, err := ReadDMI(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hw.SMBIOSVersion != "3.2" || hw.BIOS.Version != "2.17.1" || hw.BIOS.ReleaseDate != "03/15/2023" {
+		t.Fatalf("bios=%+v version=%s", hw.BIOS, hw.SMBIOSVersion)
+	}
+	if s := hw.System; s.Product != "PowerEdge R740" || s.Serial != "ABC1234" || s.UUID != "12345678-1234-5678-9ABC-DEF012345678" || s.Family != "PowerEdge" {
+		t.Fatalf("system=%+v", s)
+	}
+	if hw.Chassis.Type != "Rack Mount Chassis" || hw.Chassis.Serial != "ABC1234" {
+		t.Fatalf("chassis=%+v", hw.Chassis)
+	}
+	if len(hw.Processors) != 2 || !hw.Processors[0].Populated || hw.Processors[0].Cores != 20 || hw.Processors[0].Threads != 40 ||
+		hw.Processors[0].MaxSpeedMHz != 4000 || hw.Processors[1].Populated {
+		t.Fatalf("processors=%+v", hw.Processors)
+	}
+	if len(hw.Memory) != 2 || hw.Memory[0].SizeMB != 16384 || hw.Memory[0].Type != "DDR4" || hw.Memory[0].SpeedMTs != 2933 ||
+		hw.Memory[0].PartNumber != "M393A4K40DB3" || hw.Memory[1].Locator != "A3" || hw.Memory[1].SizeMB != 65536 {
+		t.Fatalf("memory=%+v", hw.Memory)
+	}
+}
+
+func TestDMIUUID_LegacyByteOrder(t *testing.T) {
+	b := []byte{0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xDE, 0xF0, 0x12, 0x34, 0x56, 0x78}
+	if got := dmiUUID(b, false); got != "12345678-1234-5678-9ABC-DEF012345678" {
+		t.Fatalf("got=%s", got)
+	}
+	ff := make([]byte, 16)
+	for i := range ff {
+		ff[i] = 0xff
+	}
+	if dmiUUID(ff, true) != "" || dmiUUID(make([]byte, 16), true) != "" {
+		t.Fatalf("invalid uuid should be empty")
+	}
+}
+
+func TestParseDMITable_Truncated(t *testing.T) {
+	table := dmiTestTable()
+	// 截断在字符串表中间时丢弃不完整的结构
+	if got := parseDMITable(table[:20]); len(got) != 0 {
+		t.Fatalf("got=%+v", got)
+	}
+}
@@ -2,8 +2,20 @@ package common
 
 // ExecRes respone
 type ExecRes struct {
-	Buf []byte
-	Err error
+	Buf     []byte
+	Err     error
+	Summary *ExecSummary // 非 nil 表示执行结束（AsyncExec 最后一条消息）
+}
+
+// ExecSummary 异步执行结束时的汇总信息
+type ExecSummary struct {
+	Code       int    `json:"code"`             // 退出码，被信号终止时为 128+signal
+	Signal     string `json:"signal,omitempty"` // 终止信号，如 SIGKILL
+	DurationMs int64  `json:"duration_ms"`      // 执行耗时
+	Bytes      int64  `json:"bytes"`            // 进程产生的输出字节数（含未回传部分）
+	Truncated  bool   `json:"truncated"`        // 输出是否因上限被截断
+	Dropped    int64  `json:"dropped"`          // 回传失败而丢失的日志行数
+	Error      string `json:"error,omitempty"`
 }
 
 var AddressChangeBuffer chan struct{}
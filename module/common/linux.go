@@ -1,9 +1,7 @@
 package common
 
 import (
-	"context"
 	"encoding/json"
-	"errors"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/host"
 	"github.com/shirou/gopsutil/mem"
@@ -13,9 +11,8 @@ import (
 	proto "github.com/xulei1234/x-proto"
 	"net"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
-	"time"
 )
 
 func GetDeviceUUID() string {
@@ -25,12 +22,12 @@ func GetDeviceUUID() string {
 		return strings.ToUpper(confUUID)
 	}
 
-	// 1) 优先尝试 dmidecode（常见需要 root）
-	if uuid, err := readUUIDFromDMI(); err == nil && uuid != "" {
-		logrus.WithField("uuid", uuid).Info("GetDeviceUUID: use dmidecode uuid")
+	// 1) 优先使用 SMBIOS system UUID（常见需要 root）
+	if uuid, err := readUUIDFromDMI("/sys"); err == nil && uuid != "" {
+		logrus.WithField("uuid", uuid).Info("GetDeviceUUID: use dmi uuid")
 		return strings.ToUpper(uuid)
 	} else if err != nil {
-		logrus.WithError(err).Warn("GetDeviceUUID: dmidecode failed, fallback to host id")
+		logrus.WithError(err).Warn("GetDeviceUUID: read dmi failed, fallback to host id")
 	}
 
 	// 2) 回退 host id
@@ -51,44 +48,26 @@ func GetDeviceUUID() string {
 	return ""
 }
 
-func readUUIDFromDMI() (string, error) {
-	// 超时与可复现性更好
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	// 不使用 `sh -c`，避免管道/注入问题
-	cmd := exec.CommandContext(ctx, "dmidecode", "-t", "1")
-	cmd.Env = os.Environ()
-
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		// timeout 也在这里体现
-		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			return "", ctx.Err()
-		}
-		return "", err
+// readUUIDFromDMI 读取 SMBIOS system UUID：优先解析 /sys/firmware/dmi/tables（内核 4.2+），
+// 否则读取内核导出的 /sys/class/dmi/id/product_uuid；两者均需要 root 权限
+func readUUIDFromDMI(sysRoot string) (string, error) {
+	hw, err := ReadDMI(sysRoot)
+	if err == nil && hw.System.UUID != "" {
+		return hw.System.UUID, nil
 	}
-
-	uuid := parseUUIDFromDMIDecode(string(out))
-	return uuid, nil
-}
-
-func parseUUIDFromDMIDecode(s string) string {
-	// dmidecode 输出通常包含：`UUID: XXXXX`
-	for _, line := range strings.Split(s, "\n") {
-		line = strings.TrimSpace(line)
-		if !strings.HasPrefix(strings.ToUpper(line), "UUID:") {
-			continue
-		}
-		v := strings.TrimSpace(strings.TrimPrefix(line, "UUID:"))
-		// 过滤无效值
-		up := strings.ToUpper(v)
-		if up == "" || up == "NOT SETTABLE" || up == "NOT PRESENT" || strings.HasPrefix(up, "00000000-0000-0000-0000-000000000000") {
-			return ""
+	b, err2 := os.ReadFile(filepath.Join(sysRoot, "class/dmi/id/product_uuid"))
+	if err2 != nil {
+		if err != nil {
+			return "", err
 		}
-		return v
+		return "", err2
 	}
-	return ""
+	v := strings.TrimSpace(string(b))
+	up := strings.ToUpper(v)
+	if up == "" || up == "00000000-0000-0000-0000-000000000000" || up == "FFFFFFFF-FFFF-FFFF-FFFF-FFFFFFFFFFFF" {
+		return "", nil
+	}
+	return v, nil
 }
 
 func GetDeviceHostname() string {
@@ -104,8 +83,12 @@ func GetDeviceHostname() string {
 	return realHostName
 }
 
+// GetDeviceZone 配置优先，其次为云主机元数据中的可用区
 func GetDeviceZone() string {
 	zone := strings.TrimSpace(viper.GetString("IDC.Zone"))
+	if zone == "" {
+		zone = GetPlatformInfo().Zone
+	}
 	if zone == "" {
 		zone = "ZONE-DEFAULT"
 		logrus.WithField("zone", zone).Trace("GetDeviceZone: use default zone")
@@ -113,6 +96,14 @@ func GetDeviceZone() string {
 	return zone
 }
 
+// GetDeviceRegion 配置优先，其次为云主机元数据中的地域
+func GetDeviceRegion() string {
+	if region := strings.TrimSpace(viper.GetString("IDC.Region")); region != "" {
+		return region
+	}
+	return GetPlatformInfo().Region
+}
+
 func GetConfigIP() string {
 	configIP := strings.TrimSpace(viper.GetString("IP"))
 	if configIP != "" {
@@ -166,8 +157,16 @@ func GetDeviceIPList() []string {
 	return iplist
 }
 
-func GetDeviceOsInfo() *proto.OSInfo {
-	osinfo := &proto.OSInfo{}
+// OSInfo 在 proto.OSInfo 基础上扩展 agent 侧采集的 section（json 平铺，旧 channel 忽略新增字段）
+type OSInfo struct {
+	proto.OSInfo
+	Storage  *StorageInfo  `json:"storage,omitempty"`
+	Hardware *HardwareInfo `json:"hardware,omitempty"`
+	Platform *PlatformInfo `json:"platform,omitempty"`
+}
+
+func GetDeviceOsInfo() *OSInfo {
+	osinfo := &OSInfo{}
 
 	// Host
 	if hi, err := host.Info(); err == nil {
@@ -206,5 +205,18 @@ func GetDeviceOsInfo() *proto.OSInfo {
 		logrus.WithError(err).Warn("GetDeviceOsInfo: cpu.Info failed")
 	}
 
+	// Storage
+	osinfo.Storage = GetStorageInfo()
+
+	// Hardware（无 SMBIOS 表或权限不足时省略）
+	if hw, err := GetHardwareInfo(); err == nil {
+		osinfo.Hardware = hw
+	} else {
+		logrus.WithError(err).Debug("GetDeviceOsInfo: read dmi failed")
+	}
+
+	// Platform
+	osinfo.Platform = GetPlatformInfo()
+
 	return osinfo
 }
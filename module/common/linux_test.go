@@ -23,37 +23,32 @@ func setupViperForLinuxTests() func() {
 	}
 }
 
-func TestParseUUIDFromDMIDecode_ExtractsUUID(t *testing.T) {
-	// typical dmidecode output fragment
-	in := `
-System Information
-	Manufacturer: Example
-	Product Name: Example
-	UUID: 12345678-1234-1234-1234-1234567890ab
-	SKU Number: To be filled by O.E.M.
-`
-	got := parseUUIDFromDMIDecode(in)
-	if got != "12345678-1234-1234-1234-1234567890ab" {
-		t.Fatalf("expected uuid extracted, got=%q", got)
+func TestReadUUIDFromDMI_Tables(t *testing.T) {
+	root := t.TempDir()
+	writeDMITables(t, root, smbiosEntry30, dmiTestTable())
+	got, err := readUUIDFromDMI(root)
+	if err != nil || got != "12345678-1234-5678-9ABC-DEF012345678" {
+		t.Fatalf("got=%q err=%v", got, err)
 	}
 }
 
-func TestParseUUIDFromDMIDecode_EmptyWhenMissing(t *testing.T) {
-	in := `System Information
-	Product Name: Example
-	Serial Number: ABC
-`
-	got := parseUUIDFromDMIDecode(in)
-	if got != "" {
-		t.Fatalf("expected empty, got=%q", got)
+func TestReadUUIDFromDMI_FallbackProductUUID(t *testing.T) {
+	root := t.TempDir()
+	writeSys(t, root, map[string]string{"class/dmi/id/product_uuid": "  4c4c4544-0042-3510-8052-b4c04f4e4d32 "})
+	got, err := readUUIDFromDMI(root)
+	if err != nil || got != "4c4c4544-0042-3510-8052-b4c04f4e4d32" {
+		t.Fatalf("got=%q err=%v", got, err)
 	}
 }
 
-func TestParseUUIDFromDMIDecode_TrimSpaces(t *testing.T) {
-	in := "UUID:\t  ABCD-EF  \n"
-	got := parseUUIDFromDMIDecode(in)
-	if got != "ABCD-EF" {
-		t.Fatalf("expected trimmed uuid, got=%q", got)
+func TestReadUUIDFromDMI_EmptyWhenUnset(t *testing.T) {
+	root := t.TempDir()
+	writeSys(t, root, map[string]string{"class/dmi/id/product_uuid": "00000000-0000-0000-0000-000000000000"})
+	if got, err := readUUIDFromDMI(root); err != nil || got != "" {
+		t.Fatalf("got=%q err=%v", got, err)
+	}
+	if _, err := readUUIDFromDMI(t.TempDir()); err == nil {
+		t.Fatalf("expected error without dmi")
 	}
 }
 
@@ -62,7 +57,8 @@ func TestGetDeviceUUID_ConfigOverridesEverything(t *testing.T) {
 
 	viper.Set("UUID", "my-fixed-uuid")
 	got := GetDeviceUUID()
-	if got != "my-fixed-uuid" {
+	// 与其他来源一致统一为大写
+	if got != "MY-FIXED-UUID" {
 		t.Fatalf("expected config uuid, got=%q", got)
 	}
 }
@@ -0,0 +1,240 @@
+package common
+
+import (
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	utilnet "github.com/shirou/gopsutil/net"
+)
+
+// MetricsSample 一次采样：指标名 -> 值。按磁盘/网卡/挂载点区分的指标名为 name:设备，如 disk.read_bps:sda、
+// fs.used_pct:/var。速率类指标（*_bps/*_iops/*_pps/*_ps、cpu.*、disk.util_pct）为与上次采样之间的平均值
+type MetricsSample map[string]float64
+
+// metricCounters 计算速率所需的累计计数
+type metricCounters struct {
+	at    time.Time
+	cpu   *cpu.TimesStat
+	disks map[string]disk.IOCountersStat
+	nets  map[string]utilnet.IOCountersStat
+}
+
+// MetricsSampler 周期采样主机指标，保存上次的累计计数用于计算速率
+type MetricsSampler struct {
+	mu   sync.Mutex
+	prev *metricCounters
+}
+
+func NewMetricsSampler() *MetricsSampler {
+	return &MetricsSampler{}
+}
+
+// Sample 采集 CPU、负载、内存/swap、磁盘 IO、网卡流量与文件系统用量；首次采样不含速率类指标。
+// 单项采集失败时跳过该项
+func (s *MetricsSampler) Sample() MetricsSample {
+	out := make(MetricsSample)
+	cur := &metricCounters{at: time.Now()}
+
+	if ts, err := cpu.Times(false); err == nil && len(ts) > 0 {
+		cur.cpu = &ts[0]
+	}
+	if disks, err := disk.IOCounters(); err == nil {
+		cur.disks = make(map[string]disk.IOCountersStat, len(disks))
+		for name, d := range disks {
+			if isWholeDisk(name) {
+				cur.disks[name] = d
+			}
+		}
+	}
+	if nets, err := utilnet.IOCounters(true); err == nil {
+		cur.nets = make(map[string]utilnet.IOCountersStat, len(nets))
+		for _, n := range nets {
+			if n.Name != "lo" {
+				cur.nets[n.Name] = n
+			}
+		}
+	}
+
+	if avg, err := load.Avg(); err == nil {
+		out["load.1"], out["load.5"], out["load.15"] = avg.Load1, avg.Load5, avg.Load15
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		out["mem.used_pct"] = vm.UsedPercent
+		out["mem.available"] = float64(vm.Available)
+	}
+	if sw, err := mem.SwapMemory(); err == nil {
+		out["swap.used_pct"] = sw.UsedPercent
+		out["swap.used"] = float64(sw.Used)
+	}
+	if parts, err := disk.Partitions(false); err == nil {
+		for _, p := range parts {
+			fs := filesystemInfo(p)
+			if fs.UsageError != "" || fs.Total == 0 {
+				continue
+			}
+			out["fs.used_pct:"+fs.Mountpoint] = fs.UsedPercent
+			out["fs.inodes_used_pct:"+fs.Mountpoint] = fs.InodesUsedPercent
+		}
+	}
+
+	s.mu.Lock()
+	prev := s.prev
+	s.prev = cur
+	s.mu.Unlock()
+	for k, v := range counterRates(prev, cur) {
+		out[k] = v
+	}
+	return out
+}
+
+// isWholeDisk 只统计 /sys/block 下的整盘（含 md/dm），排除分区、loop 与 ram
+func isWholeDisk(name string) bool {
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+		return false
+	}
+	_, err := os.Stat("/sys/block/" + name)
+	return err == nil
+}
+
+// counterRates 两次累计计数之间的速率；计数回绕或设备重建时跳过该设备
+func counterRates(prev, cur *metricCounters) MetricsSample {
+	out := make(MetricsSample)
+	if prev == nil {
+		return out
+	}
+	secs := cur.at.Sub(prev.at).Seconds()
+	if secs <= 0 {
+		return out
+	}
+
+	if prev.cpu != nil && cur.cpu != nil {
+		p, c := prev.cpu, cur.cpu
+		total := cpuTotal(c) - cpuTotal(p)
+		if total > 0 {
+			pct := func(a, b float64) float64 { return math.Max(0, (b-a)/total*100) }
+			out["cpu.user_pct"] = pct(p.User+p.Nice, c.User+c.Nice)
+			out["cpu.system_pct"] = pct(p.System+p.Irq+p.Softirq, c.System+c.Irq+c.Softirq)
+			out["cpu.iowait_pct"] = pct(p.Iowait, c.Iowait)
+			out["cpu.steal_pct"] = pct(p.Steal, c.Steal)
+			out["cpu.util_pct"] = 100 - pct(p.Idle+p.Iowait, c.Idle+c.Iowait)
+		}
+	}
+
+	rate := func(a, b uint64) (float64, bool) {
+		if b < a {
+			return 0, false
+		}
+		return float64(b-a) / secs, true
+	}
+	for name, c := range cur.disks {
+		p, ok := prev.disks[name]
+		if !ok || c.ReadBytes < p.ReadBytes || c.WriteBytes < p.WriteBytes {
+			continue
+		}
+		out["disk.read_bps:"+name], _ = rate(p.ReadBytes, c.ReadBytes)
+		out["disk.write_bps:"+name], _ = rate(p.WriteBytes, c.WriteBytes)
+		out["disk.read_iops:"+name], _ = rate(p.ReadCount, c.ReadCount)
+		out["disk.write_iops:"+name], _ = rate(p.WriteCount, c.WriteCount)
+		// IoTime 为设备忙碌的累计毫秒数
+		if busy, ok := rate(p.IoTime, c.IoTime); ok {
+			out["disk.util_pct:"+name] = math.Min(100, busy/10)
+		}
+	}
+	for name, c := range cur.nets {
+		p, ok := prev.nets[name]
+		if !ok || c.BytesRecv < p.BytesRecv || c.BytesSent < p.BytesSent {
+			continue
+		}
+		out["net.rx_bps:"+name], _ = rate(p.BytesRecv, c.BytesRecv)
+		out["net.tx_bps:"+name], _ = rate(p.BytesSent, c.BytesSent)
+		out["net.rx_pps:"+name], _ = rate(p.PacketsRecv, c.PacketsRecv)
+		out["net.tx_pps:"+name], _ = rate(p.PacketsSent, c.PacketsSent)
+		out["net.err_ps:"+name], _ = rate(p.Errin+p.Errout, c.Errin+c.Errout)
+		out["net.drop_ps:"+name], _ = rate(p.Dropin+p.Dropout, c.Dropin+c.Dropout)
+	}
+	return out
+}
+
+// cpuTotal Linux 上 User 已包含 Guest，不重复计入
+func cpuTotal(t *cpu.TimesStat) float64 {
+	return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+// MetricsPoint 一个聚合窗口内各指标的平均值与最大值
+type MetricsPoint struct {
+	Time    int64              `json:"time"` // 窗口起始，unix 秒
+	Samples int                `json:"samples"`
+	Avg     map[string]float64 `json:"avg"`
+	Max     map[string]float64 `json:"max"`
+}
+
+// MetricsAggregator 按固定间隔（对齐到整点）聚合采样
+type MetricsAggregator struct {
+	interval time.Duration
+	start    time.Time
+	samples  int
+	sum, max map[string]float64
+	count    map[string]int
+}
+
+func NewMetricsAggregator(interval time.Duration) *MetricsAggregator {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &MetricsAggregator{interval: interval}
+}
+
+// Add 加入一次采样；采样落入新窗口时返回上一个窗口的聚合结果
+func (a *MetricsAggregator) Add(at time.Time, sample MetricsSample) *MetricsPoint {
+	start := at.Truncate(a.interval)
+	var done *MetricsPoint
+	if a.samples > 0 && !start.Equal(a.start) {
+		done = a.Flush()
+	}
+	if a.samples == 0 {
+		a.start = start
+		a.sum, a.max, a.count = make(map[string]float64), make(map[string]float64), make(map[string]int)
+	}
+	a.samples++
+	for k, v := range sample {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		if n := a.count[k]; n == 0 || v > a.max[k] {
+			a.max[k] = v
+		}
+		a.sum[k] += v
+		a.count[k]++
+	}
+	return done
+}
+
+// Flush 返回当前窗口的聚合结果并清空，无采样时返回 nil
+func (a *MetricsAggregator) Flush() *MetricsPoint {
+	if a.samples == 0 {
+		return nil
+	}
+	p := &MetricsPoint{
+		Time:    a.start.Unix(),
+		Samples: a.samples,
+		Avg:     make(map[string]float64, len(a.sum)),
+		Max:     make(map[string]float64, len(a.max)),
+	}
+	for k, sum := range a.sum {
+		p.Avg[k] = round2(sum / float64(a.count[k]))
+		p.Max[k] = round2(a.max[k])
+	}
+	a.samples = 0
+	return p
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
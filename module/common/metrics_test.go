@@ -0,0 +1,66 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	utilnet "github.com/shirou/gopsutil/net"
+)
+
+func TestCounterRates(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	prev := &metricCounters{
+		at:    at,
+		cpu:   &cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 50},
+		disks: map[string]disk.IOCountersStat{"sda": {ReadBytes: 1000, WriteBytes: 0, ReadCount: 10, IoTime: 0}},
+		nets:  map[string]utilnet.IOCountersStat{"eth0": {BytesRecv: 100, BytesSent: 100}},
+	}
+	cur := &metricCounters{
+		at:    at.Add(10 * time.Second),
+		cpu:   &cpu.TimesStat{User: 130, System: 60, Idle: 850, Iowait: 60},
+		disks: map[string]disk.IOCountersStat{"sda": {ReadBytes: 11000, WriteBytes: 5000, ReadCount: 60, IoTime: 5000}},
+		nets:  map[string]utilnet.IOCountersStat{"eth0": {BytesRecv: 50, BytesSent: 1100}},
+	}
+	r := counterRates(prev, cur)
+	// 总计 100：user 30、system 10、idle 50、iowait 10
+	if r["cpu.user_pct"] != 30 || r["cpu.iowait_pct"] != 10 || r["cpu.util_pct"] != 40 {
+		t.Fatalf("cpu=%v", r)
+	}
+	if r["disk.read_bps:sda"] != 1000 || r["disk.write_bps:sda"] != 500 || r["disk.read_iops:sda"] != 5 || r["disk.util_pct:sda"] != 50 {
+		t.Fatalf("disk=%v", r)
+	}
+	// 计数回绕（网卡重建）时跳过
+	if _, ok := r["net.rx_bps:eth0"]; ok {
+		t.Fatalf("net=%v", r)
+	}
+	if len(counterRates(nil, cur)) != 0 {
+		t.Fatalf("first sample should have no rates")
+	}
+}
+
+func TestMetricsAggregator(t *testing.T) {
+	a := NewMetricsAggregator(time.Minute)
+	base := time.Unix(1700000040, 0).Truncate(time.Minute)
+	if p := a.Add(base.Add(10*time.Second), MetricsSample{"load.1": 1, "cpu.util_pct": 10}); p != nil {
+		t.Fatalf("unexpected point %+v", p)
+	}
+	a.Add(base.Add(20*time.Second), MetricsSample{"load.1": 2})
+	a.Add(base.Add(30*time.Second), MetricsSample{"load.1": 4, "cpu.util_pct": 30})
+
+	p := a.Add(base.Add(70*time.Second), MetricsSample{"load.1": 8})
+	if p == nil || p.Time != base.Unix() || p.Samples != 3 {
+		t.Fatalf("point=%+v", p)
+	}
+	if p.Avg["load.1"] != 2.33 || p.Max["load.1"] != 4 || p.Avg["cpu.util_pct"] != 20 || p.Max["cpu.util_pct"] != 30 {
+		t.Fatalf("point=%+v", p)
+	}
+	p = a.Flush()
+	if p == nil || p.Time != base.Add(time.Minute).Unix() || p.Avg["load.1"] != 8 {
+		t.Fatalf("flush=%+v", p)
+	}
+	if a.Flush() != nil {
+		t.Fatalf("empty window should flush nil")
+	}
+}
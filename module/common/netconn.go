@@ -0,0 +1,164 @@
+package common
+
+import (
+	"sort"
+	"strconv"
+	"syscall"
+
+	utilnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// 连接方向（ConnSummary.Direction）
+const (
+	ConnInbound  = "in"  // 对端连入本机监听端口
+	ConnOutbound = "out" // 本机主动连出
+)
+
+// NetworkInfo 监听端口与已建立连接汇总
+type NetworkInfo struct {
+	Listening   []ListenSocket `json:"listening"`
+	Established []ConnSummary  `json:"established"`
+	// TotalEstablished 已建立连接总数；汇总条目超过上限时 Truncated=true，只保留连接数最多的条目
+	TotalEstablished int  `json:"totalEstablished"`
+	Truncated        bool `json:"truncated,omitempty"`
+}
+
+// ListenSocket 监听中的 TCP 套接字或未连接的 UDP 套接字
+type ListenSocket struct {
+	Proto string `json:"proto"` // tcp/tcp6/udp/udp6
+	IP    string `json:"ip"`
+	Port  uint32 `json:"port"`
+	ProcessRef
+}
+
+// ConnSummary 按方向、对端地址、服务端口与进程聚合的已建立连接。
+// 入向连接的服务端口为本机端口，出向连接为对端端口
+type ConnSummary struct {
+	Proto     string `json:"proto"`
+	Direction string `json:"direction"`
+	RemoteIP  string `json:"remoteIp"`
+	Port      uint32 `json:"port"`
+	Count     int    `json:"count"`
+	ProcessRef
+}
+
+// ProcessRef 套接字所属进程；无权限或进程已退出时只有 Pid
+type ProcessRef struct {
+	Pid     int32  `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+	User    string `json:"user,omitempty"`
+	Exe     string `json:"exe,omitempty"`
+}
+
+// GetNetworkInfo 采集监听端口与已建立连接，maxSummaries<=0 表示不限制汇总条目数
+func GetNetworkInfo(maxSummaries int) (*NetworkInfo, error) {
+	conns, err := utilnet.Connections("inet")
+	if err != nil {
+		return nil, err
+	}
+	return summarizeConnections(conns, newProcessResolver().Resolve, maxSummaries), nil
+}
+
+// processResolver 单次采集内按 pid 缓存进程信息
+type processResolver map[int32]ProcessRef
+
+func newProcessResolver() processResolver { return make(processResolver) }
+
+func (r processResolver) Resolve(pid int32) ProcessRef {
+	if pid <= 0 {
+		return ProcessRef{}
+	}
+	if ref, ok := r[pid]; ok {
+		return ref
+	}
+	ref := ProcessRef{Pid: pid}
+	if p, err := process.NewProcess(pid); err == nil {
+		ref.Process, _ = p.Name()
+		ref.User, _ = p.Username()
+		ref.Exe, _ = p.Exe()
+	}
+	r[pid] = ref
+	return ref
+}
+
+func connProto(c utilnet.ConnectionStat) string {
+	proto := "tcp"
+	if c.Type == syscall.SOCK_DGRAM {
+		proto = "udp"
+	}
+	if c.Family == syscall.AF_INET6 {
+		proto += "6"
+	}
+	return proto
+}
+
+func summarizeConnections(conns []utilnet.ConnectionStat, resolve func(int32) ProcessRef, maxSummaries int) *NetworkInfo {
+	info := &NetworkInfo{Listening: []ListenSocket{}, Established: []ConnSummary{}}
+
+	listenPorts := make(map[string]bool) // proto/port
+	for _, c := range conns {
+		proto := connProto(c)
+		tcpListen := c.Type == syscall.SOCK_STREAM && c.Status == "LISTEN"
+		udpBound := c.Type == syscall.SOCK_DGRAM && c.Raddr.IP == "" && c.Laddr.Port != 0
+		if !tcpListen && !udpBound {
+			continue
+		}
+		info.Listening = append(info.Listening, ListenSocket{Proto: proto, IP: c.Laddr.IP, Port: c.Laddr.Port, ProcessRef: resolve(c.Pid)})
+		listenPorts[proto+"/"+strconv.Itoa(int(c.Laddr.Port))] = true
+	}
+	sort.Slice(info.Listening, func(i, j int) bool {
+		a, b := info.Listening[i], info.Listening[j]
+		if a.Proto != b.Proto {
+			return a.Proto < b.Proto
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.IP < b.IP
+	})
+
+	type key struct {
+		proto, dir, ip string
+		port           uint32
+		pid            int32
+	}
+	counts := make(map[key]int)
+	for _, c := range conns {
+		if c.Type != syscall.SOCK_STREAM || c.Status != "ESTABLISHED" {
+			continue
+		}
+		info.TotalEstablished++
+		proto := connProto(c)
+		k := key{proto: proto, dir: ConnOutbound, ip: c.Raddr.IP, port: c.Raddr.Port, pid: c.Pid}
+		if listenPorts[proto+"/"+strconv.Itoa(int(c.Laddr.Port))] {
+			k.dir, k.port = ConnInbound, c.Laddr.Port
+		}
+		counts[k]++
+	}
+	for k, n := range counts {
+		info.Established = append(info.Established, ConnSummary{
+			Proto: k.proto, Direction: k.dir, RemoteIP: k.ip, Port: k.port, Count: n, ProcessRef: resolve(k.pid),
+		})
+	}
+	sort.Slice(info.Established, func(i, j int) bool {
+		a, b := info.Established[i], info.Established[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Proto != b.Proto || a.Direction != b.Direction {
+			return a.Proto+a.Direction < b.Proto+b.Direction
+		}
+		if a.RemoteIP != b.RemoteIP {
+			return a.RemoteIP < b.RemoteIP
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Pid < b.Pid
+	})
+	if maxSummaries > 0 && len(info.Established) > maxSummaries {
+		info.Established, info.Truncated = info.Established[:maxSummaries], true
+	}
+	return info
+}
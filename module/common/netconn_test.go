@@ -0,0 +1,49 @@
+package common
+
+import (
+	"syscall"
+	"testing"
+
+	utilnet "github.com/shirou/gopsutil/net"
+)
+
+func TestSummarizeConnections(t *testing.T) {
+	tcp := func(l, r utilnet.Addr, status string, pid int32) utilnet.ConnectionStat {
+		return utilnet.ConnectionStat{Family: syscall.AF_INET, Type: syscall.SOCK_STREAM, Laddr: l, Raddr: r, Status: status, Pid: pid}
+	}
+	conns := []utilnet.ConnectionStat{
+		tcp(utilnet.Addr{IP: "0.0.0.0", Port: 22}, utilnet.Addr{}, "LISTEN", 100),
+		tcp(utilnet.Addr{IP: "10.0.0.5", Port: 22}, utilnet.Addr{IP: "10.0.0.9", Port: 51000}, "ESTABLISHED", 100),
+		tcp(utilnet.Addr{IP: "10.0.0.5", Port: 22}, utilnet.Addr{IP: "10.0.0.9", Port: 51001}, "ESTABLISHED", 100),
+		tcp(utilnet.Addr{IP: "10.0.0.5", Port: 40000}, utilnet.Addr{IP: "10.0.0.20", Port: 3306}, "ESTABLISHED", 200),
+		tcp(utilnet.Addr{IP: "10.0.0.5", Port: 40001}, utilnet.Addr{IP: "10.0.0.20", Port: 3306}, "TIME_WAIT", 0),
+		{Family: syscall.AF_INET6, Type: syscall.SOCK_DGRAM, Laddr: utilnet.Addr{IP: "::", Port: 53}, Pid: 300},
+		// 已连接的 UDP 套接字不是监听端口
+		{Family: syscall.AF_INET, Type: syscall.SOCK_DGRAM, Laddr: utilnet.Addr{IP: "10.0.0.5", Port: 45000}, Raddr: utilnet.Addr{IP: "10.0.0.1", Port: 53}},
+	}
+	resolved := 0
+	resolve := func(pid int32) ProcessRef {
+		resolved++
+		return ProcessRef{Pid: pid, Process: map[int32]string{100: "sshd", 200: "app", 300: "dnsmasq"}[pid]}
+	}
+
+	info := summarizeConnections(conns, resolve, 0)
+	if len(info.Listening) != 2 || info.Listening[0].Proto != "tcp" || info.Listening[0].Process != "sshd" ||
+		info.Listening[1].Proto != "udp6" || info.Listening[1].Port != 53 {
+		t.Fatalf("listening=%+v", info.Listening)
+	}
+	if info.TotalEstablished != 3 || len(info.Established) != 2 {
+		t.Fatalf("established=%+v", info.Established)
+	}
+	in, out := info.Established[0], info.Established[1]
+	if in.Direction != ConnInbound || in.Port != 22 || in.Count != 2 || in.RemoteIP != "10.0.0.9" {
+		t.Fatalf("inbound=%+v", in)
+	}
+	if out.Direction != ConnOutbound || out.Port != 3306 || out.Process != "app" {
+		t.Fatalf("outbound=%+v", out)
+	}
+
+	if info := summarizeConnections(conns, resolve, 1); len(info.Established) != 1 || !info.Truncated {
+		t.Fatalf("expected truncation, got %+v", info)
+	}
+}
@@ -0,0 +1,232 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 软件包来源
+const (
+	PackageSourceDpkg = "dpkg"
+	PackageSourceRpm  = "rpm"
+)
+
+const (
+	dpkgStatusFile = "/var/lib/dpkg/status"
+	rpmQueryFormat = `%{NAME}\t%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\t%{ARCH}\n`
+	rpmTimeout     = time.Minute
+)
+
+// Package 已安装的软件包
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"` // deb: [epoch:]upstream[-revision]；rpm: [epoch:]version-release
+	Arch    string `json:"arch"`
+}
+
+// GetInstalledPackages 读取本机已安装软件包：dpkg 直接解析 status 文件，
+// rpm 数据库格式（BDB/NDB/sqlite）因版本而异，通过 rpm -qa 查询
+func GetInstalledPackages() (string, []Package, error) {
+	if _, err := os.Stat(dpkgStatusFile); err == nil {
+		f, err := os.Open(dpkgStatusFile)
+		if err != nil {
+			return PackageSourceDpkg, nil, err
+		}
+		defer f.Close()
+		pkgs, err := ParseDpkgStatus(f)
+		return PackageSourceDpkg, pkgs, err
+	}
+	if _, err := exec.LookPath("rpm"); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), rpmTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "rpm", "-qa", "--queryformat", rpmQueryFormat).Output()
+		if err != nil {
+			return PackageSourceRpm, nil, fmt.Errorf("rpm -qa: %w", err)
+		}
+		return PackageSourceRpm, ParseRpmQuery(out), nil
+	}
+	return "", nil, fmt.Errorf("no supported package database found")
+}
+
+// ParseDpkgStatus 解析 dpkg status 文件，只返回状态为 installed 的包
+func ParseDpkgStatus(r io.Reader) ([]Package, error) {
+	var (
+		out    []Package
+		cur    Package
+		status string
+	)
+	flush := func() {
+		// Status: <want> <flag> <status>
+		if f := strings.Fields(status); cur.Name != "" && len(f) == 3 && f[2] == "installed" {
+			out = append(out, cur)
+		}
+		cur, status = Package{}, ""
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		// 多行字段的续行
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "Package":
+			cur.Name = v
+		case "Version":
+			cur.Version = v
+		case "Architecture":
+			cur.Arch = v
+		case "Status":
+			status = v
+		}
+	}
+	flush()
+	sortPackages(out)
+	return out, sc.Err()
+}
+
+// ParseRpmQuery 解析 rpm -qa --queryformat rpmQueryFormat 的输出
+func ParseRpmQuery(out []byte) []Package {
+	var pkgs []Package
+	for _, line := range bytes.Split(out, []byte{'\n'}) {
+		f := strings.Split(string(line), "\t")
+		if len(f) != 3 || f[0] == "" {
+			continue
+		}
+		// 导入的 GPG 公钥以软件包形式存在
+		if f[0] == "gpg-pubkey" {
+			continue
+		}
+		pkgs = append(pkgs, Package{Name: f[0], Version: f[1], Arch: f[2]})
+	}
+	sortPackages(pkgs)
+	return pkgs
+}
+
+func sortPackages(pkgs []Package) {
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		if pkgs[i].Arch != pkgs[j].Arch {
+			return pkgs[i].Arch < pkgs[j].Arch
+		}
+		return CompareVersions(pkgs[i].Version, pkgs[j].Version) < 0
+	})
+}
+
+// CompareVersions 按 dpkg 规则比较 [epoch:]upstream[-revision]，返回 -1/0/1。
+// rpm 的 [epoch:]version-release 结构相同，除少数边界情况外结果一致
+func CompareVersions(a, b string) int {
+	ea, ua, ra := splitVersion(a)
+	eb, ub, rb := splitVersion(b)
+	if ea != eb {
+		if ea < eb {
+			return -1
+		}
+		return 1
+	}
+	if c := verrevcmp(ua, ub); c != 0 {
+		return c
+	}
+	return verrevcmp(ra, rb)
+}
+
+func splitVersion(v string) (epoch int, upstream, revision string) {
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		epoch, _ = strconv.Atoi(e)
+		v = rest
+	}
+	if i := strings.LastIndexByte(v, '-'); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// verOrder 非数字字符的排序权重：'~' 最小（低于空），字母次之，其他符号最大
+func verOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func verrevcmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := verOrder(a, i), verOrder(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDpkgStatus(t *testing.T) {
+	in := `Package: bash
+Status: install ok installed
+Priority: required
+Architecture: amd64
+Version: 5.1-6ubuntu1
+Description: GNU Bourne Again SHell
+ Bash is an sh-compatible command language interpreter.
+ .
+ multi-line description
+
+Package: old-lib
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0-1
+
+Package: libc6
+Status: hold ok installed
+Architecture: i386
+Version: 2.35-0ubuntu3.1
+`
+	pkgs, err := ParseDpkgStatus(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[0] != (Package{Name: "bash", Version: "5.1-6ubuntu1", Arch: "amd64"}) || pkgs[1].Name != "libc6" || pkgs[1].Arch != "i386" {
+		t.Fatalf("pkgs=%+v", pkgs)
+	}
+}
+
+func TestParseRpmQuery(t *testing.T) {
+	out := []byte("kernel\t5.14.0-362.el9\tx86_64\nkernel\t5.14.0-70.el9\tx86_64\ngpg-pubkey\tfd431d51-4ae0493b\t(none)\nopenssl\t1:3.0.7-24.el9\tx86_64\n\n")
+	pkgs := ParseRpmQuery(out)
+	if len(pkgs) != 3 {
+		t.Fatalf("pkgs=%+v", pkgs)
+	}
+	// 同名同架构按版本排序
+	if pkgs[0].Version != "5.14.0-70.el9" || pkgs[1].Version != "5.14.0-362.el9" || pkgs[2].Version != "1:3.0.7-24.el9" {
+		t.Fatalf("pkgs=%+v", pkgs)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0", "1.0+b1", -1},
+		{"1:1.0", "2.0", 1},
+		{"2.35-0ubuntu3.1", "2.35-0ubuntu3", 1},
+		{"5.14.0-362.el9", "5.14.0-70.el9", 1},
+		{"1.001", "1.1", 0},
+		{"1.0a", "1.0", 1},
+	} {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%q, %q)=%d want %d", c.a, c.b, got, c.want)
+		}
+		if got := CompareVersions(c.b, c.a); got != -c.want {
+			t.Errorf("CompareVersions(%q, %q)=%d want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
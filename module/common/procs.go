@@ -0,0 +1,162 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// ProcessInfo 进程采样结果
+type ProcessInfo struct {
+	Pid        int32   `json:"pid"`
+	Ppid       int32   `json:"ppid"`
+	User       string  `json:"user"`
+	Name       string  `json:"name"`
+	Cmdline    string  `json:"cmdline"`
+	StartTime  int64   `json:"startTime"`  // unix 毫秒
+	CPUPercent float64 `json:"cpuPercent"` // 相对单核，上次采样以来的平均值（首次采样为启动以来平均值）
+	RSS        uint64  `json:"rss"`
+	NumFDs     int32   `json:"numFds"`
+	Cgroup     string  `json:"cgroup,omitempty"`
+}
+
+// 进程排序字段
+const (
+	ProcessSortCPU = "cpu"
+	ProcessSortMem = "mem"
+	ProcessSortPid = "pid"
+)
+
+type cpuSample struct {
+	start int64   // 进程启动时间，用于识别 pid 复用
+	total float64 // 累计 CPU 秒数
+	at    time.Time
+}
+
+// ProcessSampler 在两次采样之间计算各进程的 CPU 使用率
+type ProcessSampler struct {
+	mu   sync.Mutex
+	prev map[int32]cpuSample
+}
+
+func NewProcessSampler() *ProcessSampler {
+	return &ProcessSampler{prev: make(map[int32]cpuSample)}
+}
+
+// Sample 采集全部进程；无权限读取的字段留空
+func (s *ProcessSampler) Sample() ([]ProcessInfo, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make(map[int32]cpuSample, len(procs))
+	out := make([]ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		info := ProcessInfo{Pid: p.Pid}
+		// 进程可能在采样期间退出
+		start, err := p.CreateTime()
+		if err != nil {
+			continue
+		}
+		info.StartTime = start
+		info.Ppid, _ = p.Ppid()
+		info.User, _ = p.Username()
+		info.Name, _ = p.Name()
+		info.Cmdline, _ = p.Cmdline()
+		if mi, err := p.MemoryInfo(); err == nil {
+			info.RSS = mi.RSS
+		}
+		info.NumFDs, _ = p.NumFDs()
+		info.Cgroup = readProcCgroup(fmt.Sprintf("/proc/%d/cgroup", p.Pid))
+
+		if t, err := p.Times(); err == nil {
+			cur := cpuSample{start: start, total: t.User + t.System, at: now}
+			info.CPUPercent = cpuPercent(s.prev[p.Pid], cur)
+			next[p.Pid] = cur
+		}
+		out = append(out, info)
+	}
+	s.prev = next
+	return out, nil
+}
+
+// cpuPercent 与上次采样比较；没有可用的上次采样时按启动以来的平均值计算
+func cpuPercent(prev, cur cpuSample) float64 {
+	var busy, wall float64
+	if prev.at.IsZero() || prev.start != cur.start {
+		busy, wall = cur.total, cur.at.Sub(time.UnixMilli(cur.start)).Seconds()
+	} else {
+		busy, wall = cur.total-prev.total, cur.at.Sub(prev.at).Seconds()
+	}
+	if wall <= 0 || busy < 0 {
+		return 0
+	}
+	return float64(int64(busy/wall*10000)) / 100
+}
+
+// readProcCgroup cgroup v2 返回统一层级路径，v1 优先返回 memory/cpu 控制器路径
+func readProcCgroup(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var v1 string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if (c == "memory" || c == "cpu") && v1 == "" {
+				v1 = parts[2]
+			}
+		}
+	}
+	return v1
+}
+
+// SortProcesses 按字段降序排序（pid 为升序）
+func SortProcesses(procs []ProcessInfo, by string) {
+	sort.SliceStable(procs, func(i, j int) bool {
+		a, b := procs[i], procs[j]
+		switch by {
+		case ProcessSortCPU:
+			if a.CPUPercent != b.CPUPercent {
+				return a.CPUPercent > b.CPUPercent
+			}
+		case ProcessSortMem:
+			if a.RSS != b.RSS {
+				return a.RSS > b.RSS
+			}
+		}
+		return a.Pid < b.Pid
+	})
+}
+
+// TopProcesses 返回按字段排序后的前 n 个（不修改 procs）
+func TopProcesses(procs []ProcessInfo, by string, n int) []ProcessInfo {
+	cp := append([]ProcessInfo(nil), procs...)
+	SortProcesses(cp, by)
+	if n > 0 && len(cp) > n {
+		cp = cp[:n]
+	}
+	return cp
+}
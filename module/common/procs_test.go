@@ -0,0 +1,74 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCPUPercent(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	// 首次采样：启动 100s，累计 50s CPU
+	cur := cpuSample{start: start.UnixMilli(), total: 50, at: start.Add(100 * time.Second)}
+	if got := cpuPercent(cpuSample{}, cur); got != 50 {
+		t.Fatalf("got=%v", got)
+	}
+	// 10s 内消耗 15s CPU（多线程）
+	next := cpuSample{start: cur.start, total: 65, at: cur.at.Add(10 * time.Second)}
+	if got := cpuPercent(cur, next); got != 150 {
+		t.Fatalf("got=%v", got)
+	}
+	// pid 复用：忽略上次采样
+	reused := cpuSample{start: next.at.UnixMilli() - 2000, total: 1, at: next.at}
+	if got := cpuPercent(cur, reused); got != 50 {
+		t.Fatalf("got=%v", got)
+	}
+}
+
+func TestReadProcCgroup(t *testing.T) {
+	dir := t.TempDir()
+	v2 := filepath.Join(dir, "v2")
+	v1 := filepath.Join(dir, "v1")
+	_ = os.WriteFile(v2, []byte("0::/system.slice/nginx.service\n"), 0o644)
+	_ = os.WriteFile(v1, []byte("12:pids:/user.slice\n4:cpu,cpuacct:/docker/abc\n3:memory:/docker/abc\n1:name=systemd:/docker/abc\n"), 0o644)
+	if got := readProcCgroup(v2); got != "/system.slice/nginx.service" {
+		t.Fatalf("v2=%q", got)
+	}
+	if got := readProcCgroup(v1); got != "/docker/abc" {
+		t.Fatalf("v1=%q", got)
+	}
+}
+
+func TestTopProcesses(t *testing.T) {
+	procs := []ProcessInfo{
+		{Pid: 1, CPUPercent: 1, RSS: 300},
+		{Pid: 2, CPUPercent: 90, RSS: 100},
+		{Pid: 3, CPUPercent: 5, RSS: 900},
+	}
+	if top := TopProcesses(procs, ProcessSortCPU, 2); len(top) != 2 || top[0].Pid != 2 || top[1].Pid != 3 {
+		t.Fatalf("cpu top=%+v", top)
+	}
+	if top := TopProcesses(procs, ProcessSortMem, 1); top[0].Pid != 3 {
+		t.Fatalf("mem top=%+v", top)
+	}
+	if procs[0].Pid != 1 {
+		t.Fatalf("input should not be reordered")
+	}
+}
+
+func TestProcessSampler_Self(t *testing.T) {
+	procs, err := NewProcessSampler().Sample()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, p := range procs {
+		if p.Pid == int32(os.Getpid()) {
+			if p.RSS == 0 || p.StartTime == 0 || p.Cmdline == "" {
+				t.Fatalf("self=%+v", p)
+			}
+			return
+		}
+	}
+	t.Fatalf("current process not found in %d processes", len(procs))
+}
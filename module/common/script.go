@@ -0,0 +1,115 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+// 脚本解释器
+const (
+	InterpreterBash    = "bash"
+	InterpreterSh      = "sh"
+	InterpreterPython3 = "python3"
+	InterpreterShebang = "shebang" // 直接执行脚本文件，由首行 #! 决定解释器
+)
+
+// ScriptSpec 脚本任务内容（随 CmdExtra 下发）
+type ScriptSpec struct {
+	Interpreter string `json:"interpreter"` // bash/sh/python3/shebang，默认 bash
+	Body        string `json:"body"`        // 脚本内容
+}
+
+// Script 已落盘的脚本
+type Script struct {
+	Path        string
+	SHA256      string
+	Interpreter string
+}
+
+// WriteScript 将脚本内容写入私有临时文件（0700），并按 cred 修改属主。
+// cred 为 nil 时属主为当前用户。调用方负责 Cleanup。
+func WriteScript(spec *ScriptSpec, cred *syscall.Credential) (*Script, error) {
+	return WriteScriptIn(viper.GetString("Cmd.ScriptDir"), spec, cred)
+}
+
+// WriteScriptIn 同 WriteScript，写入指定目录（空表示系统临时目录）
+func WriteScriptIn(dir string, spec *ScriptSpec, cred *syscall.Credential) (*Script, error) {
+	if spec == nil || strings.TrimSpace(spec.Body) == "" {
+		return nil, fmt.Errorf("empty script body")
+	}
+
+	interp := strings.ToLower(strings.TrimSpace(spec.Interpreter))
+	if interp == "" {
+		interp = InterpreterBash
+	}
+	switch interp {
+	case InterpreterBash, InterpreterSh, InterpreterPython3:
+	case InterpreterShebang:
+		if !strings.HasPrefix(spec.Body, "#!") {
+			return nil, fmt.Errorf("shebang interpreter requires script starting with #!")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported interpreter %q", spec.Interpreter)
+	}
+
+	f, err := os.CreateTemp(dir, "x-agent-script-*")
+	if err != nil {
+		return nil, fmt.Errorf("create script: %w", err)
+	}
+	path := f.Name()
+
+	fail := func(err error) (*Script, error) {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	// CreateTemp 默认 0600，需执行权限以支持 shebang 方式
+	if err := f.Chmod(0o700); err != nil {
+		return fail(fmt.Errorf("chmod script: %w", err))
+	}
+	if cred != nil {
+		if err := f.Chown(int(cred.Uid), int(cred.Gid)); err != nil {
+			return fail(fmt.Errorf("chown script: %w", err))
+		}
+	}
+	if _, err := f.WriteString(spec.Body); err != nil {
+		return fail(fmt.Errorf("write script: %w", err))
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("close script: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(spec.Body))
+	return &Script{
+		Path:        path,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Interpreter: interp,
+	}, nil
+}
+
+// Command 返回执行脚本所需的命令名与参数，args 追加在脚本路径之后。
+func (s *Script) Command(args []string) (string, []string) {
+	if s.Interpreter == InterpreterShebang {
+		return s.Path, args
+	}
+	return s.Interpreter, append([]string{s.Path}, args...)
+}
+
+// Cleanup 删除脚本文件（幂等）
+func (s *Script) Cleanup() error {
+	if s == nil || s.Path == "" {
+		return nil
+	}
+	if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
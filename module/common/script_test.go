@@ -0,0 +1,80 @@
+package common
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWriteScript_PrivateFileAndCleanup(t *testing.T) {
+	defer setupViperForCmdTests()()
+	viper.Set("Cmd.ScriptDir", t.TempDir())
+
+	s, err := WriteScript(&ScriptSpec{Body: "echo hi\n"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if fi.Mode().Perm() != 0o700 {
+		t.Fatalf("expected mode 0700, got=%v", fi.Mode().Perm())
+	}
+	if s.Interpreter != InterpreterBash || len(s.SHA256) != 64 {
+		t.Fatalf("unexpected script meta: %+v", s)
+	}
+
+	if err := s.Cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if _, err := os.Stat(s.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected script removed, err=%v", err)
+	}
+	// 幂等
+	if err := s.Cleanup(); err != nil {
+		t.Fatalf("second cleanup: %v", err)
+	}
+}
+
+func TestWriteScript_Rejects(t *testing.T) {
+	defer setupViperForCmdTests()()
+	viper.Set("Cmd.ScriptDir", t.TempDir())
+
+	if _, err := WriteScript(&ScriptSpec{Body: "  "}, nil); err == nil {
+		t.Fatalf("expected error for empty body")
+	}
+	if _, err := WriteScript(&ScriptSpec{Interpreter: "perl", Body: "print 1"}, nil); err == nil {
+		t.Fatalf("expected error for unsupported interpreter")
+	}
+	if _, err := WriteScript(&ScriptSpec{Interpreter: "shebang", Body: "echo 1"}, nil); err == nil {
+		t.Fatalf("expected error for missing shebang")
+	}
+}
+
+func TestScript_CommandRuns(t *testing.T) {
+	defer setupViperForCmdTests()()
+	viper.Set("Cmd.ScriptDir", t.TempDir())
+
+	for _, spec := range []ScriptSpec{
+		{Interpreter: "sh", Body: "echo \"$1\"\n"},
+		{Interpreter: "shebang", Body: "#!/bin/sh\necho \"$1\"\n"},
+	} {
+		s, err := WriteScript(&spec, nil)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		name, args := s.Command([]string{"arg1"})
+		out, err := exec.Command(name, args...).CombinedOutput()
+		_ = s.Cleanup()
+		if err != nil {
+			t.Fatalf("%s: run failed: %v, out=%s", spec.Interpreter, err, out)
+		}
+		if strings.TrimSpace(string(out)) != "arg1" {
+			t.Fatalf("%s: unexpected output %q", spec.Interpreter, out)
+		}
+	}
+}
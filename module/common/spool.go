@@ -0,0 +1,292 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 落盘的输出流
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Spool 任务输出落盘目录：<dir>/<task_id>/{stdout,stderr}。
+// 目录总大小受 maxBytes 限制（按最近访问时间淘汰），超过 ttl 未访问的任务直接删除；
+// 仍在写入（未 Finish）的任务目录不参与淘汰。
+type Spool struct {
+	dir         string
+	maxBytes    int64
+	maxTaskSize int64
+	ttl         time.Duration
+
+	mu     sync.Mutex     // 串行化创建与淘汰
+	active map[string]int // 正在写入的任务目录
+}
+
+// NewSpool 创建落盘目录，dir 为空表示禁用（返回 nil）
+func NewSpool(dir string, maxBytes, maxTaskSize int64, ttl time.Duration) (*Spool, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("mkdir spool: %w", err)
+	}
+	return &Spool{dir: dir, maxBytes: maxBytes, maxTaskSize: maxTaskSize, ttl: ttl, active: map[string]int{}}, nil
+}
+
+// taskDir 校验 task id，防止路径穿越
+func (s *Spool) taskDir(taskID string) (string, error) {
+	if taskID == "" || taskID == "." || taskID == ".." || strings.ContainsAny(taskID, `/\`) {
+		return "", fmt.Errorf("invalid task id %q", taskID)
+	}
+	return filepath.Join(s.dir, taskID), nil
+}
+
+// Create 为任务创建落盘文件，调用方结束后必须 Finish
+func (s *Spool) Create(taskID string) (*SpoolWriter, error) {
+	if s == nil {
+		return nil, nil
+	}
+	dir, err := s.taskDir(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictLocked()
+	// 同一任务重复执行时覆盖旧输出
+	_ = os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("mkdir task spool: %w", err)
+	}
+
+	w := &SpoolWriter{sp: s, dir: dir}
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		f, err := os.OpenFile(filepath.Join(dir, stream), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			w.close()
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("create %s spool: %w", stream, err)
+		}
+		sf := &spoolFile{f: f, max: s.maxTaskSize}
+		if stream == StreamStdout {
+			w.stdout = sf
+		} else {
+			w.stderr = sf
+		}
+	}
+	s.active[dir]++
+	return w, nil
+}
+
+// release 任务写入结束，目录重新参与淘汰
+func (s *Spool) release(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[dir]--; s.active[dir] <= 0 {
+		delete(s.active, dir)
+	}
+}
+
+// Read 读取任务输出 [offset, offset+length)，length<=0 表示读到末尾。返回数据与文件总大小。
+func (s *Spool) Read(taskID, stream string, offset, length int64) ([]byte, int64, error) {
+	if s == nil {
+		return nil, 0, fmt.Errorf("spool disabled")
+	}
+	if stream != StreamStdout && stream != StreamStderr {
+		return nil, 0, fmt.Errorf("invalid stream %q", stream)
+	}
+	dir, err := s.taskDir(taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, stream))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := fi.Size()
+	if offset < 0 || offset > size {
+		return nil, size, fmt.Errorf("offset %d out of range [0, %d]", offset, size)
+	}
+	if length <= 0 || offset+length > size {
+		length = size - offset
+	}
+
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, size, err
+	}
+
+	// 访问即刷新，作为 LRU 依据
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+	return buf, size, nil
+}
+
+// Evict 执行一次 TTL/容量淘汰，由调用方周期调用（Create 时也会执行）
+func (s *Spool) Evict() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictLocked()
+}
+
+type spoolEntry struct {
+	path  string
+	mtime time.Time
+	size  int64
+}
+
+func (s *Spool) evictLocked() {
+	des, err := os.ReadDir(s.dir)
+	if err != nil {
+		logrus.WithError(err).Warn("Spool: read dir failed")
+		return
+	}
+
+	var (
+		entries []spoolEntry
+		total   int64
+	)
+	for _, de := range des {
+		if !de.IsDir() {
+			continue
+		}
+		p := filepath.Join(s.dir, de.Name())
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		if s.active[p] > 0 {
+			// 正在写入的任务只计入总大小，不淘汰
+			total += dirSize(p)
+			continue
+		}
+		if s.ttl > 0 && time.Since(fi.ModTime()) > s.ttl {
+			_ = os.RemoveAll(p)
+			logrus.WithField("task_id", de.Name()).Debug("Spool: evict expired")
+			continue
+		}
+		e := spoolEntry{path: p, mtime: fi.ModTime(), size: dirSize(p)}
+		entries = append(entries, e)
+		total += e.size
+	}
+
+	if s.maxBytes <= 0 || total <= s.maxBytes {
+		return
+	}
+	// 最久未访问的先淘汰
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mtime.Before(entries[j].mtime) })
+	for _, e := range entries {
+		if total <= s.maxBytes {
+			break
+		}
+		_ = os.RemoveAll(e.path)
+		total -= e.size
+		logrus.WithField("task_id", filepath.Base(e.path)).Debug("Spool: evict lru")
+	}
+}
+
+func dirSize(dir string) int64 {
+	var n int64
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	for _, de := range des {
+		if fi, err := de.Info(); err == nil && !fi.IsDir() {
+			n += fi.Size()
+		}
+	}
+	return n
+}
+
+// SpoolWriter 单个任务的落盘文件
+type SpoolWriter struct {
+	sp     *Spool
+	dir    string
+	stdout *spoolFile
+	stderr *spoolFile
+}
+
+// Stdout 返回 stdout 落盘 Writer（w 为 nil 时返回 nil）
+func (w *SpoolWriter) Stdout() io.Writer {
+	if w == nil {
+		return nil
+	}
+	return w.stdout
+}
+
+// Stderr 返回 stderr 落盘 Writer（w 为 nil 时返回 nil）
+func (w *SpoolWriter) Stderr() io.Writer {
+	if w == nil {
+		return nil
+	}
+	return w.stderr
+}
+
+// Finish 关闭文件；输出未超过 inline 上限时（已完整回传）删除落盘文件，返回是否保留。
+func (w *SpoolWriter) Finish(inlineLimit int64) bool {
+	if w == nil {
+		return false
+	}
+	w.close()
+	defer w.sp.release(w.dir)
+	if w.stdout.n <= inlineLimit && w.stderr.n <= inlineLimit {
+		_ = os.RemoveAll(w.dir)
+		return false
+	}
+	return true
+}
+
+func (w *SpoolWriter) close() {
+	for _, f := range []*spoolFile{w.stdout, w.stderr} {
+		if f != nil && f.f != nil {
+			_ = f.f.Close()
+		}
+	}
+}
+
+// spoolFile 写入失败或超过单任务上限后静默丢弃，不影响任务本身的输出读取
+type spoolFile struct {
+	f   *os.File
+	n   int64 // 进程产生的字节数
+	max int64
+	err error
+}
+
+func (sf *spoolFile) Write(p []byte) (int, error) {
+	if sf.err == nil && (sf.max <= 0 || sf.n < sf.max) {
+		b := p
+		if sf.max > 0 && sf.n+int64(len(b)) > sf.max {
+			b = b[:sf.max-sf.n]
+		}
+		if _, err := sf.f.Write(b); err != nil {
+			sf.err = err
+			logrus.WithError(err).WithField("file", sf.f.Name()).Warn("Spool: write failed, stop spooling")
+		}
+	}
+	sf.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpool_WriteReadAndFinish(t *testing.T) {
+	sp, err := NewSpool(t.TempDir(), 0, 0, 0)
+	if err != nil {
+		t.Fatalf("new spool: %v", err)
+	}
+
+	w, err := sp.Create("task-1")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, _ = w.Stdout().Write([]byte("0123456789"))
+	_, _ = w.Stderr().Write([]byte("err"))
+	if !w.Finish(5) {
+		t.Fatalf("expected spool kept when output exceeds inline limit")
+	}
+
+	data, size, err := sp.Read("task-1", StreamStdout, 2, 3)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(data) != "234" || size != 10 {
+		t.Fatalf("unexpected range read data=%q size=%d", data, size)
+	}
+	data, _, err = sp.Read("task-1", StreamStdout, 8, 0)
+	if err != nil || string(data) != "89" {
+		t.Fatalf("expected tail read, got=%q err=%v", data, err)
+	}
+	if _, _, err := sp.Read("task-1", StreamStdout, 11, 0); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+
+	// 未超过上限时删除
+	w2, _ := sp.Create("task-2")
+	_, _ = w2.Stdout().Write([]byte("ok"))
+	if w2.Finish(5) {
+		t.Fatalf("expected small output not kept")
+	}
+	if _, _, err := sp.Read("task-2", StreamStdout, 0, 0); err == nil {
+		t.Fatalf("expected task-2 removed")
+	}
+}
+
+func TestSpool_RejectsBadTaskID(t *testing.T) {
+	sp, _ := NewSpool(t.TempDir(), 0, 0, 0)
+	for _, id := range []string{"", "..", "a/b", `..\x`} {
+		if _, err := sp.Create(id); err == nil {
+			t.Fatalf("expected error for task id %q", id)
+		}
+		if _, _, err := sp.Read(id, StreamStdout, 0, 0); err == nil {
+			t.Fatalf("expected read error for task id %q", id)
+		}
+	}
+}
+
+func TestSpool_MaxTaskBytes(t *testing.T) {
+	sp, _ := NewSpool(t.TempDir(), 0, 4, 0)
+	w, _ := sp.Create("t")
+	n, err := w.Stdout().Write([]byte("0123456789"))
+	if n != 10 || err != nil {
+		t.Fatalf("spool writer must not fail the producer, n=%d err=%v", n, err)
+	}
+	w.Finish(0)
+	data, size, _ := sp.Read("t", StreamStdout, 0, 0)
+	if string(data) != "0123" || size != 4 {
+		t.Fatalf("expected capped spool file, got=%q size=%d", data, size)
+	}
+}
+
+func TestSpool_EvictTTLAndLRU(t *testing.T) {
+	dir := t.TempDir()
+	sp, _ := NewSpool(dir, 15, 0, time.Hour)
+
+	mk := func(id string, size int, age time.Duration) {
+		w, err := sp.Create(id)
+		if err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+		_, _ = w.Stdout().Write(make([]byte, size))
+		w.Finish(0)
+		ts := time.Now().Add(-age)
+		_ = os.Chtimes(filepath.Join(dir, id), ts, ts)
+	}
+	mk("expired", 1, 2*time.Hour)
+	mk("old", 10, 30*time.Minute)
+	mk("new", 10, time.Minute)
+
+	sp.Evict()
+
+	for id, want := range map[string]bool{"expired": false, "old": false, "new": true} {
+		_, err := os.Stat(filepath.Join(dir, id))
+		if got := err == nil; got != want {
+			t.Fatalf("%s: expected exists=%v, got=%v", id, want, got)
+		}
+	}
+}
+
+func TestSpool_EvictSkipsActive(t *testing.T) {
+	dir := t.TempDir()
+	sp, _ := NewSpool(dir, 5, 0, time.Hour)
+
+	w, _ := sp.Create("running")
+	_, _ = w.Stdout().Write(make([]byte, 10))
+	ts := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(filepath.Join(dir, "running"), ts, ts)
+
+	// 超过 TTL 且超过容量，但任务仍在写入
+	sp.Evict()
+	if _, err := os.Stat(filepath.Join(dir, "running", StreamStdout)); err != nil {
+		t.Fatalf("active task dir evicted: %v", err)
+	}
+
+	if !w.Finish(0) {
+		t.Fatalf("expected spool kept")
+	}
+	sp.Evict()
+	if _, err := os.Stat(filepath.Join(dir, "running")); !os.IsNotExist(err) {
+		t.Fatalf("expected finished task evicted, err=%v", err)
+	}
+}
+
+func TestNewSpool_Disabled(t *testing.T) {
+	sp, err := NewSpool("  ", 0, 0, 0)
+	if sp != nil || err != nil {
+		t.Fatalf("expected disabled spool, got=%v err=%v", sp, err)
+	}
+	w, err := sp.Create("x")
+	if w != nil || err != nil || w.Stdout() != nil || w.Finish(0) {
+		t.Fatalf("nil spool should be a no-op")
+	}
+}
@@ -0,0 +1,226 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/sirupsen/logrus"
+)
+
+// StorageInfo OS 信息中的存储部分
+type StorageInfo struct {
+	Filesystems  []FilesystemInfo  `json:"filesystems"`
+	BlockDevices []BlockDeviceInfo `json:"blockDevices"`
+}
+
+// FilesystemInfo 已挂载文件系统
+type FilesystemInfo struct {
+	Device            string   `json:"device"`
+	Mountpoint        string   `json:"mountpoint"`
+	Fstype            string   `json:"fstype"`
+	Opts              []string `json:"opts"`
+	Total             uint64   `json:"total"`
+	Used              uint64   `json:"used"`
+	Free              uint64   `json:"free"`
+	UsedPercent       float64  `json:"usedPercent"`
+	InodesTotal       uint64   `json:"inodesTotal"`
+	InodesUsed        uint64   `json:"inodesUsed"`
+	InodesFree        uint64   `json:"inodesFree"`
+	InodesUsedPercent float64  `json:"inodesUsedPercent"`
+	// UsageError 获取用量失败（如 NFS 无响应）时的原因
+	UsageError string `json:"usageError,omitempty"`
+}
+
+// BlockDeviceInfo 块设备（磁盘、md、device-mapper）
+type BlockDeviceInfo struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"` // disk/md/dm/loop
+	Size       uint64          `json:"size"` // 字节
+	Model      string          `json:"model,omitempty"`
+	Serial     string          `json:"serial,omitempty"`
+	Vendor     string          `json:"vendor,omitempty"`
+	Rotational bool            `json:"rotational"`
+	Removable  bool            `json:"removable"`
+	Partitions []PartitionInfo `json:"partitions,omitempty"`
+	// Holders 以本设备为成员的 md/dm 设备
+	Holders []string `json:"holders,omitempty"`
+	// Slaves md/dm 设备的成员
+	Slaves []string `json:"slaves,omitempty"`
+	// DMName/DMUUID device-mapper 名称与 UUID（LVM 逻辑卷以 LVM- 开头）
+	DMName  string `json:"dmName,omitempty"`
+	DMUUID  string `json:"dmUuid,omitempty"`
+	MDLevel string `json:"mdLevel,omitempty"` // raid1/raid5 ...
+	LVM     bool   `json:"lvm,omitempty"`
+}
+
+// PartitionInfo 分区，Start/Size 为字节
+type PartitionInfo struct {
+	Name    string   `json:"name"`
+	Number  int      `json:"number"`
+	Start   uint64   `json:"start"`
+	Size    uint64   `json:"size"`
+	Holders []string `json:"holders,omitempty"`
+}
+
+// usageTimeout 单个挂载点 statfs 的最长等待时间，避免网络文件系统卡住采集
+const usageTimeout = 2 * time.Second
+
+// GetStorageInfo 采集文件系统与块设备
+func GetStorageInfo() *StorageInfo {
+	info := &StorageInfo{Filesystems: []FilesystemInfo{}, BlockDevices: []BlockDeviceInfo{}}
+
+	if parts, err := disk.Partitions(false); err == nil {
+		for _, p := range parts {
+			info.Filesystems = append(info.Filesystems, filesystemInfo(p))
+		}
+		sort.Slice(info.Filesystems, func(i, j int) bool {
+			return info.Filesystems[i].Mountpoint < info.Filesystems[j].Mountpoint
+		})
+	} else {
+		logrus.WithError(err).Warn("GetStorageInfo: disk.Partitions failed")
+	}
+
+	devs, err := ReadBlockDevices("/sys")
+	if err != nil {
+		logrus.WithError(err).Warn("GetStorageInfo: read block devices failed")
+	} else {
+		info.BlockDevices = devs
+	}
+	return info
+}
+
+func filesystemInfo(p disk.PartitionStat) FilesystemInfo {
+	fs := FilesystemInfo{
+		Device:     p.Device,
+		Mountpoint: p.Mountpoint,
+		Fstype:     p.Fstype,
+		Opts:       strings.Split(p.Opts, ","),
+	}
+	type result struct {
+		u   *disk.UsageStat
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		u, err := disk.Usage(p.Mountpoint)
+		ch <- result{u, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			fs.UsageError = r.err.Error()
+			break
+		}
+		fs.Total, fs.Used, fs.Free, fs.UsedPercent = r.u.Total, r.u.Used, r.u.Free, r.u.UsedPercent
+		fs.InodesTotal, fs.InodesUsed, fs.InodesFree, fs.InodesUsedPercent = r.u.InodesTotal, r.u.InodesUsed, r.u.InodesFree, r.u.InodesUsedPercent
+	case <-time.After(usageTimeout):
+		fs.UsageError = "statfs timeout"
+		logrus.WithField("mountpoint", p.Mountpoint).Warn("GetStorageInfo: statfs timeout")
+	}
+	return fs
+}
+
+// ReadBlockDevices 从 sysfs（sysRoot 通常为 /sys）读取块设备、分区布局与 md/dm 成员关系
+func ReadBlockDevices(sysRoot string) ([]BlockDeviceInfo, error) {
+	blockDir := filepath.Join(sysRoot, "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]BlockDeviceInfo, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		// ram/zram 等内存设备不属于存储清单
+		if strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		dir := filepath.Join(blockDir, name)
+		dev := BlockDeviceInfo{
+			Name:       name,
+			Type:       "disk",
+			Size:       readSysUint(dir, "size") * 512,
+			Model:      readSysString(dir, "device/model"),
+			Vendor:     readSysString(dir, "device/vendor"),
+			Serial:     readSysString(dir, "device/serial"),
+			Rotational: readSysString(dir, "queue/rotational") == "1",
+			Removable:  readSysString(dir, "removable") == "1",
+			Holders:    readSysDir(dir, "holders"),
+			Slaves:     readSysDir(dir, "slaves"),
+		}
+		if dev.Serial == "" {
+			dev.Serial = readSysString(dir, "serial")
+		}
+		switch {
+		case strings.HasPrefix(name, "loop"):
+			dev.Type = "loop"
+			// 未关联文件的 loop 设备
+			if dev.Size == 0 {
+				continue
+			}
+		case strings.HasPrefix(name, "dm-"):
+			dev.Type = "dm"
+			dev.DMName = readSysString(dir, "dm/name")
+			dev.DMUUID = readSysString(dir, "dm/uuid")
+			dev.LVM = strings.HasPrefix(dev.DMUUID, "LVM-")
+		case strings.HasPrefix(name, "md"):
+			dev.Type = "md"
+			dev.MDLevel = readSysString(dir, "md/level")
+		}
+
+		parts, _ := os.ReadDir(dir)
+		for _, p := range parts {
+			pdir := filepath.Join(dir, p.Name())
+			if !strings.HasPrefix(p.Name(), name) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(pdir, "partition")); err != nil {
+				continue
+			}
+			n, _ := strconv.Atoi(readSysString(pdir, "partition"))
+			dev.Partitions = append(dev.Partitions, PartitionInfo{
+				Name:    p.Name(),
+				Number:  n,
+				Start:   readSysUint(pdir, "start") * 512,
+				Size:    readSysUint(pdir, "size") * 512,
+				Holders: readSysDir(pdir, "holders"),
+			})
+		}
+		sort.Slice(dev.Partitions, func(i, j int) bool { return dev.Partitions[i].Number < dev.Partitions[j].Number })
+		out = append(out, dev)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func readSysString(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readSysUint(dir, name string) uint64 {
+	n, _ := strconv.ParseUint(readSysString(dir, name), 10, 64)
+	return n
+}
+
+// readSysDir 目录下的条目名（holders/slaves 为符号链接）
+func readSysDir(dir, name string) []string {
+	entries, err := os.ReadDir(filepath.Join(dir, name))
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.Name())
+	}
+	sort.Strings(out)
+	return out
+}
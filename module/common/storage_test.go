@@ -0,0 +1,89 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSys(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for p, v := range files {
+		full := filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if v == "<dir>" {
+			if err := os.MkdirAll(full, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.WriteFile(full, []byte(v+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadBlockDevices(t *testing.T) {
+	root := t.TempDir()
+	writeSys(t, root, map[string]string{
+		"block/sda/size":                 "20971520",
+		"block/sda/removable":            "0",
+		"block/sda/queue/rotational":     "1",
+		"block/sda/device/model":         "ST1000DM003",
+		"block/sda/device/vendor":        "ATA",
+		"block/sda/device/serial":        "Z1D5ABC",
+		"block/sda/sda2/partition":       "2",
+		"block/sda/sda2/start":           "2099200",
+		"block/sda/sda2/size":            "18872320",
+		"block/sda/sda2/holders/dm-0":    "<dir>",
+		"block/sda/sda1/partition":       "1",
+		"block/sda/sda1/start":           "2048",
+		"block/sda/sda1/size":            "2097152",
+		"block/sda/sda1/holders/md0":     "<dir>",
+		"block/nvme0n1/size":             "1000215216",
+		"block/nvme0n1/queue/rotational": "0",
+		"block/nvme0n1/device/model":     "Samsung SSD 980",
+		"block/nvme0n1/device/serial":    "S64DNF0R",
+		"block/dm-0/size":                "18872320",
+		"block/dm-0/dm/name":             "vg0-root",
+		"block/dm-0/dm/uuid":             "LVM-abcdef",
+		"block/dm-0/slaves/sda2":         "<dir>",
+		"block/md0/size":                 "2097152",
+		"block/md0/md/level":             "raid1",
+		"block/md0/slaves/sda1":          "<dir>",
+		"block/loop0/size":               "0",
+		"block/ram0/size":                "8192",
+	})
+
+	devs, err := ReadBlockDevices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]BlockDeviceInfo)
+	for _, d := range devs {
+		byName[d.Name] = d
+	}
+	if len(devs) != 4 {
+		t.Fatalf("expected sda/nvme0n1/dm-0/md0, got %+v", devs)
+	}
+
+	sda := byName["sda"]
+	if sda.Size != 20971520*512 || !sda.Rotational || sda.Model != "ST1000DM003" || sda.Serial != "Z1D5ABC" {
+		t.Fatalf("sda=%+v", sda)
+	}
+	if len(sda.Partitions) != 2 || sda.Partitions[0].Name != "sda1" || sda.Partitions[0].Start != 2048*512 ||
+		sda.Partitions[1].Holders[0] != "dm-0" {
+		t.Fatalf("partitions=%+v", sda.Partitions)
+	}
+	if byName["nvme0n1"].Rotational || byName["nvme0n1"].Serial != "S64DNF0R" {
+		t.Fatalf("nvme=%+v", byName["nvme0n1"])
+	}
+	if dm := byName["dm-0"]; dm.Type != "dm" || !dm.LVM || dm.DMName != "vg0-root" || dm.Slaves[0] != "sda2" {
+		t.Fatalf("dm-0=%+v", dm)
+	}
+	if md := byName["md0"]; md.Type != "md" || md.MDLevel != "raid1" || md.Slaves[0] != "sda1" {
+		t.Fatalf("md0=%+v", md)
+	}
+}
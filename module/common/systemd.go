@@ -0,0 +1,165 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	systemdRunDir    = "/run/systemd/system"
+	systemctlTimeout = 30 * time.Second
+	// systemctl show 单次查询的 unit 数，避免参数过长
+	systemctlShowBatch = 200
+)
+
+// systemdShowProps systemctl show 查询的属性
+var systemdShowProps = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "MainPID", "NRestarts", "Result",
+}
+
+// SystemdUnit systemd unit 状态
+type SystemdUnit struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	LoadState     string `json:"loadState"`
+	ActiveState   string `json:"activeState"`             // active/inactive/failed/activating ...
+	SubState      string `json:"subState"`                // running/exited/dead ...
+	UnitFileState string `json:"unitFileState,omitempty"` // enabled/disabled/static/masked ...
+	MainPID       int32  `json:"mainPid,omitempty"`
+	NRestarts     int    `json:"nRestarts,omitempty"` // Restart= 触发的自动重启次数（systemd 235+）
+	Result        string `json:"result,omitempty"`    // 最近一次失败原因：exit-code/signal/timeout ...
+}
+
+// SystemdBooted 与 sd_booted() 相同，以 /run/systemd/system 判断是否由 systemd 启动
+func SystemdBooted() bool {
+	fi, err := os.Stat(systemdRunDir)
+	return err == nil && fi.IsDir()
+}
+
+// ListSystemdUnits 列出已加载的指定类型 unit（如 service/socket/timer）及其状态
+func ListSystemdUnits(types []string) ([]SystemdUnit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), systemctlTimeout)
+	defer cancel()
+
+	args := []string{"list-units", "--all"}
+	if len(types) > 0 {
+		args = append(args, "--type="+strings.Join(types, ","))
+	}
+	listed, err := listUnits(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var units []SystemdUnit
+	for i := 0; i < len(listed); i += systemctlShowBatch {
+		end := i + systemctlShowBatch
+		if end > len(listed) {
+			end = len(listed)
+		}
+		args := []string{"show", "--property=" + strings.Join(systemdShowProps, ","), "--"}
+		for _, u := range listed[i:end] {
+			args = append(args, u.Name)
+		}
+		out, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("systemctl show: %w", err)
+		}
+		units = append(units, ParseSystemctlShow(out)...)
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, nil
+}
+
+// ListFailedUnits 列出处于 failed 状态的 unit，开销小，用于高频检测
+func ListFailedUnits() ([]SystemdUnit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), systemctlTimeout)
+	defer cancel()
+	return listUnits(ctx, "list-units", "--all", "--state=failed")
+}
+
+func listUnits(ctx context.Context, args ...string) ([]SystemdUnit, error) {
+	args = append(args, "--no-legend", "--no-pager", "--plain", "--full")
+	out, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("systemctl %s: %w", args[0], err)
+	}
+	return ParseSystemctlList(out), nil
+}
+
+// ParseSystemctlList 解析 systemctl list-units --no-legend --plain 的输出：UNIT LOAD ACTIVE SUB DESCRIPTION
+func ParseSystemctlList(out []byte) []SystemdUnit {
+	var units []SystemdUnit
+	for _, line := range strings.Split(string(out), "\n") {
+		// 部分版本即使 --plain 也会给异常 unit 加前缀标记
+		line = strings.TrimLeft(strings.TrimSpace(line), "●*× ")
+		f := strings.Fields(line)
+		if len(f) < 4 {
+			continue
+		}
+		u := SystemdUnit{Name: f[0], LoadState: f[1], ActiveState: f[2], SubState: f[3]}
+		if len(f) > 4 {
+			u.Description = strings.Join(f[4:], " ")
+		}
+		units = append(units, u)
+	}
+	return units
+}
+
+// ParseSystemctlShow 解析 systemctl show 多个 unit 的输出（KEY=VALUE，unit 之间以空行分隔）
+func ParseSystemctlShow(out []byte) []SystemdUnit {
+	var (
+		units []SystemdUnit
+		cur   SystemdUnit
+	)
+	flush := func() {
+		if cur.Name != "" {
+			units = append(units, cur)
+		}
+		cur = SystemdUnit{}
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "Id":
+			cur.Name = v
+		case "Description":
+			cur.Description = v
+		case "LoadState":
+			cur.LoadState = v
+		case "ActiveState":
+			cur.ActiveState = v
+		case "SubState":
+			cur.SubState = v
+		case "UnitFileState":
+			cur.UnitFileState = v
+		case "MainPID":
+			pid, _ := strconv.ParseInt(v, 10, 32)
+			cur.MainPID = int32(pid)
+		case "NRestarts":
+			cur.NRestarts, _ = strconv.Atoi(v)
+		case "Result":
+			cur.Result = v
+		}
+	}
+	flush()
+	return units
+}
@@ -0,0 +1,55 @@
+package common
+
+import "testing"
+
+func TestParseSystemctlList(t *testing.T) {
+	out := []byte("nginx.service loaded active running A high performance web server\n" +
+		"● mysql.service loaded failed failed MySQL Server\n" +
+		"\n" +
+		"cron.timer loaded active waiting\n")
+	units := ParseSystemctlList(out)
+	if len(units) != 3 {
+		t.Fatalf("units=%+v", units)
+	}
+	if u := units[0]; u.Name != "nginx.service" || u.SubState != "running" || u.Description != "A high performance web server" {
+		t.Fatalf("nginx=%+v", u)
+	}
+	if u := units[1]; u.Name != "mysql.service" || u.ActiveState != "failed" {
+		t.Fatalf("mysql=%+v", u)
+	}
+	if u := units[2]; u.Name != "cron.timer" || u.Description != "" {
+		t.Fatalf("cron=%+v", u)
+	}
+}
+
+func TestParseSystemctlShow(t *testing.T) {
+	out := []byte(`Id=nginx.service
+Description=A high performance web server
+LoadState=loaded
+ActiveState=active
+SubState=running
+UnitFileState=enabled
+MainPID=1234
+NRestarts=3
+Result=success
+
+Id=mysql.service
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+UnitFileState=disabled
+MainPID=0
+NRestarts=
+Result=exit-code
+`)
+	units := ParseSystemctlShow(out)
+	if len(units) != 2 {
+		t.Fatalf("units=%+v", units)
+	}
+	if u := units[0]; u.MainPID != 1234 || u.NRestarts != 3 || u.UnitFileState != "enabled" || u.Description == "" {
+		t.Fatalf("nginx=%+v", u)
+	}
+	if u := units[1]; u.ActiveState != "failed" || u.Result != "exit-code" || u.MainPID != 0 || u.NRestarts != 0 {
+		t.Fatalf("mysql=%+v", u)
+	}
+}
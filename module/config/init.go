@@ -9,6 +9,10 @@ func SetupDefaultViper() {
 	viper.SetDefault("Channel.Port", "5050")
 	viper.SetDefault("IDC.Zone", "")
 	viper.SetDefault("IDC.Region", "")
+	viper.SetDefault("Cloud.Metadata", false)
+	viper.SetDefault("Cloud.Provider", "")
+	viper.SetDefault("Cloud.MetadataURL", "")
+	viper.SetDefault("Cloud.Timeout", "2s")
 	viper.SetDefault("TlsConf.Certfile", "")
 	viper.SetDefault("TlsConf.SrvName", "")
 	viper.SetDefault("IP", "")
@@ -21,11 +25,56 @@ func SetupDefaultViper() {
 	viper.SetDefault("LogOnceCount", 50000)
 	viper.SetDefault("IntervalTick.HeartBeat", "10s")
 	viper.SetDefault("IntervalTick.ReportOS", "20s")
+	viper.SetDefault("IntervalTick.OSInfoFull", "24h")
+	viper.SetDefault("IntervalTick.ReportPackages", "1h")
+	viper.SetDefault("IntervalTick.PackagesFull", "24h")
+	viper.SetDefault("IntervalTick.ReportNetwork", "5m")
+	viper.SetDefault("Network.MaxConnSummaries", 500)
+	viper.SetDefault("IntervalTick.ReportProcesses", "1m")
+	viper.SetDefault("Process.TopN", 10)
+	viper.SetDefault("IntervalTick.ReportSystemd", "5m")
+	viper.SetDefault("IntervalTick.SystemdFull", "24h")
+	viper.SetDefault("IntervalTick.SystemdFailed", "10s")
+	viper.SetDefault("Systemd.UnitTypes", []string{"service", "socket", "timer"})
+	viper.SetDefault("Metrics.Enabled", true)
+	viper.SetDefault("Metrics.SampleInterval", "10s")
+	viper.SetDefault("Metrics.Interval", "1m")
+	viper.SetDefault("Metrics.BatchSize", 5)
+	viper.SetDefault("Metrics.MaxBuffered", 1440)
+	viper.SetDefault("IntervalTick.Collectors", "10s")
+	viper.SetDefault("IntervalTick.FactsFull", "24h")
+	viper.SetDefault("Collector.Dir", "/opt/x-agent/libexec/collectors.d")
+	viper.SetDefault("Collector.DefaultSchedule", "@every 1h")
+	viper.SetDefault("Collector.DefaultTimeout", "30s")
 	viper.SetDefault("IntervalTick.ReportAgent", "20s")
+	viper.SetDefault("IntervalTick.Outbox", "10s")
+	viper.SetDefault("IntervalTick.Spool", "10m")
 	viper.SetDefault("Timeout.CmdRun", "120s")
 	viper.SetDefault("Timeout.HearBeat", "60s")
 	viper.SetDefault("Timeout.Report", "2s")
 	viper.SetDefault("Timeout.Connect", "4s")
+	viper.SetDefault("Log.BatchBytes", 32768)
+	viper.SetDefault("Log.BatchInterval", "500ms")
+	viper.SetDefault("Log.Retry", 3)
+	viper.SetDefault("Log.RetryBackoff", "500ms")
+	viper.SetDefault("Spool.Dir", "./spool")
+	viper.SetDefault("Spool.MaxBytes", 1<<30)
+	viper.SetDefault("Spool.MaxTaskBytes", 256<<20)
+	viper.SetDefault("Spool.TTL", "72h")
+	viper.SetDefault("Schedule.File", "./schedules.json")
+	viper.SetDefault("Outbox.MaxSize", 1000)
+	viper.SetDefault("Outbox.Dir", "./outbox")
+	viper.SetDefault("Worker.PoolSize", 10)
+	viper.SetDefault("Worker.QueueSize", 200)
+	viper.SetDefault("Worker.ClassLimits", map[string]int{})
+	viper.SetDefault("Sandbox.Enabled", false)
+	viper.SetDefault("Sandbox.Classes", map[string]bool{})
+	viper.SetDefault("Sandbox.Network", false)
+	viper.SetDefault("Sandbox.Writable", []string{})
+	viper.SetDefault("Sandbox.Tmpfs", []string{"/tmp"})
+	viper.SetDefault("Sandbox.Seccomp", "default")
+	viper.SetDefault("Container.DockerSocket", "/var/run/docker.sock")
+	viper.SetDefault("Container.ContainerdRoot", "/run/containerd/io.containerd.runtime.v2.task")
 	viper.SetDefault("RuntimeEnv", map[string]string{
 		"PATH": ":/opt/x-agent/libexec:/bin:/usr/local/sbin:/usr/local/bin:/sbin:/bin:/usr/sbin:/usr/bin",
 	})
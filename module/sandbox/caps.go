@@ -0,0 +1,80 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// lastCap 内核支持的最大能力编号，读取失败时使用编译时的值
+func lastCap() int {
+	b, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return n
+}
+
+// dropBoundingCaps 清空 bounding 与 ambient 集，exec 后（即使 uid 为 0）无法重新获得能力。
+// 均为线程级属性，调用方需已锁定线程
+func dropBoundingCaps() error {
+	return limitBoundingCaps(0)
+}
+
+// limitBoundingCaps 从 bounding 集中去掉 keep 以外的能力并清空 ambient 集
+func limitBoundingCaps(keep uint64) error {
+	for c := 0; c <= lastCap(); c++ {
+		if c < 64 && keep&(1<<uint(c)) != 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return err
+		}
+	}
+	// 4.3 之前的内核没有 ambient 集
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && err != unix.EINVAL {
+		return err
+	}
+	return nil
+}
+
+// clearCaps 清空当前线程的 effective/permitted/inheritable 集
+func clearCaps() error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	return unix.Capset(&hdr, &data[0])
+}
+
+// maskCaps 当前线程的 effective/permitted/inheritable 集只保留 keep 中的能力。
+// uid 0 exec 时 inheritable 集会并入新的 permitted 集，不受 bounding 集限制
+func maskCaps(keep uint64) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return err
+	}
+	for i := range data {
+		m := uint32(keep >> (32 * uint(i)))
+		data[i].Effective &= m
+		data[i].Permitted &= m
+		data[i].Inheritable &= m
+	}
+	return unix.Capset(&hdr, &data[0])
+}
+
+// parseCapBnd 解析 /proc/<pid>/status 中的 CapBnd（十六进制）
+func parseCapBnd(status []byte) (uint64, error) {
+	for _, line := range strings.Split(string(status), "\n") {
+		if v, ok := strings.CutPrefix(line, "CapBnd:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+		}
+	}
+	return 0, fmt.Errorf("CapBnd not found")
+}
@@ -0,0 +1,164 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	containerEnvKey  = "X_AGENT_CONTAINER"
+	containerInitArg = "container-init"
+	// 由 nsexec 构造函数读取
+	nsPIDEnv     = "_X_AGENT_NS_PID"
+	nsCgroupsEnv = "_X_AGENT_NS_CGROUPS"
+)
+
+// cgroupRoot 宿主机 cgroup 文件系统挂载点
+const cgroupRoot = "/sys/fs/cgroup"
+
+// ContainerSpec 在容器内执行的参数
+type ContainerSpec struct {
+	PID int `json:"pid"` // 容器内进程（通常为 init），加入其 cgroup 与全部 namespace
+	// Cred 容器内（容器 user namespace 视角）的身份，nil 表示 root
+	Cred *Credential `json:"cred,omitempty"`
+	// Dir 容器内的工作目录，空表示目标进程的当前目录
+	Dir string `json:"dir,omitempty"`
+}
+
+// containerInit 传给 container-init 的参数
+type containerInit struct {
+	ContainerSpec
+	CapBnd uint64 `json:"cap_bnd"` // 目标进程的 bounding 集
+}
+
+// ContainerCommand 构造在容器内执行 name/args 的命令，env 为目标命令的环境变量。
+// 子进程加入目标进程的 cgroup 与 user（存在独立 user namespace 时）/cgroup/ipc/uts/net/pid/mnt namespace 及根目录，
+// 能力不超过目标进程的 bounding 集，并切换到 Cred（含附加组）后 exec
+func ContainerCommand(ctx context.Context, spec *ContainerSpec, name string, args []string, env []string) (*exec.Cmd, error) {
+	if !nsexecSupported {
+		return nil, fmt.Errorf("container: not supported without cgo")
+	}
+	proc := filepath.Join("/proc", strconv.Itoa(spec.PID))
+	status, err := os.ReadFile(filepath.Join(proc, "status"))
+	if err != nil {
+		return nil, fmt.Errorf("container: %w", err)
+	}
+	capBnd, err := parseCapBnd(status)
+	if err != nil {
+		return nil, fmt.Errorf("container: %s: %w", proc, err)
+	}
+	cg, err := os.ReadFile(filepath.Join(proc, "cgroup"))
+	if err != nil {
+		return nil, fmt.Errorf("container: %w", err)
+	}
+	b, err := json.Marshal(&containerInit{ContainerSpec: *spec, CapBnd: capBnd})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", append([]string{containerInitArg, name}, args...)...)
+	cmd.Args[0] = os.Args[0]
+	cmd.Env = append(append([]string{}, env...),
+		containerEnvKey+"="+string(b),
+		nsPIDEnv+"="+strconv.Itoa(spec.PID),
+		nsCgroupsEnv+"="+strings.Join(cgroupDirs(cg, cgroupRoot), "\n"),
+	)
+	return cmd, nil
+}
+
+// cgroupDirs 将 /proc/<pid>/cgroup 转换为宿主机上的 cgroup 目录。
+// cgroup v2 为 <root>/<path>（混合模式为 <root>/unified/<path>），v1 为 <root>/<controllers>/<path>，
+// 宿主机未挂载的层级跳过
+func cgroupDirs(data []byte, root string) []string {
+	var dirs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.SplitN(line, ":", 3)
+		if len(f) != 3 || !strings.HasPrefix(f[2], "/") {
+			continue
+		}
+		var base string
+		switch {
+		case f[0] == "0" && f[1] == "":
+			base = root
+			if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+				base = filepath.Join(root, "unified")
+			}
+		case f[1] != "":
+			base = filepath.Join(root, strings.TrimPrefix(f[1], "name="))
+		default:
+			continue
+		}
+		dir := filepath.Join(base, filepath.Clean(f[2]))
+		if _, err := os.Stat(filepath.Join(dir, "cgroup.procs")); err == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// runContainerInit 已由 nsexec 进入容器，限制能力、切换身份后 exec 目标命令，成功时不再返回
+func runContainerInit() error {
+	var spec containerInit
+	if err := json.Unmarshal([]byte(os.Getenv(containerEnvKey)), &spec); err != nil {
+		return fmt.Errorf("parse spec: %w", err)
+	}
+	_ = os.Unsetenv(containerEnvKey)
+
+	// 能力集为线程级属性，必须在同一线程 exec
+	runtime.LockOSThread()
+
+	if spec.Dir != "" {
+		if err := os.Chdir(spec.Dir); err != nil {
+			return err
+		}
+	}
+	c := spec.Cred
+	if c == nil {
+		c = &Credential{}
+	}
+	// 修改 bounding 集需要 CAP_SETPCAP，必须在切换身份之前
+	if err := limitBoundingCaps(spec.CapBnd); err != nil {
+		return fmt.Errorf("limit bounding caps: %w", err)
+	}
+	groups := make([]int, len(c.Groups))
+	for i, g := range c.Groups {
+		groups[i] = int(g)
+	}
+	if err := syscall.Setgroups(groups); err != nil && (len(groups) > 0 || !setgroupsDenied()) {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(int(c.Gid)); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(int(c.Uid)); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	// 以 root 执行时 setuid 保留能力，限制为 bounding 集
+	if err := maskCaps(spec.CapBnd); err != nil {
+		return fmt.Errorf("limit caps: %w", err)
+	}
+
+	// PATH 为容器的环境变量，在容器根内查找
+	path, err := exec.LookPath(os.Args[2])
+	if err != nil {
+		return err
+	}
+	return unix.Exec(path, os.Args[2:], os.Environ())
+}
+
+// setgroupsDenied 所在 user namespace 禁止 setgroups（/proc/self/setgroups 为 deny，
+// 非特权创建的 user namespace），此时无法也无需清空附加组
+func setgroupsDenied() bool {
+	b, err := os.ReadFile("/proc/self/setgroups")
+	return err == nil && strings.TrimSpace(string(b)) == "deny"
+}
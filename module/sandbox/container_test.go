@@ -0,0 +1,144 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCapBnd(t *testing.T) {
+	v, err := parseCapBnd([]byte("Name:\tsleep\nCapPrm:\t0000000000000000\nCapBnd:\t00000000a80425fb\n"))
+	if err != nil || v != 0xa80425fb {
+		t.Fatalf("v=%x err=%v", v, err)
+	}
+	if _, err := parseCapBnd([]byte("Name:\tsleep\n")); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestCgroupDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"unified/docker/abc", "cpu,cpuacct/docker/abc", "systemd/docker/abc"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, d, "cgroup.procs"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := "12:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n0::/docker/abc\n"
+	want := []string{
+		filepath.Join(root, "cpu,cpuacct/docker/abc"),
+		filepath.Join(root, "systemd/docker/abc"),
+		filepath.Join(root, "unified/docker/abc"),
+	}
+	if got := cgroupDirs([]byte(data), root); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+
+	// 纯 cgroup v2
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "docker/abc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docker/abc/cgroup.procs"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := cgroupDirs([]byte("0::/docker/abc\n"), root); len(got) != 1 || got[0] != filepath.Join(root, "docker/abc") {
+		t.Fatalf("got=%v", got)
+	}
+}
+
+// startTarget 启动模拟容器 init 的进程，ready 返回 true 后才可进入
+func startTarget(t *testing.T, ready func(pid int) bool, name string, args ...string) int {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Skipf("%s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	for i := 0; i < 100; i++ {
+		if ready(cmd.Process.Pid) {
+			return cmd.Process.Pid
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Skipf("%s not ready", name)
+	return 0
+}
+
+func TestContainerCommand(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if !nsexecSupported {
+		t.Skip("requires cgo")
+	}
+
+	run := func(spec *ContainerSpec, script string) string {
+		t.Helper()
+		cmd, err := ContainerCommand(context.Background(), spec, "sh", []string{"-c", script}, os.Environ())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("err=%v out=%s", err, out)
+		}
+		return strings.Join(strings.Fields(string(out)), " ")
+	}
+	status := func(pid int) string {
+		b, _ := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/status")
+		return string(b)
+	}
+
+	// 目标进程的 bounding 集只有 CAP_CHOWN：root 执行时能力不超过该集合
+	pid := startTarget(t, func(pid int) bool {
+		return strings.Contains(status(pid), "CapBnd:\t0000000000000001")
+	}, "setpriv", "--bounding-set", "-all,+chown", "sleep", "30")
+	caps := `grep -E '^Cap(Eff|Bnd|Inh|Amb):' /proc/self/status | tr -d '\t' | tr '\n' ' '`
+	if got := run(&ContainerSpec{PID: pid, Dir: "/"}, `pwd; `+caps); got != "/ CapInh:0000000000000000 CapEff:0000000000000001 CapBnd:0000000000000001 CapAmb:0000000000000000" {
+		t.Fatalf("got=%s", got)
+	}
+	if got := run(&ContainerSpec{PID: pid, Cred: &Credential{Uid: 65534, Gid: 65534, Groups: []uint32{100}}}, `id -u; id -G; `+caps); got != "65534 65534 100 CapInh:0000000000000000 CapEff:0000000000000000 CapBnd:0000000000000001 CapAmb:0000000000000000" {
+		t.Fatalf("got=%s", got)
+	}
+
+	// 加入目标进程的 cgroup
+	cg, err := os.MkdirTemp(filepath.Join(cgroupRoot, "pids"), "x-agent-test-")
+	if err == nil {
+		defer func(pid int) {
+			// 目标进程移回原 cgroup 后才能删除
+			_ = os.WriteFile(filepath.Join(cgroupRoot, "pids", "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644)
+			_ = os.Remove(cg)
+		}(pid)
+		if err := os.WriteFile(filepath.Join(cg, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		want := "pids:/" + filepath.Base(cg)
+		if got := run(&ContainerSpec{PID: pid}, `grep :pids: /proc/self/cgroup`); !strings.HasSuffix(got, want) {
+			t.Fatalf("got=%s want=%s", got, want)
+		}
+	}
+
+	// 目标进程位于独立的 user namespace 时一并进入
+	self, _ := os.Readlink("/proc/self/ns/user")
+	pid = startTarget(t, func(pid int) bool {
+		ns, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/ns/user")
+		return err == nil && ns != self
+	}, "unshare", "-U", "-r", "--fork", "sleep", "30")
+	want, _ := os.Readlink("/proc/" + strconv.Itoa(pid) + "/ns/user")
+	if got := run(&ContainerSpec{PID: pid}, `readlink /proc/self/ns/user; id -u`); got != want+" 0" {
+		t.Fatalf("got=%s want=%s", got, want)
+	}
+}
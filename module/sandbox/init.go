@@ -0,0 +1,320 @@
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// runInit 在新 namespace 中执行，成功时 exec 目标命令不再返回
+func runInit() error {
+	var spec Spec
+	if err := json.Unmarshal([]byte(os.Getenv(envKey)), &spec); err != nil {
+		return fmt.Errorf("parse spec: %w", err)
+	}
+	_ = os.Unsetenv(envKey)
+
+	// no_new_privs 与 prctl 方式安装的 seccomp 只作用于当前线程，必须在同一线程 exec
+	runtime.LockOSThread()
+
+	if err := setupMounts(&spec); err != nil {
+		return err
+	}
+	if !spec.Network {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("loopback up: %w", err)
+		}
+	}
+	// 未指定用户时不以 root 执行
+	c := spec.Cred
+	if c == nil {
+		c = &Credential{Uid: NobodyID, Gid: NobodyID}
+	}
+	// 清空 bounding 集需要 CAP_SETPCAP，必须在切换身份之前
+	if err := dropBoundingCaps(); err != nil {
+		return fmt.Errorf("drop bounding caps: %w", err)
+	}
+	groups := make([]int, len(c.Groups))
+	for i, g := range c.Groups {
+		groups[i] = int(g)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(int(c.Gid)); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(int(c.Uid)); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	// 指定 root 时 setuid 不会清除能力，显式清空
+	if err := clearCaps(); err != nil {
+		return fmt.Errorf("clear caps: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %w", err)
+	}
+	if spec.Seccomp != SeccompNone {
+		if err := installSeccomp(); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(os.Args[2])
+	if err != nil {
+		return err
+	}
+	return unix.Exec(path, os.Args[2:], os.Environ())
+}
+
+// setupMounts 根与其他挂载点只读，Writable 保持可写，Tmpfs 挂载私有 tmpfs，并挂载新的 /proc
+func setupMounts(s *Spec) error {
+	// 之后的挂载变化不传播回宿主机
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make / private: %w", err)
+	}
+
+	writable := make([]string, 0, len(s.Writable))
+	for _, p := range s.Writable {
+		p = filepath.Clean(p)
+		// 绑定到自身成为独立挂载点，后续只读重挂载时跳过
+		if err := unix.Mount(p, p, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind writable %s: %w", p, err)
+		}
+		writable = append(writable, p)
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mp := range mounts {
+		// /proc 与 /dev 随后替换为私有挂载
+		if under(mp, "/proc") || under(mp, "/dev") || underAny(mp, writable) {
+			continue
+		}
+		if err := remountReadonly(mp); err != nil {
+			return fmt.Errorf("remount %s readonly: %w", mp, err)
+		}
+	}
+
+	// tmpfs 会遮盖下面的文件，先持有需要保留的文件，挂载后再绑定回原路径
+	keep := make(map[string]*os.File, len(s.Files))
+	for _, p := range s.Files {
+		if !underAny(filepath.Clean(p), cleanAll(s.Tmpfs)) {
+			continue
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", p, err)
+		}
+		defer f.Close()
+		keep[filepath.Clean(p)] = f
+	}
+	for _, p := range s.Tmpfs {
+		if err := unix.Mount("tmpfs", filepath.Clean(p), "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("mount tmpfs %s: %w", p, err)
+		}
+	}
+	for p, f := range keep {
+		if err := bindFile(f, p); err != nil {
+			return fmt.Errorf("keep %s: %w", p, err)
+		}
+	}
+	// 设备节点需在挂载新的 /proc 之前经宿主机 /proc/self/fd 绑定
+	if err := setupDev(); err != nil {
+		return fmt.Errorf("setup /dev: %w", err)
+	}
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount proc: %w", err)
+	}
+	for _, p := range readonlyProc {
+		if err := bindReadonly(p); err != nil && err != unix.ENOENT {
+			return fmt.Errorf("readonly %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// readonlyProc 私有 /proc 中可修改宿主机内核状态的路径，绑定为只读
+var readonlyProc = []string{"/proc/sys", "/proc/sysrq-trigger", "/proc/irq", "/proc/bus"}
+
+// devNodes 私有 /dev 中保留的宿主机设备
+var devNodes = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// setupDev 以只读 tmpfs 替换 /dev，仅绑定 devNodes，另挂载私有 /dev/shm
+func setupDev() error {
+	nodes := make(map[string]*os.File, len(devNodes))
+	for _, n := range devNodes {
+		f, err := os.OpenFile("/dev/"+n, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			// 宿主机（如容器内）可能缺少部分设备
+			continue
+		}
+		defer f.Close()
+		nodes[n] = f
+	}
+	if err := unix.Mount("tmpfs", "/dev", "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755,size=64k"); err != nil {
+		return err
+	}
+	for n, f := range nodes {
+		dst := "/dev/" + n
+		if err := os.WriteFile(dst, nil, 0o600); err != nil {
+			return err
+		}
+		if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", f.Fd()), dst, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", dst, err)
+		}
+	}
+	for link, target := range map[string]string{
+		"/dev/fd": "/proc/self/fd", "/dev/stdin": "/proc/self/fd/0",
+		"/dev/stdout": "/proc/self/fd/1", "/dev/stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir("/dev/shm", 0o1777); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777"); err != nil {
+		return err
+	}
+	return unix.Mount("", "/dev", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NOEXEC, "")
+}
+
+// bindReadonly 将 p 绑定到自身后重挂载为只读
+func bindReadonly(p string) error {
+	if err := unix.Mount(p, p, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	return unix.Mount("", p, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+}
+
+// bindFile 将已打开的文件只读绑定到 dst（tmpfs 中新建的同名空文件）
+func bindFile(f *os.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, nil, 0o400); err != nil {
+		return err
+	}
+	src := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+	if err := unix.Mount(src, dst, "", unix.MS_BIND, ""); err != nil {
+		return err
+	}
+	return unix.Mount("", dst, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, "")
+}
+
+// remountReadonly bind 重挂载需保留原有的 nosuid/nodev/noexec 等标志
+func remountReadonly(mp string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(mp, &st); err != nil {
+		// 被其他挂载遮盖或已消失的挂载点
+		if err == unix.ENOENT || err == unix.EACCES {
+			return nil
+		}
+		return err
+	}
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+	for _, f := range []struct {
+		st int64
+		ms uintptr
+	}{
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	} {
+		if int64(st.Flags)&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+	err := unix.Mount("", mp, "", flags, "")
+	if err == unix.ENOENT {
+		return nil
+	}
+	return err
+}
+
+// mountPoints 按挂载顺序返回当前 mount namespace 的全部挂载点
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		out = append(out, unescapeMountPath(fields[4]))
+	}
+	return out, sc.Err()
+}
+
+// unescapeMountPath mountinfo 中空格等字符以 \040 形式转义
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func under(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+func underAny(p string, dirs []string) bool {
+	for _, d := range dirs {
+		if under(p, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// loopbackUp 新 network namespace 中 lo 默认是 down 的
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
@@ -0,0 +1,133 @@
+//go:build cgo
+
+package sandbox
+
+/*
+#define _GNU_SOURCE
+#include <errno.h>
+#include <fcntl.h>
+#include <sched.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/stat.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+static void nsexec_fail(const char *what)
+{
+	fprintf(stderr, "[x-agent] container: %s: %s\n", what, strerror(errno));
+	_exit(126);
+}
+
+// nsexec_cgroups 把当前进程写入每个 cgroup 目录（以换行分隔）的 cgroup.procs，
+// 必须在进入容器的 user namespace 之前完成（写入需要宿主机权限）
+static void nsexec_cgroups(const char *list)
+{
+	char *dirs = strdup(list), *save = NULL, *dir;
+	char path[4096];
+
+	if (dirs == NULL)
+		nsexec_fail("strdup");
+	for (dir = strtok_r(dirs, "\n", &save); dir != NULL; dir = strtok_r(NULL, "\n", &save)) {
+		snprintf(path, sizeof(path), "%s/cgroup.procs", dir);
+		int fd = open(path, O_WRONLY | O_CLOEXEC);
+		if (fd < 0)
+			nsexec_fail(path);
+		if (write(fd, "0", 1) != 1)
+			nsexec_fail(path);
+		close(fd);
+	}
+	free(dirs);
+}
+
+// nsexec 在 Go runtime 启动（创建线程）之前进入目标进程的 namespace：
+// setns 进入 user/mnt namespace 要求单线程，Go 代码中无法完成
+__attribute__((constructor)) static void nsexec(void)
+{
+	static const struct {
+		const char *name;
+		int type;
+	} nss[] = {
+		// user 必须最先进入，之后才拥有容器内其他 namespace 的权限；mnt 最后进入，之前仍可访问宿主机 /proc
+		{"user", CLONE_NEWUSER}, {"cgroup", CLONE_NEWCGROUP}, {"ipc", CLONE_NEWIPC},
+		{"uts", CLONE_NEWUTS},   {"net", CLONE_NEWNET},       {"pid", CLONE_NEWPID},
+		{"mnt", CLONE_NEWNS},
+	};
+	const int n = sizeof(nss) / sizeof(nss[0]);
+	int fds[sizeof(nss) / sizeof(nss[0])];
+	char path[64];
+	struct stat self, target;
+	int i, rootfd, cwdfd, status;
+	pid_t child;
+
+	const char *pid = getenv("_X_AGENT_NS_PID");
+	if (pid == NULL || *pid == '\0')
+		return;
+
+	const char *cgroups = getenv("_X_AGENT_NS_CGROUPS");
+	if (cgroups != NULL && *cgroups != '\0')
+		nsexec_cgroups(cgroups);
+
+	// 先打开全部 namespace 与根目录、工作目录，已处于同一 namespace 的跳过（重复进入 user namespace 会失败）
+	for (i = 0; i < n; i++) {
+		snprintf(path, sizeof(path), "/proc/%s/ns/%s", pid, nss[i].name);
+		fds[i] = open(path, O_RDONLY | O_CLOEXEC);
+		if (fds[i] < 0) {
+			// 内核不支持该 namespace（如旧内核没有 cgroup namespace）
+			if (errno == ENOENT)
+				continue;
+			nsexec_fail(path);
+		}
+		if (fstat(fds[i], &target) < 0)
+			nsexec_fail(path);
+		snprintf(path, sizeof(path), "/proc/self/ns/%s", nss[i].name);
+		if (stat(path, &self) == 0 && self.st_dev == target.st_dev && self.st_ino == target.st_ino) {
+			close(fds[i]);
+			fds[i] = -1;
+		}
+	}
+	snprintf(path, sizeof(path), "/proc/%s/root", pid);
+	if ((rootfd = open(path, O_PATH | O_DIRECTORY | O_CLOEXEC)) < 0)
+		nsexec_fail(path);
+	snprintf(path, sizeof(path), "/proc/%s/cwd", pid);
+	if ((cwdfd = open(path, O_PATH | O_DIRECTORY | O_CLOEXEC)) < 0)
+		nsexec_fail(path);
+
+	for (i = 0; i < n; i++) {
+		if (fds[i] < 0)
+			continue;
+		if (setns(fds[i], nss[i].type) < 0)
+			nsexec_fail(nss[i].name);
+		close(fds[i]);
+	}
+	// 进入 mnt namespace 后根与工作目录为 namespace 的根，改为目标进程的根与当前目录
+	if (fchdir(rootfd) < 0 || chroot(".") < 0)
+		nsexec_fail("chroot");
+	if (fchdir(cwdfd) < 0)
+		nsexec_fail("chdir");
+	close(rootfd);
+	close(cwdfd);
+
+	// 进入 PID namespace 只对之后创建的子进程生效：子进程继续启动 Go runtime，父进程等待并转发退出码
+	child = fork();
+	if (child < 0)
+		nsexec_fail("fork");
+	if (child == 0) {
+		unsetenv("_X_AGENT_NS_PID");
+		unsetenv("_X_AGENT_NS_CGROUPS");
+		return;
+	}
+	while (waitpid(child, &status, 0) < 0) {
+		if (errno != EINTR)
+			nsexec_fail("wait");
+	}
+	if (WIFEXITED(status))
+		_exit(WEXITSTATUS(status));
+	_exit(128 + WTERMSIG(status));
+}
+*/
+import "C"
+
+// nsexecSupported 进入容器由 cgo 构造函数完成
+const nsexecSupported = true
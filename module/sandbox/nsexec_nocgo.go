@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package sandbox
+
+// nsexecSupported 进入容器依赖 cgo 构造函数（setns 进入 user/mnt namespace 要求单线程），
+// CGO_ENABLED=0 构建时不支持容器内执行
+const nsexecSupported = false
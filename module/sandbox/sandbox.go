@@ -0,0 +1,125 @@
+// Package sandbox 以 Linux namespace 隔离执行任务。
+//
+// agent 以 `sandbox-init` 参数重新执行自身（/proc/self/exe），子进程位于新的
+// mount/PID/IPC（可选 network）namespace 中，完成只读根、可写目录、私有 /proc 与 /dev、
+// 降权（默认 nobody）、清空能力、no_new_privs 与 seccomp 设置后再 exec 目标命令。
+//
+// 容器内执行以 `container-init` 参数重新执行自身：cgo 构造函数在 Go runtime 启动前
+// 加入容器进程的 cgroup 与 namespace，随后限制能力、切换身份再 exec 目标命令。
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	envKey  = "X_AGENT_SANDBOX"
+	initArg = "sandbox-init"
+)
+
+// NobodyID 未指定用户时沙箱内使用的 uid/gid
+const NobodyID = 65534
+
+// seccomp 策略
+const (
+	SeccompDefault = "default" // 禁止挂载、内核模块、ptrace、namespace 等高危系统调用
+	SeccompNone    = "none"
+)
+
+// Credential 沙箱内降权使用的身份（沙箱初始化需要 root，只能在 init 中切换）
+type Credential struct {
+	Uid    uint32   `json:"uid"`
+	Gid    uint32   `json:"gid"`
+	Groups []uint32 `json:"groups,omitempty"`
+}
+
+// Spec 沙箱参数
+type Spec struct {
+	Network  bool     `json:"network"`            // false 时使用独立 network namespace（仅 lo）
+	Writable []string `json:"writable,omitempty"` // 保持可写的宿主机路径（绝对路径）
+	Tmpfs    []string `json:"tmpfs,omitempty"`    // 挂载私有 tmpfs 的路径，如 /tmp
+	Seccomp  string   `json:"seccomp,omitempty"`  // default/none
+	// Files 任务需要读取的文件（如脚本），即使位于 Tmpfs 下也以只读方式保留
+	Files []string `json:"files,omitempty"`
+	// Cred 为 nil 时以 nobody 执行
+	Cred *Credential `json:"cred,omitempty"`
+}
+
+// Validate 检查路径与策略
+func (s *Spec) Validate() error {
+	for _, p := range append(append(append([]string{}, s.Writable...), s.Tmpfs...), s.Files...) {
+		if !filepath.IsAbs(p) || filepath.Clean(p) == "/" {
+			return fmt.Errorf("sandbox: invalid path %q", p)
+		}
+	}
+	for _, w := range s.Writable {
+		if underAny(filepath.Clean(w), cleanAll(s.Tmpfs)) {
+			return fmt.Errorf("sandbox: writable path %q is hidden by tmpfs", w)
+		}
+	}
+	switch s.Seccomp {
+	case "", SeccompDefault, SeccompNone:
+	default:
+		return fmt.Errorf("sandbox: unknown seccomp profile %q", s.Seccomp)
+	}
+	return nil
+}
+
+func cleanAll(paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = filepath.Clean(p)
+	}
+	return out
+}
+
+// Command 构造在沙箱中执行 name/args 的命令，env 为目标命令的环境变量
+func Command(ctx context.Context, spec *Spec, name string, args []string, env []string) (*exec.Cmd, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", append([]string{initArg, name}, args...)...)
+	cmd.Args[0] = os.Args[0]
+	cmd.Env = append(append([]string{}, env...), envKey+"="+string(b))
+
+	flags := syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC
+	if !spec.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: uintptr(flags),
+		// agent 退出时沙箱随之结束
+		Pdeathsig: syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+// Main 若当前进程是沙箱或容器的 init 则完成初始化并 exec 目标命令（不返回），否则直接返回。
+// 需在 main 最开始调用
+func Main() {
+	if len(os.Args) < 3 {
+		return
+	}
+	switch {
+	case os.Args[1] == initArg && os.Getenv(envKey) != "":
+		err := runInit()
+		fmt.Fprintf(os.Stderr, "[x-agent] sandbox: %v\n", err)
+	case os.Args[1] == containerInitArg && os.Getenv(containerEnvKey) != "":
+		err := runContainerInit()
+		fmt.Fprintf(os.Stderr, "[x-agent] container: %v\n", err)
+	default:
+		return
+	}
+	os.Exit(126)
+}
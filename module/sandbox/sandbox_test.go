@@ -0,0 +1,192 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	// 测试二进制同样作为沙箱 init 被重新执行
+	Main()
+	os.Exit(m.Run())
+}
+
+func TestSpecValidate(t *testing.T) {
+	for _, s := range []Spec{
+		{Writable: []string{"relative/path"}},
+		{Tmpfs: []string{"/"}},
+		{Seccomp: "strict"},
+		{Writable: []string{"/tmp/work"}, Tmpfs: []string{"/tmp/"}},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", s)
+		}
+	}
+	if err := (&Spec{Writable: []string{"/var/tmp"}, Tmpfs: []string{"/tmp"}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runFilter 解释执行过滤器中用到的 BPF 指令
+func runFilter(t *testing.T, prog []unix.SockFilter, arch uint32, nr int, arg0 uint32) uint32 {
+	t.Helper()
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = map[uint32]uint32{0: uint32(nr), 4: arch, 16: arg0}[ins.K]
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			var ok bool
+			switch ins.Code {
+			case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+				ok = acc == ins.K
+			case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+				ok = acc >= ins.K
+			case unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K:
+				ok = acc&ins.K != 0
+			default:
+				t.Fatalf("unexpected code %#x", ins.Code)
+			}
+			if ok {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		}
+	}
+	t.Fatal("filter fell through")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	prog := seccompFilter(unix.AUDIT_ARCH_X86_64, []uintptr{unix.SYS_MOUNT, unix.SYS_PTRACE})
+	eperm := unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	for _, c := range []struct {
+		arch uint32
+		nr   int
+		arg0 uint32
+		want uint32
+	}{
+		{unix.AUDIT_ARCH_I386, unix.SYS_GETPID, 0, unix.SECCOMP_RET_KILL_PROCESS},
+		{unix.AUDIT_ARCH_X86_64, x32SyscallBit | unix.SYS_GETPID, 0, unix.SECCOMP_RET_KILL_PROCESS},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_GETPID, 0, unix.SECCOMP_RET_ALLOW},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_MOUNT, 0, eperm},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_PTRACE, 0, eperm},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_CLONE3, 0, unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_CLONE, unix.CLONE_VM | unix.CLONE_THREAD, unix.SECCOMP_RET_ALLOW},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_CLONE, uint32(unix.SIGCHLD), unix.SECCOMP_RET_ALLOW},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_CLONE, unix.CLONE_NEWUSER | uint32(unix.SIGCHLD), eperm},
+		{unix.AUDIT_ARCH_X86_64, unix.SYS_CLONE, unix.CLONE_NEWNS, eperm},
+	} {
+		if got := runFilter(t, prog, c.arch, c.nr, c.arg0); got != c.want {
+			t.Fatalf("arch=%#x nr=%#x arg0=%#x got=%#x want=%#x", c.arch, c.nr, c.arg0, got, c.want)
+		}
+	}
+
+	// 仅 x86_64 需要检查 x32
+	if n := len(seccompFilter(unix.AUDIT_ARCH_AARCH64, nil)); n != len(seccompFilter(unix.AUDIT_ARCH_X86_64, nil))-2 {
+		t.Fatalf("aarch64 len=%d", n)
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/mnt/a\040b`); got != "/mnt/a b" {
+		t.Fatalf("got=%q", got)
+	}
+}
+
+func TestCommand_Isolation(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if err := exec.Command("unshare", "-m", "-p", "-n", "-f", "true").Run(); err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+
+	// t.TempDir 位于 /tmp，会被沙箱的 tmpfs 遮盖
+	dir, err := os.MkdirTemp("/var/tmp", "x-agent-sandbox-")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	// 位于 tmpfs 下的脚本需要保留
+	kept := filepath.Join(t.TempDir(), "kept.sh")
+	if err := os.WriteFile(kept, []byte("echo kept=ok\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(spec *Spec, lines ...string) []string {
+		t.Helper()
+		cmd, err := Command(context.Background(), spec, "sh", []string{"-c", strings.Join(lines, "; "), "sh", dir, kept}, os.Environ())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("err=%v out=%s", err, out)
+		}
+		return strings.Fields(string(out))
+	}
+	spec := &Spec{
+		Writable: []string{dir},
+		Tmpfs:    []string{"/tmp"},
+		Files:    []string{kept},
+		Seccomp:  SeccompDefault,
+	}
+
+	// 显式指定 root：只读根、无能力与 seccomp 生效
+	spec.Cred = &Credential{}
+	got := run(spec,
+		`echo pid=$$`,
+		`touch /etc/x-agent-sandbox-test 2>/dev/null && echo etc=rw || echo etc=ro`,
+		`touch /tmp/x && echo tmp=rw`,
+		`echo hi > "$1/out" && echo writable=rw`,
+		`mount -t tmpfs none /mnt 2>/dev/null && echo mount=ok || echo mount=denied`,
+		`mount -o remount,rw / 2>/dev/null && echo remount=ok || echo remount=denied`,
+		`echo ifaces=$(tail -n +3 /proc/net/dev | wc -l)`,
+		`grep -E '^Cap(Eff|Bnd|Amb|Inh):' /proc/self/status | tr -d '\t' | tr '\n' ' '`,
+		`{ cat /proc/sys/vm/swappiness > /proc/sys/vm/swappiness; } 2>/dev/null && echo procsys=rw || echo procsys=ro`,
+		`echo dev=$(ls /dev | tr '\n' ,)`,
+		`echo x > /dev/null && echo devnull=ok`,
+		`touch /dev/x 2>/dev/null && echo dev=rw || echo dev=ro`,
+		`touch /dev/shm/x && echo shm=rw`,
+		`. "$2"`,
+	)
+	want := []string{"pid=1", "etc=ro", "tmp=rw", "writable=rw", "mount=denied", "remount=denied", "ifaces=1",
+		"CapInh:0000000000000000", "CapEff:0000000000000000", "CapBnd:0000000000000000", "CapAmb:0000000000000000",
+		"procsys=ro", "dev=fd,full,null,random,shm,stderr,stdin,stdout,tty,urandom,zero,", "devnull=ok", "dev=ro", "shm=rw", "kept=ok"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+
+	// 未指定用户时以 nobody 执行
+	if err := os.Chmod(kept, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec.Cred = nil
+	if got := run(spec, `id -u`, `. "$2"`); strings.Join(got, " ") != "65534 kept=ok" {
+		t.Fatalf("got=%v", got)
+	}
+
+	// 降权
+	spec.Cred = &Credential{Uid: 1000, Gid: 1000}
+	if got := run(spec, `id -u`, `. "$2"`); strings.Join(got, " ") != "1000 kept=ok" {
+		t.Fatalf("got=%v", got)
+	}
+
+	if b, _ := os.ReadFile(filepath.Join(dir, "out")); string(b) != "hi\n" {
+		t.Fatalf("writable path not shared with host: %q", b)
+	}
+	if _, err := os.Stat("/tmp/x"); err == nil {
+		t.Fatalf("sandbox /tmp should be private")
+	}
+}
@@ -0,0 +1,97 @@
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls 默认 seccomp 策略禁止的系统调用，返回 EPERM
+var deniedSyscalls = []uintptr{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT,
+	unix.SYS_FSOPEN, unix.SYS_FSCONFIG, unix.SYS_FSMOUNT, unix.SYS_FSPICK,
+	unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE, unix.SYS_MOUNT_SETATTR,
+	unix.SYS_UNSHARE, unix.SYS_SETNS,
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_KEXEC_LOAD, unix.SYS_KEXEC_FILE_LOAD, unix.SYS_REBOOT,
+	unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_ACCT,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN, unix.SYS_USERFAULTFD,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_SETTIMEOFDAY, unix.SYS_CLOCK_SETTIME, unix.SYS_ADJTIMEX, unix.SYS_CLOCK_ADJTIME,
+	unix.SYS_SETHOSTNAME, unix.SYS_SETDOMAINNAME,
+}
+
+func auditArch() (uint32, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, nil
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, nil
+	}
+	return 0, fmt.Errorf("unsupported arch %s", runtime.GOARCH)
+}
+
+// cloneNamespaceFlags clone 创建新 namespace 的标志（CLONE_NEWTIME 与 clone 的退出信号位重叠，只能经 clone3 使用）
+const cloneNamespaceFlags = unix.CLONE_NEWNS | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC | unix.CLONE_NEWUSER |
+	unix.CLONE_NEWPID | unix.CLONE_NEWNET | unix.CLONE_NEWCGROUP
+
+// x32SyscallBit x86_64 上 x32 ABI 的系统调用号带有该位，arch 字段与 x86_64 相同
+const x32SyscallBit = 0x40000000
+
+// seccompFilter 生成 BPF：架构不符（如 x86_64 上的 32 位调用）或 x32 调用直接杀死进程，
+// 命中禁止列表返回 EPERM；clone3 的参数位于用户内存无法检查，返回 ENOSYS 使 libc 回退到 clone，
+// clone 带 namespace 标志时返回 EPERM，其余放行
+func seccompFilter(arch uint32, denied []uintptr) []unix.SockFilter {
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(op uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, Jt: jt, Jf: jf, K: k}
+	}
+	jeq := func(k uint32, jt, jf uint8) unix.SockFilter {
+		return jump(unix.BPF_JEQ, k, jt, jf)
+	}
+	kill := stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS)
+	errno := func(e unix.Errno) unix.SockFilter {
+		return stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(e))
+	}
+
+	// struct seccomp_data { int nr; __u32 arch; __u64 instruction_pointer; __u64 args[6]; }
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 4),
+		jeq(arch, 1, 0),
+		kill,
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 0),
+	}
+	if arch == unix.AUDIT_ARCH_X86_64 {
+		prog = append(prog, jump(unix.BPF_JGE, x32SyscallBit, 0, 1), kill)
+	}
+	for _, nr := range denied {
+		prog = append(prog, jeq(uint32(nr), 0, 1), errno(unix.EPERM))
+	}
+	return append(prog,
+		jeq(unix.SYS_CLONE3, 0, 1),
+		errno(unix.ENOSYS),
+		jeq(unix.SYS_CLONE, 0, 3),
+		// 两种架构上 clone 的 flags 均为第一个参数，取低 32 位（小端）
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 16),
+		jump(unix.BPF_JSET, cloneNamespaceFlags, 0, 1),
+		errno(unix.EPERM),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+	)
+}
+
+// installSeccomp 为当前线程安装过滤器（需先设置 no_new_privs）
+func installSeccomp() error {
+	arch, err := auditArch()
+	if err != nil {
+		return err
+	}
+	filter := seccompFilter(arch, deniedSyscalls)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
@@ -0,0 +1,847 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xulei1234/x-proto/xps"
+	"golang.org/x/sys/unix"
+)
+
+// 账号/用户组的目标状态
+const (
+	StatePresent = "present" // 默认
+	StateAbsent  = "absent"
+)
+
+// 变更记录的动作
+const (
+	ActionCreated   = "created"
+	ActionModified  = "modified"
+	ActionDeleted   = "deleted"
+	ActionUnchanged = "unchanged"
+)
+
+// AccountRequest Extra.Account：声明式管理本地用户、用户组、authorized_keys 与 sudoers。
+// 先创建/修改用户组，再处理用户，最后删除用户组；重复下发相同请求不会产生变更。
+type AccountRequest struct {
+	Groups []GroupSpec `json:"groups,omitempty"`
+	Users  []UserSpec  `json:"users,omitempty"`
+}
+
+// GroupSpec 本地用户组
+type GroupSpec struct {
+	Name  string `json:"name"`
+	State string `json:"state,omitempty"`
+	GID   *int   `json:"gid,omitempty"`
+}
+
+// UserSpec 本地用户；未设置的字段不做修改
+type UserSpec struct {
+	Name   string   `json:"name"`
+	State  string   `json:"state,omitempty"`
+	UID    *int     `json:"uid,omitempty"`
+	Group  string   `json:"group,omitempty"`  // 主组
+	Groups []string `json:"groups,omitempty"` // 附加组
+	// AppendGroups 为 true 时只补充缺少的附加组，否则附加组与 Groups 完全一致
+	AppendGroups bool   `json:"append_groups,omitempty"`
+	Home         string `json:"home,omitempty"`
+	Shell        string `json:"shell,omitempty"`
+	// Password 明文（经 chpasswd 设置，每次都会重设）；PasswordHash 为 crypt 格式，与 shadow 一致时不修改
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	// AuthorizedKeys 为 nil 时不管理；KeysExclusive 为 true 时文件只保留这些公钥
+	AuthorizedKeys []string  `json:"authorized_keys,omitempty"`
+	KeysExclusive  bool      `json:"keys_exclusive,omitempty"`
+	Sudo           *SudoSpec `json:"sudo,omitempty"`
+	// RemoveHome 删除用户时同时删除家目录
+	RemoveHome bool `json:"remove_home,omitempty"`
+}
+
+// SudoSpec sudoers.d 下的独立配置；Rules 为空表示删除
+type SudoSpec struct {
+	Rules []string `json:"rules"` // 不含用户名前缀，如 "ALL=(ALL) NOPASSWD: ALL"
+}
+
+// AccountChange 一项变更（或确认无需变更）
+type AccountChange struct {
+	Kind   string   `json:"kind"` // group/user/password/authorized_keys/sudoers
+	Name   string   `json:"name"`
+	Action string   `json:"action"`
+	Detail []string `json:"detail,omitempty"`
+}
+
+// AccountResult 账号任务结果，出错时 Error 非空且 Changes 为出错前已完成的变更
+type AccountResult struct {
+	Changed bool            `json:"changed"`
+	Changes []AccountChange `json:"changes"`
+	Error   string          `json:"error,omitempty"`
+}
+
+var accountNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+
+// passwdEntry /etc/passwd 中的一行
+type passwdEntry struct {
+	Name  string
+	UID   int
+	GID   int
+	Home  string
+	Shell string
+}
+
+// groupEntry /etc/group 中的一行
+type groupEntry struct {
+	Name    string
+	GID     int
+	Members []string
+}
+
+// accountManager 执行账号变更；文件路径与命令执行可替换，便于测试
+type accountManager struct {
+	passwdFile string
+	groupFile  string
+	shadowFile string
+	sudoersDir string
+	// run 执行 useradd/usermod 等系统命令，stdin 非空时写入标准输入
+	run func(stdin string, name string, args ...string) error
+
+	res AccountResult
+}
+
+func newAccountManager(ctx context.Context) *accountManager {
+	return &accountManager{
+		passwdFile: "/etc/passwd",
+		groupFile:  "/etc/group",
+		shadowFile: "/etc/shadow",
+		sudoersDir: "/etc/sudoers.d",
+		run: func(stdin string, name string, args ...string) error {
+			cmd := exec.CommandContext(ctx, name, args...)
+			cmd.Env = []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin", "LANG=C"}
+			if stdin != "" {
+				cmd.Stdin = strings.NewReader(stdin)
+			}
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		},
+	}
+}
+
+func (m *accountManager) record(kind, name, action string, detail ...string) {
+	m.res.Changes = append(m.res.Changes, AccountChange{Kind: kind, Name: name, Action: action, Detail: detail})
+	if action != ActionUnchanged {
+		m.res.Changed = true
+	}
+}
+
+// Apply 按顺序执行，遇到错误立即停止
+func (m *accountManager) Apply(req *AccountRequest) error {
+	if req == nil {
+		return fmt.Errorf("missing account request")
+	}
+	if err := validateAccountRequest(req); err != nil {
+		return err
+	}
+
+	for i := range req.Groups {
+		if g := &req.Groups[i]; g.State != StateAbsent {
+			if err := m.ensureGroup(g); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range req.Users {
+		u := &req.Users[i]
+		var err error
+		if u.State == StateAbsent {
+			err = m.removeUser(u)
+		} else {
+			err = m.ensureUser(u)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := range req.Groups {
+		if g := &req.Groups[i]; g.State == StateAbsent {
+			if err := m.removeGroup(g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateAccountRequest(req *AccountRequest) error {
+	checkState := func(kind, name, state string) error {
+		if !accountNameRe.MatchString(name) {
+			return fmt.Errorf("invalid %s name %q", kind, name)
+		}
+		if state != "" && state != StatePresent && state != StateAbsent {
+			return fmt.Errorf("%s %s: invalid state %q", kind, name, state)
+		}
+		return nil
+	}
+	for _, g := range req.Groups {
+		if err := checkState("group", g.Name, g.State); err != nil {
+			return err
+		}
+	}
+	for _, u := range req.Users {
+		if err := checkState("user", u.Name, u.State); err != nil {
+			return err
+		}
+		for _, g := range append([]string{u.Group}, u.Groups...) {
+			if g != "" && !accountNameRe.MatchString(g) {
+				return fmt.Errorf("user %s: invalid group name %q", u.Name, g)
+			}
+		}
+		if strings.ContainsAny(u.Home+u.Shell, ":\n") {
+			return fmt.Errorf("user %s: invalid home or shell", u.Name)
+		}
+		if strings.ContainsAny(u.Password+u.PasswordHash, ":\n") {
+			return fmt.Errorf("user %s: password must not contain ':' or newline", u.Name)
+		}
+		for _, k := range u.AuthorizedKeys {
+			if strings.TrimSpace(k) == "" || strings.ContainsAny(k, "\r\n") {
+				return fmt.Errorf("user %s: authorized key must be a single non-empty line", u.Name)
+			}
+		}
+		if u.Sudo != nil {
+			for _, r := range u.Sudo.Rules {
+				if strings.TrimSpace(r) == "" || strings.ContainsAny(r, "\r\n") {
+					return fmt.Errorf("user %s: sudo rule must be a single non-empty line", u.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *accountManager) ensureGroup(g *GroupSpec) error {
+	cur, err := m.lookupGroup(g.Name)
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		args := []string{}
+		if g.GID != nil {
+			args = append(args, "-g", strconv.Itoa(*g.GID))
+		}
+		if err := m.run("", "groupadd", append(args, g.Name)...); err != nil {
+			return err
+		}
+		m.record("group", g.Name, ActionCreated)
+		return nil
+	}
+	if g.GID != nil && *g.GID != cur.GID {
+		if err := m.run("", "groupmod", "-g", strconv.Itoa(*g.GID), g.Name); err != nil {
+			return err
+		}
+		m.record("group", g.Name, ActionModified, fmt.Sprintf("gid %d -> %d", cur.GID, *g.GID))
+		return nil
+	}
+	m.record("group", g.Name, ActionUnchanged)
+	return nil
+}
+
+func (m *accountManager) removeGroup(g *GroupSpec) error {
+	cur, err := m.lookupGroup(g.Name)
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		m.record("group", g.Name, ActionUnchanged)
+		return nil
+	}
+	if err := m.run("", "groupdel", g.Name); err != nil {
+		return err
+	}
+	m.record("group", g.Name, ActionDeleted)
+	return nil
+}
+
+func (m *accountManager) ensureUser(u *UserSpec) error {
+	cur, err := m.lookupUser(u.Name)
+	if err != nil {
+		return err
+	}
+
+	if cur == nil {
+		args := []string{"-m"}
+		if u.UID != nil {
+			args = append(args, "-u", strconv.Itoa(*u.UID))
+		}
+		if u.Group != "" {
+			args = append(args, "-g", u.Group)
+		}
+		if len(u.Groups) > 0 {
+			args = append(args, "-G", strings.Join(u.Groups, ","))
+		}
+		if u.Home != "" {
+			args = append(args, "-d", u.Home)
+		}
+		if u.Shell != "" {
+			args = append(args, "-s", u.Shell)
+		}
+		if err := m.run("", "useradd", append(args, u.Name)...); err != nil {
+			return err
+		}
+		m.record("user", u.Name, ActionCreated)
+	} else if err := m.modifyUser(u, cur); err != nil {
+		return err
+	}
+
+	// 后续步骤需要最新的 uid/gid/home
+	if cur, err = m.lookupUser(u.Name); err != nil {
+		return err
+	}
+	if cur == nil {
+		return fmt.Errorf("user %s not found after useradd", u.Name)
+	}
+
+	if err := m.ensurePassword(u); err != nil {
+		return err
+	}
+	if u.AuthorizedKeys != nil {
+		if err := m.ensureAuthorizedKeys(u, cur); err != nil {
+			return err
+		}
+	}
+	if u.Sudo != nil {
+		if err := m.ensureSudoers(u.Name, u.Sudo.Rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *accountManager) modifyUser(u *UserSpec, cur *passwdEntry) error {
+	var args, detail []string
+	if u.UID != nil && *u.UID != cur.UID {
+		args = append(args, "-u", strconv.Itoa(*u.UID))
+		detail = append(detail, fmt.Sprintf("uid %d -> %d", cur.UID, *u.UID))
+	}
+	if u.Group != "" {
+		g, err := m.lookupGroup(u.Group)
+		if err != nil {
+			return err
+		}
+		if g == nil || g.GID != cur.GID {
+			args = append(args, "-g", u.Group)
+			detail = append(detail, "primary group -> "+u.Group)
+		}
+	}
+	if u.Home != "" && u.Home != cur.Home {
+		args = append(args, "-d", u.Home, "-m")
+		detail = append(detail, fmt.Sprintf("home %s -> %s", cur.Home, u.Home))
+	}
+	if u.Shell != "" && u.Shell != cur.Shell {
+		args = append(args, "-s", u.Shell)
+		detail = append(detail, fmt.Sprintf("shell %s -> %s", cur.Shell, u.Shell))
+	}
+	if u.Groups != nil {
+		have, err := m.memberOf(u.Name)
+		if err != nil {
+			return err
+		}
+		if u.AppendGroups {
+			var missing []string
+			for _, g := range u.Groups {
+				if !have[g] {
+					missing = append(missing, g)
+				}
+			}
+			if len(missing) > 0 {
+				args = append(args, "-a", "-G", strings.Join(missing, ","))
+				detail = append(detail, "add groups "+strings.Join(missing, ","))
+			}
+		} else if !sameSet(have, u.Groups) {
+			args = append(args, "-G", strings.Join(u.Groups, ","))
+			detail = append(detail, "groups -> "+strings.Join(u.Groups, ","))
+		}
+	}
+
+	if len(args) == 0 {
+		m.record("user", u.Name, ActionUnchanged)
+		return nil
+	}
+	if err := m.run("", "usermod", append(args, u.Name)...); err != nil {
+		return err
+	}
+	m.record("user", u.Name, ActionModified, detail...)
+	return nil
+}
+
+func (m *accountManager) ensurePassword(u *UserSpec) error {
+	switch {
+	case u.PasswordHash != "":
+		if cur, _ := m.shadowHash(u.Name); cur == u.PasswordHash {
+			m.record("password", u.Name, ActionUnchanged)
+			return nil
+		}
+		if err := m.run(u.Name+":"+u.PasswordHash+"\n", "chpasswd", "-e"); err != nil {
+			return err
+		}
+	case u.Password != "":
+		if err := m.run(u.Name+":"+u.Password+"\n", "chpasswd"); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	m.record("password", u.Name, ActionModified)
+	return nil
+}
+
+func (m *accountManager) removeUser(u *UserSpec) error {
+	cur, err := m.lookupUser(u.Name)
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		m.record("user", u.Name, ActionUnchanged)
+	} else {
+		args := []string{}
+		if u.RemoveHome {
+			args = append(args, "-r")
+		}
+		if err := m.run("", "userdel", append(args, u.Name)...); err != nil {
+			return err
+		}
+		m.record("user", u.Name, ActionDeleted)
+	}
+	// 用户不存在时也清理残留的 sudoers 配置
+	return m.ensureSudoers(u.Name, nil)
+}
+
+// ensureAuthorizedKeys 管理 ~/.ssh/authorized_keys，内容不变时不写文件。
+// ~/.ssh 与其中的文件由目标用户控制，均通过目录 fd 以 O_NOFOLLOW 访问，不跟随符号链接
+func (m *accountManager) ensureAuthorizedKeys(u *UserSpec, cur *passwdEntry) error {
+	dir := filepath.Join(cur.Home, ".ssh")
+	sshDir, err := openSSHDir(dir, cur.UID)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if sshDir != nil {
+		defer sshDir.Close()
+	}
+
+	var existing []string
+	if sshDir != nil {
+		b, err := readFileAt(sshDir, "authorized_keys")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				existing = append(existing, line)
+			}
+		}
+	}
+
+	want := make([]string, 0, len(u.AuthorizedKeys))
+	wantSet := map[string]bool{}
+	for _, k := range u.AuthorizedKeys {
+		k = strings.TrimSpace(k)
+		if !wantSet[k] {
+			wantSet[k] = true
+			want = append(want, k)
+		}
+	}
+
+	var final, detail []string
+	if u.KeysExclusive {
+		final = want
+		for _, k := range existing {
+			if !wantSet[k] && !strings.HasPrefix(k, "#") {
+				detail = append(detail, "removed "+keyComment(k))
+			}
+		}
+	} else {
+		final = existing
+	}
+	have := map[string]bool{}
+	for _, k := range existing {
+		have[k] = true
+	}
+	for _, k := range want {
+		if !have[k] {
+			detail = append(detail, "added "+keyComment(k))
+			if !u.KeysExclusive {
+				final = append(final, k)
+			}
+		}
+	}
+
+	if len(detail) == 0 && len(final) == len(existing) {
+		m.record("authorized_keys", u.Name, ActionUnchanged)
+		return nil
+	}
+
+	if sshDir == nil {
+		if sshDir, err = createSSHDir(dir, cur.UID, cur.GID); err != nil {
+			return err
+		}
+		defer sshDir.Close()
+	}
+	content := ""
+	if len(final) > 0 {
+		content = strings.Join(final, "\n") + "\n"
+	}
+	if err := writeFileAt(sshDir, "authorized_keys", []byte(content), 0o600, cur.UID, cur.GID); err != nil {
+		return err
+	}
+	action := ActionModified
+	if len(existing) == 0 {
+		action = ActionCreated
+	}
+	m.record("authorized_keys", u.Name, action, detail...)
+	return nil
+}
+
+// openSSHDir 打开 ~/.ssh：不能是符号链接，且属主必须为目标用户
+func openSSHDir(dir string, uid int) (*os.File, error) {
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if err == unix.ENOENT {
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("open %s (symlink or not a directory?): %w", dir, err)
+	}
+	f := os.NewFile(uintptr(fd), dir)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if int(st.Uid) != uid {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s is owned by uid %d, expected %d", dir, st.Uid, uid)
+	}
+	return f, nil
+}
+
+// createSSHDir 创建 ~/.ssh（0700）并修改属主后重新按 openSSHDir 校验打开
+func createSSHDir(dir string, uid, gid int) (*os.File, error) {
+	if err := unix.Mkdir(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	if err := os.Lchown(dir, uid, gid); err != nil {
+		return nil, err
+	}
+	return openSSHDir(dir, uid)
+}
+
+// readFileAt 读取目录下的普通文件，符号链接返回错误
+func readFileAt(dir *os.File, name string) ([]byte, error) {
+	// O_NONBLOCK 避免打开 FIFO 时阻塞
+	fd, err := unix.Openat(int(dir.Fd()), name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if err == unix.ENOENT {
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("open %s/%s: %w", dir.Name(), name, err)
+	}
+	f := os.NewFile(uintptr(fd), filepath.Join(dir.Name(), name))
+	defer f.Close()
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return nil, err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFREG {
+		return nil, fmt.Errorf("%s is not a regular file", f.Name())
+	}
+	return io.ReadAll(f)
+}
+
+// writeFileAt 在目录 fd 中写临时文件并 rename 替换 name，属主与权限经 fd 设置
+func writeFileAt(dir *os.File, name string, data []byte, mode os.FileMode, uid, gid int) error {
+	dfd := int(dir.Fd())
+	tmp := fmt.Sprintf(".%s.%d.%d.tmp", name, os.Getpid(), time.Now().UnixNano())
+	fd, err := unix.Openat(dfd, tmp, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create %s/%s: %w", dir.Name(), tmp, err)
+	}
+	f := os.NewFile(uintptr(fd), filepath.Join(dir.Name(), tmp))
+	defer unix.Unlinkat(dfd, tmp, 0)
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chown(uid, gid); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return unix.Renameat(dfd, tmp, dfd, name)
+}
+
+// keyComment 用公钥注释（或末尾片段）标识一把 key，避免结果中出现完整公钥
+func keyComment(key string) string {
+	f := strings.Fields(key)
+	if len(f) >= 3 {
+		return f[len(f)-1]
+	}
+	if len(key) > 16 {
+		return "..." + key[len(key)-16:]
+	}
+	return key
+}
+
+// sudoersPath sudo 会忽略包含 '.' 或以 '~' 结尾的文件名；'.' 替换为用户名中不允许出现的 '+'，
+// 保证不同用户名对应不同文件（不含 '.' 的用户名路径不变）
+func (m *accountManager) sudoersPath(user string) string {
+	return filepath.Join(m.sudoersDir, "x-agent-"+strings.ReplaceAll(user, ".", "+"))
+}
+
+// removeLegacySudoers 旧版本将 '.' 替换为 '_'（a.b 与 a_b 冲突），仅当旧文件中的规则全部属于 user 时删除
+func (m *accountManager) removeLegacySudoers(user string) error {
+	if !strings.Contains(user, ".") {
+		return nil
+	}
+	path := filepath.Join(m.sudoersDir, "x-agent-"+strings.ReplaceAll(user, ".", "_"))
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) < 2 || lines[0] != sudoersHeader {
+		return nil
+	}
+	for _, l := range lines[1:] {
+		if !strings.HasPrefix(l, user+" ") {
+			return nil
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	m.record("sudoers", user, ActionDeleted, "legacy "+filepath.Base(path))
+	return nil
+}
+
+const sudoersHeader = "# managed by x-agent, do not edit"
+
+// ensureSudoers 写入 sudoers.d 独立配置（先 visudo -c 校验临时文件），rules 为空时删除
+func (m *accountManager) ensureSudoers(user string, rules []string) error {
+	if err := m.removeLegacySudoers(user); err != nil {
+		return err
+	}
+	path := m.sudoersPath(user)
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+
+	if len(rules) == 0 {
+		if !exists {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		m.record("sudoers", user, ActionDeleted)
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString(sudoersHeader + "\n")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "%s %s\n", user, strings.TrimSpace(r))
+	}
+	content := b.String()
+	if exists && string(old) == content {
+		m.record("sudoers", user, ActionUnchanged)
+		return nil
+	}
+
+	err = writeFileAtomic(path, []byte(content), 0o440, func(tmp string) error {
+		if err := m.run("", "visudo", "-c", "-q", "-f", tmp); err != nil {
+			return fmt.Errorf("sudoers validation failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	action := ActionCreated
+	if exists {
+		action = ActionModified
+	}
+	m.record("sudoers", user, action, rules...)
+	return nil
+}
+
+// writeFileAtomic 写临时文件（文件名含 '.'，不会被 sudo 读取），check 通过后 rename
+func writeFileAtomic(path string, data []byte, mode os.FileMode, check func(tmp string) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(tmp); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+func sameSet(have map[string]bool, want []string) bool {
+	w := map[string]bool{}
+	for _, g := range want {
+		w[g] = true
+	}
+	if len(w) != len(have) {
+		return false
+	}
+	for g := range w {
+		if !have[g] {
+			return false
+		}
+	}
+	return true
+}
+
+// readColonFile 按行读取 /etc/passwd 格式文件
+func readColonFile(path string, minFields int, fn func(f []string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if f := strings.Split(line, ":"); len(f) >= minFields {
+			fn(f)
+		}
+	}
+	return sc.Err()
+}
+
+func (m *accountManager) lookupUser(name string) (*passwdEntry, error) {
+	return lookupPasswd(m.passwdFile, name)
+}
+
+// lookupPasswd 在 passwd 格式文件中查找用户，不存在时返回 nil
+func lookupPasswd(file, name string) (*passwdEntry, error) {
+	var found *passwdEntry
+	err := readColonFile(file, 7, func(f []string) {
+		if f[0] == name && found == nil {
+			uid, _ := strconv.Atoi(f[2])
+			gid, _ := strconv.Atoi(f[3])
+			found = &passwdEntry{Name: f[0], UID: uid, GID: gid, Home: f[5], Shell: f[6]}
+		}
+	})
+	return found, err
+}
+
+func (m *accountManager) lookupGroup(name string) (*groupEntry, error) {
+	var found *groupEntry
+	err := m.eachGroup(func(g *groupEntry) {
+		if g.Name == name && found == nil {
+			found = g
+		}
+	})
+	return found, err
+}
+
+func (m *accountManager) eachGroup(fn func(g *groupEntry)) error {
+	return readColonFile(m.groupFile, 4, func(f []string) {
+		gid, _ := strconv.Atoi(f[2])
+		var members []string
+		if f[3] != "" {
+			members = strings.Split(f[3], ",")
+		}
+		fn(&groupEntry{Name: f[0], GID: gid, Members: members})
+	})
+}
+
+// memberOf 用户所在的附加组
+func (m *accountManager) memberOf(user string) (map[string]bool, error) {
+	set := map[string]bool{}
+	err := m.eachGroup(func(g *groupEntry) {
+		for _, mem := range g.Members {
+			if mem == user {
+				set[g.Name] = true
+			}
+		}
+	})
+	return set, err
+}
+
+func (m *accountManager) shadowHash(user string) (string, error) {
+	var hash string
+	err := readColonFile(m.shadowFile, 2, func(f []string) {
+		if f[0] == user {
+			hash = f[1]
+		}
+	})
+	return hash, err
+}
+
+// runAccount 执行账号管理任务，结果为 AccountResult json
+func (g *GrpcMgr) runAccount(ctx context.Context, id string, code uint32, req *AccountRequest, l *logrus.Entry) {
+	m := newAccountManager(ctx)
+	err := m.Apply(req)
+	if err != nil {
+		m.res.Error = err.Error()
+	}
+	if m.res.Changes == nil {
+		m.res.Changes = []AccountChange{}
+	}
+
+	b, _ := json.Marshal(m.res)
+	body := &xps.Body{Stdout: b}
+	status := xps.Status_SUCC
+	if err != nil {
+		l.WithError(err).Warn("runAccount: failed")
+		body.Code = -1
+		body.Stderr = []byte(err.Error())
+		status = xps.Status_FAIL
+	} else {
+		l.WithField("changed", m.res.Changed).Infoln("runAccount: done")
+	}
+	g.sendResult(id, code, body, status)
+}
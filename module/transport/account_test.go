@@ -0,0 +1,260 @@
+package transport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestAccountManager(t *testing.T, passwd, group string) (*accountManager, *[]string) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	sudoers := filepath.Join(dir, "sudoers.d")
+	if err := os.Mkdir(sudoers, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	m := &accountManager{
+		passwdFile: write("passwd", passwd),
+		groupFile:  write("group", group),
+		shadowFile: write("shadow", "alice:$6$old:19000:0:99999:7:::\n"),
+		sudoersDir: sudoers,
+		run: func(stdin string, name string, args ...string) error {
+			calls = append(calls, strings.TrimSpace(name+" "+strings.Join(args, " ")))
+			if name == "useradd" {
+				// 模拟 useradd 写入 passwd
+				f, _ := os.OpenFile(filepath.Join(dir, "passwd"), os.O_APPEND|os.O_WRONLY, 0)
+				_, _ = f.WriteString(args[len(args)-1] + ":x:1500:1500::" + filepath.Join(dir, "home") + ":/bin/sh\n")
+				_ = f.Close()
+			}
+			if name == "visudo" {
+				b, _ := os.ReadFile(args[len(args)-1])
+				if strings.Contains(string(b), "BAD") {
+					return errors.New("visudo: syntax error")
+				}
+			}
+			return nil
+		},
+	}
+	return m, &calls
+}
+
+func TestAccountManager_UsersAndGroups(t *testing.T) {
+	home := t.TempDir()
+	passwd := "root:x:0:0:root:/root:/bin/bash\nalice:x:1001:1001::" + home + ":/bin/sh\n"
+	group := "root:x:0:\nalice:x:1001:\nops:x:2000:alice\ndev:x:2001:\n"
+	m, calls := newTestAccountManager(t, passwd, group)
+
+	gid := 2000
+	err := m.Apply(&AccountRequest{
+		Groups: []GroupSpec{{Name: "ops", GID: &gid}, {Name: "qa"}, {Name: "old", State: StateAbsent}},
+		Users: []UserSpec{
+			{Name: "alice", Shell: "/bin/bash", Groups: []string{"ops", "dev"}, AppendGroups: true, PasswordHash: "$6$old"},
+			{Name: "bob", Group: "ops", Groups: []string{"dev"}, Home: "/data/bob"},
+			{Name: "carol", State: StateAbsent},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"groupadd qa",
+		"usermod -s /bin/bash -a -G dev alice",
+		"useradd -m -g ops -G dev -d /data/bob bob",
+	}
+	if strings.Join(*calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("calls=%q\nwant=%q", *calls, want)
+	}
+	actions := []string{}
+	for _, c := range m.res.Changes {
+		actions = append(actions, c.Kind+":"+c.Name+":"+c.Action)
+	}
+	wantActions := "group:ops:unchanged group:qa:created user:alice:modified password:alice:unchanged " +
+		"user:bob:created user:carol:unchanged group:old:unchanged"
+	if got := strings.Join(actions, " "); got != wantActions || !m.res.Changed {
+		t.Fatalf("changes=%s", got)
+	}
+}
+
+func TestAccountManager_ValidateRejectsInjection(t *testing.T) {
+	m, calls := newTestAccountManager(t, "", "")
+	for _, req := range []*AccountRequest{
+		{Users: []UserSpec{{Name: "Root;rm"}}},
+		{Users: []UserSpec{{Name: "bob", AuthorizedKeys: []string{"ssh-ed25519 AAA\nssh-rsa BBB"}}}},
+		{Users: []UserSpec{{Name: "bob", Sudo: &SudoSpec{Rules: []string{"ALL=(ALL) ALL\nevil ALL=(ALL) ALL"}}}}},
+		{Groups: []GroupSpec{{Name: "ops", State: "gone"}}},
+	} {
+		if err := m.Apply(req); err == nil {
+			t.Fatalf("expected validation error for %+v", req)
+		}
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("no command should run, calls=%v", *calls)
+	}
+}
+
+func TestAccountManager_AuthorizedKeys(t *testing.T) {
+	home := t.TempDir()
+	// ~/.ssh 的属主需为目标用户，使用当前 uid
+	uid := strconv.Itoa(os.Getuid())
+	m, _ := newTestAccountManager(t, "alice:x:"+uid+":"+uid+"::"+home+":/bin/sh\n", "alice:x:"+uid+":\n")
+	cur, _ := m.lookupUser("alice")
+	path := filepath.Join(home, ".ssh", "authorized_keys")
+
+	u := &UserSpec{Name: "alice", AuthorizedKeys: []string{"ssh-ed25519 AAA a@x", "ssh-ed25519 BBB b@x"}}
+	if err := m.ensureAuthorizedKeys(u, cur); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ensureAuthorizedKeys(u, cur); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.res.Changes[len(m.res.Changes)-1].Action; got != ActionUnchanged {
+		t.Fatalf("second apply should be unchanged, got=%s", got)
+	}
+
+	// 非独占：保留已有公钥，只追加
+	u = &UserSpec{Name: "alice", AuthorizedKeys: []string{"ssh-ed25519 CCC c@x"}}
+	if err := m.ensureAuthorizedKeys(u, cur); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Count(string(b), "\n") != 3 {
+		t.Fatalf("expected 3 keys, got=%q", b)
+	}
+
+	// 独占：只保留声明的公钥
+	u = &UserSpec{Name: "alice", AuthorizedKeys: []string{"ssh-ed25519 BBB b@x"}, KeysExclusive: true}
+	if err := m.ensureAuthorizedKeys(u, cur); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(path)
+	if string(b) != "ssh-ed25519 BBB b@x\n" {
+		t.Fatalf("got=%q", b)
+	}
+	last := m.res.Changes[len(m.res.Changes)-1]
+	if len(last.Detail) != 2 || !strings.Contains(strings.Join(last.Detail, ","), "removed a@x") {
+		t.Fatalf("unexpected detail %v", last.Detail)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("mode=%v", fi.Mode())
+	}
+}
+
+func TestAccountManager_AuthorizedKeysSymlink(t *testing.T) {
+	home, outside := t.TempDir(), t.TempDir()
+	uid := strconv.Itoa(os.Getuid())
+	m, _ := newTestAccountManager(t, "alice:x:"+uid+":"+uid+"::"+home+":/bin/sh\n", "alice:x:"+uid+":\n")
+	cur, _ := m.lookupUser("alice")
+	u := &UserSpec{Name: "alice", AuthorizedKeys: []string{"ssh-ed25519 AAA a@x"}}
+
+	// ~/.ssh 为符号链接
+	if err := os.Symlink(outside, filepath.Join(home, ".ssh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ensureAuthorizedKeys(u, cur); err == nil {
+		t.Fatalf("expected error for symlinked ~/.ssh")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "authorized_keys")); !os.IsNotExist(err) {
+		t.Fatalf("should not write through symlink, err=%v", err)
+	}
+
+	// authorized_keys 为符号链接
+	_ = os.Remove(filepath.Join(home, ".ssh"))
+	if err := os.Mkdir(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(outside, "shadow")
+	if err := os.WriteFile(target, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(home, ".ssh", "authorized_keys")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ensureAuthorizedKeys(u, cur); err == nil {
+		t.Fatalf("expected error for symlinked authorized_keys")
+	}
+	if b, _ := os.ReadFile(target); string(b) != "secret\n" {
+		t.Fatalf("target modified: %q", b)
+	}
+
+	// ~/.ssh 属主不是目标用户
+	if os.Geteuid() == 0 {
+		_ = os.Remove(filepath.Join(home, ".ssh", "authorized_keys"))
+		if err := os.Chown(filepath.Join(home, ".ssh"), 12345, 12345); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.ensureAuthorizedKeys(u, cur); err == nil || !strings.Contains(err.Error(), "owned by uid 12345") {
+			t.Fatalf("expected owner error, err=%v", err)
+		}
+	}
+}
+
+func TestAccountManager_Sudoers(t *testing.T) {
+	m, calls := newTestAccountManager(t, "", "")
+	path := m.sudoersPath("deploy.bot")
+	if filepath.Base(path) != "x-agent-deploy+bot" || m.sudoersPath("deploy_bot") == path {
+		t.Fatalf("sudo ignores names with '.', got=%s", path)
+	}
+
+	// 旧版本的文件：只删除 deploy.bot 自己的，deploy_bot 的保留
+	legacy := filepath.Join(m.sudoersDir, "x-agent-deploy_bot")
+	if err := os.WriteFile(legacy, []byte(sudoersHeader+"\ndeploy_bot ALL=(ALL) ALL\n"), 0o440); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.removeLegacySudoers("deploy.bot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Fatalf("other user's sudoers removed: %v", err)
+	}
+	if err := os.WriteFile(legacy, []byte(sudoersHeader+"\ndeploy.bot ALL=(ALL) ALL\n"), 0o440); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ensureSudoers("deploy.bot", []string{"ALL=(ALL) NOPASSWD: ALL"}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if !strings.Contains(string(b), "deploy.bot ALL=(ALL) NOPASSWD: ALL\n") {
+		t.Fatalf("got=%q", b)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("legacy sudoers should be removed, err=%v", err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o440 {
+		t.Fatalf("mode=%v", fi.Mode())
+	}
+	if len(*calls) != 1 || !strings.HasPrefix((*calls)[0], "visudo -c") {
+		t.Fatalf("expected visudo check, calls=%v", *calls)
+	}
+
+	// 校验失败时保留原文件，且不留下临时文件
+	if err := m.ensureSudoers("deploy.bot", []string{"BAD rule"}); err == nil {
+		t.Fatalf("expected validation error")
+	}
+	if b2, _ := os.ReadFile(path); string(b2) != string(b) {
+		t.Fatalf("file changed after failed validation")
+	}
+	if entries, _ := os.ReadDir(m.sudoersDir); len(entries) != 1 {
+		t.Fatalf("leftover files: %v", entries)
+	}
+
+	if err := m.ensureSudoers("deploy.bot", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected sudoers removed")
+	}
+}
@@ -0,0 +1,418 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+// collectorNamePattern 命名空间：小写字母、数字、'_'、'-'
+var collectorNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// collectorManifest Collector.Dir 下的 <name>.json，声明一个采集插件
+type collectorManifest struct {
+	Name     string   `json:"name,omitempty"` // 命名空间，默认为清单文件名
+	Exec     string   `json:"exec,omitempty"` // 可执行文件，相对路径基于 Collector.Dir，默认为与清单同名的文件
+	Args     []string `json:"args,omitempty"`
+	Schedule string   `json:"schedule,omitempty"` // cron 表达式或 @every <duration>，默认 Collector.DefaultSchedule
+	Timeout  string   `json:"timeout,omitempty"`  // 默认 Collector.DefaultTimeout
+	User     string   `json:"user,omitempty"`     // 执行用户，默认 agent 当前用户
+}
+
+// collectorStatus 插件最近一次执行情况（上报内容的 collectors 部分）
+type collectorStatus struct {
+	Exec     string `json:"exec"`
+	Schedule string `json:"schedule"`
+	Error    string `json:"error,omitempty"` // 最近一次执行失败的原因；失败时保留上次成功的 facts
+}
+
+// collector 已加载的插件与运行状态
+type collector struct {
+	collectorManifest
+	raw     []byte // 清单原文，变化时重新加载
+	path    string
+	spec    *common.CronSpec
+	timeout time.Duration
+
+	next    time.Time
+	running bool
+	facts   json.RawMessage // 最近一次成功输出的 JSON 对象
+	err     string
+}
+
+// factsInventory 插件 facts 全量内容，按命名空间合并
+type factsInventory struct {
+	Facts      map[string]json.RawMessage `json:"facts"`
+	Collectors map[string]collectorStatus `json:"collectors"`
+}
+
+// collectorSet Collector.Dir 下的全部插件，每次 Reload 重新扫描目录，新增/修改/删除清单无需重启
+type collectorSet struct {
+	dir             string
+	defaultSchedule string
+	defaultTimeout  time.Duration
+
+	mu    sync.Mutex
+	items map[string]*collector
+	// seen 曾加载过插件：全部删除后仍需上报一次清空
+	seen bool
+}
+
+func newCollectorSet(dir, defaultSchedule string, defaultTimeout time.Duration) *collectorSet {
+	if defaultTimeout <= 0 {
+		defaultTimeout = 30 * time.Second
+	}
+	return &collectorSet{dir: dir, defaultSchedule: defaultSchedule, defaultTimeout: defaultTimeout, items: make(map[string]*collector)}
+}
+
+// checkCollectorFile agent 以 root 执行插件：路径上每一级（文件本身及全部父目录）都不能是符号链接，
+// 须为 root（或 agent 自身）所有，且组/其他用户不可写（root 所有的 sticky 目录如 /tmp 除外），
+// 否则其他用户可替换父目录中的条目来执行任意程序
+func checkCollectorFile(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		if err := checkCollectorPathElem(p, p == path); err != nil {
+			return err
+		}
+		if p == filepath.Dir(p) {
+			return nil
+		}
+	}
+}
+
+func checkCollectorPathElem(p string, leaf bool) error {
+	fi, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s: is a symlink", p)
+	}
+	uid := uint32(os.Geteuid())
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if st.Uid != 0 && st.Uid != uid {
+			return fmt.Errorf("%s: owned by uid %d", p, st.Uid)
+		}
+		uid = st.Uid
+	}
+	if fi.Mode().Perm()&0o022 != 0 {
+		if !leaf && fi.IsDir() && fi.Mode()&os.ModeSticky != 0 && uid == 0 {
+			return nil
+		}
+		return fmt.Errorf("%s: writable by group or others (%v)", p, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// loadCollector 解析并校验清单
+func (s *collectorSet) loadCollector(manifestPath string, raw []byte) (*collector, error) {
+	c := &collector{raw: raw}
+	if err := json.Unmarshal(raw, &c.collectorManifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(manifestPath), ".json")
+	if c.Name == "" {
+		c.Name = base
+	}
+	if !collectorNamePattern.MatchString(c.Name) {
+		return nil, fmt.Errorf("invalid name %q", c.Name)
+	}
+	if c.Exec == "" {
+		c.Exec = base
+	}
+	c.path = c.Exec
+	if !filepath.IsAbs(c.path) {
+		c.path = filepath.Join(s.dir, c.path)
+	}
+	if err := checkCollectorFile(c.path); err != nil {
+		return nil, err
+	}
+	if fi, _ := os.Lstat(c.path); fi == nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+		return nil, fmt.Errorf("%s: not an executable file", c.path)
+	}
+
+	if c.Schedule == "" {
+		c.Schedule = s.defaultSchedule
+	}
+	spec, err := common.ParseCron(c.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	c.spec = spec
+	c.timeout = s.defaultTimeout
+	if c.Timeout != "" {
+		if c.timeout, err = time.ParseDuration(c.Timeout); err != nil || c.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", c.Timeout)
+		}
+	}
+	return c, nil
+}
+
+// Reload 重新扫描清单：未变化的插件保留运行状态，新增或修改的插件立即执行一次
+func (s *collectorSet) Reload(now time.Time) {
+	loaded := make(map[string]*collector)
+	if err := checkCollectorFile(s.dir); err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).Warn("collectors: unsafe collectors dir, skip")
+		}
+	} else {
+		paths, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+		sort.Strings(paths)
+		for _, p := range paths {
+			l := logrus.WithField("manifest", p)
+			if err := checkCollectorFile(p); err != nil {
+				l.WithError(err).Warn("collectors: skip manifest")
+				continue
+			}
+			raw, err := os.ReadFile(p)
+			if err != nil {
+				l.WithError(err).Warn("collectors: read manifest failed")
+				continue
+			}
+			s.mu.Lock()
+			old := s.items[manifestName(raw, p)]
+			s.mu.Unlock()
+			if old != nil && bytes.Equal(old.raw, raw) {
+				loaded[old.Name] = old
+				continue
+			}
+			c, err := s.loadCollector(p, raw)
+			if err != nil {
+				l.WithError(err).Warn("collectors: skip manifest")
+				continue
+			}
+			if _, dup := loaded[c.Name]; dup {
+				l.WithField("name", c.Name).Warn("collectors: duplicated name, skip manifest")
+				continue
+			}
+			c.next = now
+			if old != nil {
+				c.facts, c.err = old.facts, old.err
+			}
+			loaded[c.Name] = c
+			l.WithFields(logrus.Fields{"name": c.Name, "schedule": c.Schedule}).Info("collectors: loaded")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = loaded
+	if len(loaded) > 0 {
+		s.seen = true
+	}
+}
+
+// manifestName 与 loadCollector 一致的命名空间，用于匹配已加载的插件
+func manifestName(raw []byte, path string) string {
+	var m collectorManifest
+	_ = json.Unmarshal(raw, &m)
+	if m.Name != "" {
+		return m.Name
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".json")
+}
+
+// Due 返回到期且未在运行的插件并标记为运行中
+func (s *collectorSet) Due(now time.Time) []*collector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*collector
+	for _, c := range s.items {
+		if c.running || now.Before(c.next) {
+			continue
+		}
+		c.running = true
+		c.next = c.spec.Next(now)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Done 记录执行结果；失败时保留上次成功的 facts
+func (s *collectorSet) Done(c *collector, facts json.RawMessage, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.running = false
+	if err != nil {
+		c.err = err.Error()
+		return
+	}
+	c.facts, c.err = facts, ""
+}
+
+// Active 有插件或曾经有插件（需要上报清空）
+func (s *collectorSet) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items) > 0 || s.seen
+}
+
+// Inventory 合并全部插件的 facts：每个命名空间一个 section（facts.<name>），按顶层 key 比较
+func (s *collectorSet) Inventory() (*factsInventory, snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	full := &factsInventory{Facts: make(map[string]json.RawMessage), Collectors: make(map[string]collectorStatus)}
+	snap := snapshot{"collectors": {}}
+	for name, c := range s.items {
+		st := collectorStatus{Exec: c.path, Schedule: c.Schedule, Error: c.err}
+		full.Collectors[name] = st
+		snap.setItem("collectors", name, st)
+		if c.facts == nil {
+			continue
+		}
+		full.Facts[name] = c.facts
+		var top map[string]json.RawMessage
+		_ = json.Unmarshal(c.facts, &top)
+		snap["facts."+name] = top
+	}
+	return full, snap
+}
+
+// parseFacts 插件 stdout 须为 JSON 对象
+func parseFacts(out []byte) (json.RawMessage, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(out, &top); err != nil || top == nil {
+		return nil, fmt.Errorf("stdout is not a JSON object: %v", err)
+	}
+	// 规范化（去掉缩进、键排序），避免格式差异被当作变化
+	return json.Marshal(top)
+}
+
+// collectorOutput 插件 stdout 缓冲：超过 max 字节后拒绝写入并调用 onExceed 结束插件，
+// 避免输出无限增长占满内存。不内嵌 bytes.Buffer：否则 io.Copy 会走 ReadFrom 绕过上限检查
+type collectorOutput struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+	onExceed func()
+}
+
+func (b *collectorOutput) Write(p []byte) (int, error) {
+	if !b.exceeded && b.buf.Len()+len(p) > b.max {
+		b.exceeded = true
+		b.onExceed()
+	}
+	if b.exceeded {
+		return 0, fmt.Errorf("stdout exceeds %d bytes", b.max)
+	}
+	return b.buf.Write(p)
+}
+
+// runCollector 以清单声明的用户与超时执行插件，stdout 超过 Cmd.MaxOutputBytes 视为失败
+func (g *GrpcMgr) runCollector(c *collector) (json.RawMessage, error) {
+	// 清单未变化时不会重新加载，执行前再次校验可执行文件
+	if err := checkCollectorFile(c.path); err != nil {
+		return nil, err
+	}
+	extra := &TaskExtra{}
+	extra.User = c.User
+	ra, err := lookupRunAs(extra)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	vars := g.newTaskVars("", nil, false)
+	env := append(vars.Env(), "X_AGENT_COLLECTOR="+c.Name)
+	cmd, err := g.newTaskCmd(ctx, c.path, c.Args, filepath.Dir(c.path), env, ra)
+	if err != nil {
+		return nil, err
+	}
+	if ra.Sandbox == nil && ra.Container == nil {
+		// 超时结束整个进程组，避免插件派生的子进程残留
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Setpgid = true
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}
+	// 子进程继承 stdout 后仍存活时不无限等待
+	cmd.WaitDelay = time.Second
+	stdout := &collectorOutput{max: common.MaxOutputBytes(), onExceed: cancel}
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if stdout.exceeded {
+			return nil, fmt.Errorf("stdout exceeds %d bytes", stdout.max)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timeout after %s", c.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, truncateString(msg, 512))
+		}
+		return nil, err
+	}
+	if stdout.exceeded {
+		return nil, fmt.Errorf("stdout exceeds %d bytes", stdout.max)
+	}
+	return parseFacts(stdout.buf.Bytes())
+}
+
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// RunCollectors 重新加载清单并异步执行到期的插件
+func (g *GrpcMgr) RunCollectors() {
+	now := time.Now()
+	g.collectors.Reload(now)
+	for _, c := range g.collectors.Due(now) {
+		go func(c *collector) {
+			facts, err := g.runCollector(c)
+			if err != nil {
+				logrus.WithError(err).WithField("collector", c.Name).Warn("RunCollectors: collector failed")
+			}
+			g.collectors.Done(c, facts, err)
+		}(c)
+	}
+}
+
+// SendFacts 插件 facts 变化时上报增量（kind=facts），首次、重连后及每 IntervalTick.FactsFull 上报全量
+func (g *GrpcMgr) SendFacts() {
+	if !g.collectors.Active() {
+		return
+	}
+	full, snap := g.collectors.Inventory()
+	msg, commit, err := g.facts.Next(full, snap, time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	if msg == nil {
+		return
+	}
+
+	timeout := viper.GetDuration("Timeout.Report")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := g.client.Msg(ctx, msg); err != nil {
+		logrus.Errorln("SendFacts: g.client.Msg failed = ", err.Error())
+		return
+	}
+	commit()
+	logrus.WithFields(logrus.Fields{"collectors": len(full.Collectors), "bytes": len(msg.Body.Stdout)}).Infoln("SendFacts: g.client.Msg success")
+}
@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func writeCollector(t *testing.T, dir, name, manifest, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if script != "" {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectorSet_ReloadAndRun(t *testing.T) {
+	dir := t.TempDir()
+	writeCollector(t, dir, "raid", `{"schedule":"@every 10m","timeout":"5s"}`,
+		"#!/bin/sh\necho '{\"controller\": \"megaraid\", \"arrays\": [{\"level\": 1}], \"collector\": \"'$X_AGENT_COLLECTOR'\"}'\n")
+	writeCollector(t, dir, "broken", `{"exec":"missing.sh"}`, "")
+	writeCollector(t, dir, "Bad Name", `{"name":"Bad Name"}`, "#!/bin/sh\necho {}\n")
+
+	s := newCollectorSet(dir, "@every 1h", time.Second)
+	now := time.Unix(1700000000, 0)
+	s.Reload(now)
+	if len(s.items) != 1 || s.items["raid"] == nil {
+		t.Fatalf("items=%v", s.items)
+	}
+
+	due := s.Due(now)
+	if len(due) != 1 {
+		t.Fatalf("due=%v", due)
+	}
+	if len(s.Due(now)) != 0 {
+		t.Fatalf("running collector should not be due again")
+	}
+	facts, err := gMgr.runCollector(due[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Done(due[0], facts, nil)
+	if len(s.Due(now.Add(5*time.Minute))) != 0 || len(s.Due(now.Add(10*time.Minute))) != 1 {
+		t.Fatalf("schedule not respected")
+	}
+
+	full, snap := s.Inventory()
+	var got map[string]interface{}
+	if err := json.Unmarshal(full.Facts["raid"], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["controller"] != "megaraid" || got["collector"] != "raid" {
+		t.Fatalf("facts=%s", full.Facts["raid"])
+	}
+	if _, ok := snap["facts.raid"]["arrays"]; !ok {
+		t.Fatalf("snapshot=%v", snap)
+	}
+
+	// 失败时保留上次的 facts，记录错误
+	s.Done(s.items["raid"], nil, os.ErrDeadlineExceeded)
+	full, _ = s.Inventory()
+	if full.Facts["raid"] == nil || full.Collectors["raid"].Error == "" {
+		t.Fatalf("full=%+v", full)
+	}
+
+	// 删除清单后不再上报该命名空间
+	_ = os.Remove(filepath.Join(dir, "raid.json"))
+	s.Reload(now)
+	full, _ = s.Inventory()
+	if len(full.Facts) != 0 || !s.Active() {
+		t.Fatalf("full=%+v active=%v", full, s.Active())
+	}
+}
+
+func TestCollectorSet_RejectsUnsafeFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeCollector(t, dir, "gpu", `{}`, "#!/bin/sh\necho {}\n")
+	if err := os.Chmod(filepath.Join(dir, "gpu"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+
+	// 父目录可被其他用户写入
+	if err := os.Mkdir(filepath.Join(dir, "bin"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "bin"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("#!/bin/sh\necho {}\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeCollector(t, dir, "nested", `{"exec":"bin/tool"}`, "")
+
+	// 绝对路径 exec 位于不安全目录
+	other := t.TempDir()
+	if err := os.Chmod(other, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(other, "abs"), []byte("#!/bin/sh\necho {}\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeCollector(t, dir, "abs", `{"exec":"`+filepath.Join(other, "abs")+`"}`, "")
+
+	// 可执行文件为符号链接
+	writeCollector(t, dir, "real", `{"schedule":"@every 1h"}`, "#!/bin/sh\necho {}\n")
+	writeCollector(t, dir, "link", `{"exec":"link-target"}`, "")
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "link-target")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCollectorSet(dir, "@every 1h", time.Second)
+	s.Reload(time.Now())
+	if len(s.items) != 1 || s.items["real"] == nil {
+		t.Fatalf("only the safe collector should be loaded, items=%v", s.items)
+	}
+
+	// 加载后可执行文件变得不安全：执行前再次校验
+	if err := os.Chmod(filepath.Join(dir, "real"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gMgr.runCollector(s.items["real"]); err == nil {
+		t.Fatalf("expected unsafe collector to be rejected at run time")
+	}
+}
+
+func TestRunCollector_OutputLimit(t *testing.T) {
+	viper.Set("Cmd.MaxOutputBytes", 1024)
+	defer viper.Set("Cmd.MaxOutputBytes", nil)
+
+	dir := t.TempDir()
+	writeCollector(t, dir, "flood", `{"timeout":"10s"}`, "#!/bin/sh\nwhile :; do echo '{\"k\": 1}'; done\n")
+	s := newCollectorSet(dir, "@every 1h", time.Second)
+	s.Reload(time.Now())
+
+	start := time.Now()
+	_, err := gMgr.runCollector(s.items["flood"])
+	if err == nil || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+		t.Fatalf("err=%v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("collector not stopped after exceeding the limit")
+	}
+}
+
+func TestRunCollector_InvalidOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeCollector(t, dir, "text", `{}`, "#!/bin/sh\necho not json\n")
+	writeCollector(t, dir, "slow", `{"timeout":"200ms"}`, "#!/bin/sh\nsleep 5\n")
+	s := newCollectorSet(dir, "@every 1h", time.Second)
+	s.Reload(time.Now())
+	for _, name := range []string{"text", "slow"} {
+		if _, err := gMgr.runCollector(s.items[name]); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
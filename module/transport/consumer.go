@@ -7,18 +7,19 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/xulei1234/x-agent/module/common"
+	"github.com/xulei1234/x-agent/module/sandbox"
 	proto "github.com/xulei1234/x-proto"
 	"github.com/xulei1234/x-proto/xps"
+	"io"
 	"os"
 	"os/exec"
-	"os/user"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 )
 
-func (g *GrpcMgr) ConsumerCmd(cr *xps.CmdReply) {
+// ConsumerCmd 执行任务；lock 为队列中已获取的命名锁及等待时长（未声明锁时为 nil），附加在执行结果中
+func (g *GrpcMgr) ConsumerCmd(cr *xps.CmdReply, lock *lockRecord) {
 	if cr == nil || cr.GetCmd() == nil {
 		logrus.Warn("ConsumerCmds: nil command")
 		return
@@ -27,7 +28,7 @@ func (g *GrpcMgr) ConsumerCmd(cr *xps.CmdReply) {
 	tasklog := logrus.WithField("task_id", cr.Id)
 
 	// 解析Extra参数
-	cmdExtra := proto.CmdExtra{}
+	cmdExtra := TaskExtra{}
 	if extra := cr.GetCmd().GetExtra(); len(extra) > 0 {
 		if err := json.Unmarshal(extra, &cmdExtra); err != nil {
 			tasklog.WithError(err).Warn("ConsumerCmds: unmarshal extra, use default settings")
@@ -37,73 +38,304 @@ func (g *GrpcMgr) ConsumerCmd(cr *xps.CmdReply) {
 	// timeout：优先 Extra.Timeout，失败则使用配置兜底
 	cmdTimeout := parseCmdTimeout(cmdExtra.Timeout, viper.GetDuration("Timeout.CmdRun"), tasklog)
 
+	var pos int32
+	if lock != nil {
+		tasklog = tasklog.WithFields(logrus.Fields{"locks": strings.Join(lock.Locks, ","), "lock_wait_ms": lock.WaitMs})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, cr.GetCmd().GetName(), cr.GetCmd().GetArgs()...)
-	cmd.Env = buildCmdEnv(g)
-	if dir := cr.GetCmd().GetDir(); dir != "" {
-		cmd.Dir = dir
+	// 文件拉取、定时任务管理、账号与进程查询不执行命令，不需要执行身份与模板变量
+	switch cmdExtra.Type {
+	case TaskTypeCmd, TaskTypeScript, TaskTypeWorkflow:
+	case TaskTypeSpool:
+		g.serveSpool(cr.Id, cmdExtra.Code, cmdExtra.Spool, tasklog)
+		return
+	case TaskTypeSchedule:
+		g.serveSchedule(cr.Id, cmdExtra.Code, cmdExtra.Schedule, tasklog)
+		return
+	case TaskTypeAccount:
+		g.runAccount(ctx, cr.Id, cmdExtra.Code, cmdExtra.Account, tasklog)
+		return
+	case TaskTypeProcesses:
+		g.serveProcesses(cr.Id, cmdExtra.Code, cmdExtra.Processes, tasklog)
+		return
+	default:
+		tasklog.WithField("type", cmdExtra.Type).Warn("ConsumerCmd: unknown task type")
+		g.sendResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte("unknown task type: " + cmdExtra.Type)}, xps.Status_FAIL)
+		return
 	}
-	if envs := cr.GetCmd().GetEnvs(); len(envs) != 0 {
-		cmd.Env = append(cmd.Env, envs...)
+
+	// 执行身份：指定的用户不存在时直接失败，不回退为 root
+	ra, err := lookupRunAs(&cmdExtra)
+	if err != nil {
+		tasklog.WithError(err).Warn("ConsumerCmd: resolve run-as user failed")
+		g.sendResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte(err.Error())}, xps.Status_FAIL)
+		return
 	}
 
-	// 切换用户（仅当 user 存在）
-	applyUser(cmd, cmdExtra.User, tasklog)
+	// 模板变量：agent 信息注入环境，Extra.Expand 开启时展开 args/dir/envs 中的 ${...}
+	vars := g.newTaskVars(cr.Id, cr.GetCmd().GetEnvs(), cmdExtra.Expand)
+	name, args := cr.GetCmd().GetName(), vars.ExpandAll(cr.GetCmd().GetArgs())
+	dir, envs := vars.Expand(cr.GetCmd().GetDir()), append(vars.Env(), vars.ExpandEnv(cr.GetCmd().GetEnvs())...)
+
+	switch cmdExtra.Type {
+	case TaskTypeWorkflow:
+		g.runWorkflow(ctx, cr.Id, cmdExtra.Code, cmdExtra.Workflow, ra, vars, pos, lock, tasklog)
+		return
+	case TaskTypeScript:
+		script, cleanup, err := ra.writeScript(cmdExtra.Script)
+		if err != nil {
+			tasklog.WithError(err).Warn("ConsumerCmd: prepare script failed")
+			g.sendResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte(err.Error())}, xps.Status_FAIL)
+			return
+		}
+		defer func() {
+			if err := cleanup(); err != nil {
+				tasklog.WithError(err).WithField("script", script.Path).Warn("ConsumerCmd: cleanup script failed")
+			}
+		}()
+		tasklog = tasklog.WithFields(logrus.Fields{
+			"script_sha256": script.SHA256,
+			"interpreter":   script.Interpreter,
+		})
+		name, args = ra.scriptCommand(script, args)
+		ra = ra.withFiles(script.Path)
+	}
+
+	policy, err := newRetryPolicy(cmdExtra.Retry)
+	if err != nil {
+		tasklog.WithError(err).Warn("ConsumerCmd: invalid retry policy")
+		g.sendResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte(err.Error())}, xps.Status_FAIL)
+		return
+	}
 
 	tasklog.WithFields(logrus.Fields{
-		"cmd":     cr.GetCmd().GetName(),
-		"args":    strings.Join(cr.GetCmd().GetArgs(), " "),
-		"dir":     cmd.Dir,
-		"timeout": cmdTimeout.String(),
-		"user":    cmdExtra.User,
-		"code":    cmdExtra.Code,
+		"cmd":          name,
+		"args":         strings.Join(args, " "),
+		"dir":          dir,
+		"timeout":      cmdTimeout.String(),
+		"user":         cmdExtra.User,
+		"code":         cmdExtra.Code,
+		"type":         cmdExtra.Type,
+		"max_attempts": policy.maxAttempts,
 	}).Infoln("ConsumerCmd: start")
 
-	switch cmdExtra.Code {
-	case proto.MCodeLogLine:
-		// 异步执行：实时返回输出
-		logCh := make(chan common.ExecRes, 50)
-		go common.AsyncExec(cmd, logCh)
-
-		var pos int32
-		for {
-			select {
-			case <-ctx.Done():
-				// 超时/取消
-				tasklog.WithError(ctx.Err()).Warn("ConsumerCmd: ctx done while streaming logs")
-				// 让下游知道结束
-				g.SendMsgResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte(ctx.Err().Error())}, xps.Status_FAIL)
-				return
-			case r, ok := <-logCh:
-				if !ok {
-					tasklog.Infoln("ConsumerCmd: async exec finished")
-					return
-				}
-				if r.Err != nil {
-					tasklog.WithError(r.Err).Warn("ConsumerCmd: async exec error")
-					g.SendMsgResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte(r.Err.Error())}, xps.Status_FAIL)
-					return
-				}
-				if len(r.Buf) == 0 {
-					pos++
-					continue
+	streaming := cmdExtra.Code == proto.MCodeLogLine
+	for attempt := 1; ; attempt++ {
+		// exec.Cmd 不可重复执行，每次重试重新构造
+		cmd, err := g.newTaskCmd(ctx, name, args, dir, envs, ra)
+		if err != nil {
+			tasklog.WithError(err).Warn("ConsumerCmd: build command failed")
+			g.sendResult(cr.Id, cmdExtra.Code, &xps.Body{Code: -1, Stderr: []byte(err.Error())}, xps.Status_FAIL)
+			return
+		}
+		body, status, stderr := g.execAttempt(ctx, cr.Id, &cmdExtra, cmd, &pos, tasklog)
+
+		rec := attemptRecord{Attempt: attempt, MaxAttempts: policy.maxAttempts}
+		if attempt >= policy.maxAttempts || ctx.Err() != nil || !policy.Retryable(body, stderr) {
+			if policy.maxAttempts > 1 {
+				rec.Final = true
+				g.reportAttempt(cr.Id, &pos, rec, !streaming, body, tasklog)
+			}
+			lock.annotate(body, streaming)
+			g.sendResult(cr.Id, cmdExtra.Code, body, status)
+			return
+		}
+
+		delay := policy.Delay(attempt)
+		rec.RetryInMs = delay.Milliseconds()
+		g.reportAttempt(cr.Id, &pos, rec, !streaming, body, tasklog)
+
+		select {
+		case <-ctx.Done():
+			tasklog.WithError(ctx.Err()).Warn("ConsumerCmd: ctx done while waiting for retry")
+			lock.annotate(body, streaming)
+			g.sendResult(cr.Id, cmdExtra.Code, body, status)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// execAttempt 执行一次命令并返回结果（不发送）与用于重试判断的 stderr；pos 为日志行号，流式执行后递增
+func (g *GrpcMgr) execAttempt(ctx context.Context, id string, extra *TaskExtra, cmd *exec.Cmd, pos *int32, l *logrus.Entry) (*xps.Body, xps.Status, []byte) {
+	// 完整输出落盘，超出回传上限时保留供 channel 按需读取（重试时保留最后一次）
+	spool, err := g.spool.Create(id)
+	if err != nil {
+		l.WithError(err).Warn("ConsumerCmd: create spool failed, output will not be spooled")
+	}
+	defer func() {
+		if spool.Finish(int64(common.MaxOutputBytes())) {
+			l.Infoln("ConsumerCmd: output exceeds inline limit, kept in spool")
+		}
+	}()
+
+	if extra.Code == proto.MCodeLogLine {
+		// 异步执行：实时返回输出，结束时返回终态结果；stderr 末尾另行保留供重试判断
+		tail := newStderrTail(retryStderrTail)
+		body, status := g.streamCmd(ctx, id, cmd, spool, tail, pos, l)
+		return body, status, tail.Bytes()
+	}
+
+	// 同步执行：一次性返回结果
+	body := common.SyncExecTee(cmd, extra.Output, spool.Stdout(), spool.Stderr())
+	status := xps.Status_SUCC
+	if body.Code != 0 {
+		status = xps.Status_FAIL
+	}
+	return body, status, body.Stderr
+}
+
+// streamGracePeriod ctx 结束后等待进程退出并回传汇总的最长时间
+const streamGracePeriod = 5 * time.Second
+
+// streamResult 流式任务的终态结果，序列化为 json 放在 Body.Stdout
+type streamResult struct {
+	common.ExecSummary
+	Lines    int32 `json:"lines"`               // 日志行数（含回传失败的行）
+	TimedOut bool  `json:"timed_out,omitempty"` // 是否因超时/取消结束
+	Lost     bool  `json:"lost,omitempty"`      // 未拿到执行汇总（进程未按时退出）
+}
+
+// streamCmd 异步执行并分批回传日志（行号从 *pos 开始），返回终态结果；stderr 同时写入 tail
+func (g *GrpcMgr) streamCmd(ctx context.Context, id string, cmd *exec.Cmd, spool *common.SpoolWriter, tail io.Writer, pos *int32, l *logrus.Entry) (*xps.Body, xps.Status) {
+	stderrTee := tail
+	if w := spool.Stderr(); w != nil {
+		stderrTee = io.MultiWriter(w, tail)
+	}
+	logCh := make(chan common.ExecRes, 50)
+	go common.AsyncExecTee(cmd, logCh, spool.Stdout(), stderrTee)
+
+	start := *pos
+	batcher := newLogBatcher(start, func(pos int32, out string) error {
+		return g.SendLocalLog(id, pos, out, 0)
+	})
+	defer func() { *pos = batcher.Lines() }()
+
+	interval := viper.GetDuration("Log.BatchInterval")
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		summary *common.ExecSummary
+		errs    []string
+		grace   <-chan time.Time
+	)
+	finish := func() (*xps.Body, xps.Status) {
+		batcher.Flush()
+		if summary != nil {
+			summary.Dropped += batcher.Lost()
+		}
+		return streamResultBody(ctx, summary, batcher.Lines()-start, batcher.Lost(), errs)
+	}
+
+	done := ctx.Done()
+	for {
+		select {
+		case <-done:
+			// 超时/取消：CommandContext 会终止进程，继续读取直到拿到汇总
+			l.WithError(ctx.Err()).Warn("ConsumerCmd: ctx done while streaming logs")
+			done = nil
+			grace = time.After(streamGracePeriod)
+		case <-grace:
+			// 子进程遗留的后代可能一直占用管道，放弃等待，后台读空避免 AsyncExec 阻塞
+			l.Warn("ConsumerCmd: async exec not finished after ctx done, give up")
+			go func() {
+				for range logCh {
 				}
-				g.SendLocalLog(cr.Id, pos, string(r.Buf), 0)
-				pos++
+			}()
+			return finish()
+		case <-ticker.C:
+			batcher.Flush()
+		case r, ok := <-logCh:
+			if !ok {
+				l.Infoln("ConsumerCmd: async exec finished")
+				return finish()
+			}
+			if r.Summary != nil {
+				summary = r.Summary
+				continue
+			}
+			if r.Err != nil {
+				l.WithError(r.Err).Warn("ConsumerCmd: async exec error")
+				errs = append(errs, r.Err.Error())
+				continue
+			}
+			if len(r.Buf) != 0 {
+				batcher.Add(r.Buf)
 			}
 		}
+	}
+}
 
-	default:
-		// 同步执行：一次性返回结果
-		body := common.SyncExec(cmd)
-		status := xps.Status_SUCC
-		if body.Code != 0 {
-			status = xps.Status_FAIL
+func streamResultBody(ctx context.Context, summary *common.ExecSummary, lines int32, lost int64, errs []string) (*xps.Body, xps.Status) {
+	res := streamResult{Lines: lines, TimedOut: ctx.Err() != nil}
+	if summary != nil {
+		res.ExecSummary = *summary
+	} else {
+		res.Code = -1
+		res.Dropped = lost
+		res.Lost = true
+	}
+
+	body := &xps.Body{Code: int32(res.Code), Stderr: []byte(strings.Join(errs, "\n"))}
+	if res.TimedOut && len(body.Stderr) == 0 {
+		body.Stderr = []byte(ctx.Err().Error())
+	}
+	if b, err := json.Marshal(res); err == nil {
+		body.Stdout = b
+	}
+
+	status := xps.Status_SUCC
+	if res.Code != 0 || res.TimedOut {
+		status = xps.Status_FAIL
+	}
+	return body, status
+}
+
+// newTaskCmd 构造任务命令：统一注入运行环境并切换到 ra 指定的执行身份（沙箱或容器）
+func (g *GrpcMgr) newTaskCmd(ctx context.Context, name string, args []string, dir string, envs []string, ra *runAs) (*exec.Cmd, error) {
+	name, args = ra.wrap(name, args)
+	dir = ra.dir(dir)
+
+	if ra != nil && ra.Container != nil {
+		env := append(ra.env(containerEnv(ra.Container)), envs...)
+		cmd, err := sandbox.ContainerCommand(ctx, ra.Container.spec(ra.Cred, dir), name, args, env)
+		if err != nil {
+			return nil, err
+		}
+		// 进入 PID namespace 时会 fork，超时需结束整个进程组
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 		}
-		g.SendMsgResult(cr.Id, cmdExtra.Code, body, status)
+		return cmd, nil
 	}
+
+	env := append(ra.env(buildCmdEnv(g)), envs...)
+	var cmd *exec.Cmd
+	if ra != nil && ra.Sandbox != nil {
+		var err error
+		if cmd, err = sandbox.Command(ctx, ra.Sandbox, name, args, env); err != nil {
+			return nil, err
+		}
+	} else {
+		cmd = exec.CommandContext(ctx, name, args...)
+		cmd.Env = env
+		if cred := ra.credential(); cred != nil {
+			// 只在 SysProcAttr 可用时设置；保持原行为（Linux 为主）
+			cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+		}
+	}
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	return cmd, nil
 }
 
 func parseCmdTimeout(raw string, fallback time.Duration, l *logrus.Entry) time.Duration {
@@ -172,35 +404,3 @@ func splitHostPortLoose(target string) (host, port string, ok bool) {
 	}
 	return host, port, true
 }
-
-func applyUser(cmd *exec.Cmd, username string, l *logrus.Entry) {
-	username = strings.TrimSpace(username)
-	if username == "" {
-		return
-	}
-
-	u, err := user.Lookup(username)
-	if err != nil {
-		l.WithError(err).WithField("user", username).Warn("ConsumerCmd: user lookup failed, run as current user")
-		return
-	}
-
-	uid, err := strconv.Atoi(u.Uid)
-	if err != nil {
-		l.WithError(err).WithField("uid", u.Uid).Warn("ConsumerCmd: invalid uid, skip setuid")
-		return
-	}
-	gid, err := strconv.Atoi(u.Gid)
-	if err != nil {
-		l.WithError(err).WithField("gid", u.Gid).Warn("ConsumerCmd: invalid gid, skip setgid")
-		return
-	}
-
-	// 只在 SysProcAttr 可用时设置；保持原行为（Linux 为主）
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid: uint32(uid),
-			Gid: uint32(gid),
-		},
-	}
-}
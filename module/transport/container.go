@@ -0,0 +1,341 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+	"github.com/xulei1234/x-agent/module/sandbox"
+	"golang.org/x/sys/unix"
+)
+
+// 容器运行时（ContainerTarget.Runtime）
+const (
+	RuntimeAuto       = ""           // 依次尝试 docker、containerd
+	RuntimeDocker     = "docker"     // 通过 docker 本地 socket 查询容器 init 进程
+	RuntimeContainerd = "containerd" // 读取 containerd shim 的 init.pid
+	RuntimePID        = "pid"        // 直接指定目标进程
+)
+
+// ContainerTarget Extra.Container：在宿主机上的容器内执行命令
+type ContainerTarget struct {
+	Name      string `json:"name"` // 容器名或 ID（containerd 为 ID）
+	Runtime   string `json:"runtime,omitempty"`
+	Namespace string `json:"namespace,omitempty"` // containerd namespace，空表示全部
+	PID       int    `json:"pid,omitempty"`       // runtime=pid
+}
+
+// containerExec 已解析的容器执行目标：加入 PID 的 cgroup、全部 namespace 与根目录执行
+type containerExec struct {
+	Name string
+	PID  int
+}
+
+// rootPath 宿主机上访问容器根文件系统的路径。容器内的绝对符号链接按宿主机解析，
+// 读写容器内文件需经 openInRoot
+func (c *containerExec) rootPath(p string) string {
+	return filepath.Join("/proc", strconv.Itoa(c.PID), "root", p)
+}
+
+// openInRoot 以 root 为根打开 p（openat2 RESOLVE_IN_ROOT）：符号链接与 ".." 均不会解析到 root 之外
+func openInRoot(root, p string, flags int) (*os.File, error) {
+	rfd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer unix.Close(rfd)
+	fd, err := unix.Openat2(rfd, strings.TrimPrefix(filepath.Clean("/"+p), "/"), &unix.OpenHow{
+		Flags:   uint64(flags | unix.O_CLOEXEC),
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "openat2", Path: filepath.Join(root, p), Err: err}
+	}
+	return os.NewFile(uintptr(fd), filepath.Join(root, p)), nil
+}
+
+// fdPath 经 /proc/self/fd 访问已打开的文件，不再重新解析原路径
+func fdPath(f *os.File) string {
+	return "/proc/self/fd/" + strconv.Itoa(int(f.Fd()))
+}
+
+// lookupPasswdInRoot 读取 root 下的 /etc/passwd，文件不存在时返回 nil
+func lookupPasswdInRoot(root, name string) (*passwdEntry, error) {
+	f, err := openInRoot(root, "/etc/passwd", unix.O_RDONLY)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return lookupPasswd(fdPath(f), name)
+}
+
+// lookupGroupsInRoot 读取 root 下的 /etc/group，返回 name 所在的附加组（不含主组 gid），文件不存在时返回 nil
+func lookupGroupsInRoot(root, name string, gid int) ([]uint32, error) {
+	f, err := openInRoot(root, "/etc/group", unix.O_RDONLY)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var groups []uint32
+	err = readColonFile(fdPath(f), 4, func(f []string) {
+		id, err := strconv.ParseUint(f[2], 10, 32)
+		if err != nil || int(id) == gid || f[3] == "" {
+			return
+		}
+		for _, mem := range strings.Split(f[3], ",") {
+			if mem == name {
+				groups = append(groups, uint32(id))
+				return
+			}
+		}
+	})
+	return groups, err
+}
+
+// resolveContainer 查询容器 init 进程 PID
+func resolveContainer(ctx context.Context, t *ContainerTarget) (*containerExec, error) {
+	name := strings.TrimSpace(t.Name)
+	var (
+		pid int
+		err error
+	)
+	switch t.Runtime {
+	case RuntimePID:
+		pid = t.PID
+		if name == "" {
+			name = strconv.Itoa(pid)
+		}
+	case RuntimeDocker:
+		pid, err = dockerContainerPID(ctx, viper.GetString("Container.DockerSocket"), name)
+	case RuntimeContainerd:
+		pid, err = containerdPID(viper.GetString("Container.ContainerdRoot"), t.Namespace, name)
+	case RuntimeAuto:
+		if pid, err = dockerContainerPID(ctx, viper.GetString("Container.DockerSocket"), name); err != nil {
+			var cerr error
+			if pid, cerr = containerdPID(viper.GetString("Container.ContainerdRoot"), t.Namespace, name); cerr != nil {
+				err = fmt.Errorf("%v; %v", err, cerr)
+			} else {
+				err = nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q", t.Runtime)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pid <= 0 {
+		return nil, fmt.Errorf("container %q: invalid pid %d", name, pid)
+	}
+	if _, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid))); err != nil {
+		return nil, fmt.Errorf("container %q: process %d not found", name, pid)
+	}
+	return &containerExec{Name: name, PID: pid}, nil
+}
+
+// dockerContainerPID GET /containers/<name>/json，取 State.Pid
+func dockerContainerPID(ctx context.Context, socket, name string) (int, error) {
+	if name == "" {
+		return 0, fmt.Errorf("empty container name")
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/"+url.PathEscape(name)+"/json", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("docker: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("docker: container %q not found", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("docker: inspect %q: %s", name, resp.Status)
+	}
+
+	var info struct {
+		State struct {
+			Running bool `json:"Running"`
+			Pid     int  `json:"Pid"`
+		} `json:"State"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0, fmt.Errorf("docker: decode inspect: %w", err)
+	}
+	if !info.State.Running {
+		return 0, fmt.Errorf("docker: container %q is not running", name)
+	}
+	return info.State.Pid, nil
+}
+
+// containerdPID 读取 <root>/<namespace>/<id>/init.pid
+func containerdPID(root, namespace, id string) (int, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return 0, fmt.Errorf("containerd: invalid container id %q", id)
+	}
+	ns := namespace
+	if ns == "" {
+		ns = "*"
+	} else if strings.ContainsAny(ns, `/\*?[`) {
+		return 0, fmt.Errorf("containerd: invalid namespace %q", namespace)
+	}
+	matches, _ := filepath.Glob(filepath.Join(root, ns, id, "init.pid"))
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("containerd: container %q not found", id)
+	}
+	if len(matches) > 1 {
+		return 0, fmt.Errorf("containerd: container %q found in multiple namespaces", id)
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		return 0, fmt.Errorf("containerd: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("containerd: invalid init.pid: %w", err)
+	}
+	return pid, nil
+}
+
+// lookupContainerRunAs 在容器内的 /etc/passwd、/etc/group 中查找执行用户（默认 root）及附加组，
+// 登录 shell/umask 等按容器内的用户处理。按策略需要沙箱的任务不能在容器内执行
+func lookupContainerRunAs(ctx context.Context, extra *TaskExtra) (*runAs, error) {
+	sb, err := resolveSandbox(extra)
+	if err != nil {
+		return nil, err
+	}
+	if sb != nil {
+		return nil, fmt.Errorf("sandbox is required for this task (class %q) and cannot be combined with a container target", extra.Class)
+	}
+	c, err := resolveContainer(ctx, extra.Container)
+	if err != nil {
+		return nil, err
+	}
+
+	ra := &runAs{LoginShell: extra.LoginShell, Umask: -1, Container: c}
+	if s := strings.TrimSpace(extra.Umask); s != "" {
+		m, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || m > 0o777 {
+			return nil, fmt.Errorf("invalid umask %q", extra.Umask)
+		}
+		ra.Umask = int(m)
+	}
+
+	username := strings.TrimSpace(extra.User)
+	if username == "" {
+		username = "root"
+	}
+	pw, err := lookupPasswdInRoot(c.rootPath("/"), username)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: read passwd: %w", c.Name, err)
+	}
+	if pw == nil {
+		if username != "root" {
+			return nil, fmt.Errorf("container %s: user %q not found", c.Name, username)
+		}
+		// 精简镜像可能没有 /etc/passwd
+		pw = &passwdEntry{Name: "root", Home: "/root", Shell: "/bin/sh"}
+	}
+	ra.Name, ra.Home, ra.Shell = pw.Name, pw.Home, pw.Shell
+	if ra.Shell == "" {
+		ra.Shell = "/bin/sh"
+	}
+	groups, err := lookupGroupsInRoot(c.rootPath("/"), pw.Name, pw.GID)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: read group: %w", c.Name, err)
+	}
+	ra.Cred = &syscall.Credential{Uid: uint32(pw.UID), Gid: uint32(pw.GID), Groups: groups}
+	return ra, nil
+}
+
+// containerEnv 以容器 init 进程的环境变量为基础（PATH 等与镜像一致）
+func containerEnv(c *containerExec) []string {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(c.PID), "environ"))
+	if err != nil {
+		return []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}
+	}
+	var env []string
+	for _, kv := range bytes.Split(b, []byte{0}) {
+		if len(kv) > 0 {
+			env = append(env, string(kv))
+		}
+	}
+	return env
+}
+
+// spec 容器内执行参数；dir 为容器内路径，空表示容器进程的当前目录
+func (c *containerExec) spec(cred *syscall.Credential, dir string) *sandbox.ContainerSpec {
+	spec := &sandbox.ContainerSpec{PID: c.PID, Dir: dir}
+	if cred != nil {
+		spec.Cred = &sandbox.Credential{Uid: cred.Uid, Gid: cred.Gid, Groups: cred.Groups}
+	}
+	return spec
+}
+
+// writeScript 脚本落盘，返回的 cleanup 负责删除。容器任务写入容器的 /tmp
+func (r *runAs) writeScript(spec *common.ScriptSpec) (*common.Script, func() error, error) {
+	if r != nil && r.Container != nil {
+		return writeScriptInRoot(r.Container.rootPath("/"), spec, r.credential())
+	}
+	s, err := common.WriteScriptIn(viper.GetString("Cmd.ScriptDir"), spec, r.credential())
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.Cleanup, nil
+}
+
+// writeScriptInRoot 在 root 下的 /tmp 中写入脚本；目录经 openInRoot 打开并保持到 cleanup，
+// 脚本的创建与删除都不会被容器内的符号链接引到宿主机
+func writeScriptInRoot(root string, spec *common.ScriptSpec, cred *syscall.Credential) (*common.Script, func() error, error) {
+	dir, err := openInRoot(root, "/tmp", unix.O_PATH|unix.O_DIRECTORY)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := common.WriteScriptIn(fdPath(dir), spec, cred)
+	if err != nil {
+		_ = dir.Close()
+		return nil, nil, err
+	}
+	return s, func() error {
+		defer dir.Close()
+		return s.Cleanup()
+	}, nil
+}
+
+// scriptCommand 执行脚本的命令；容器内使用容器视角的路径
+func (r *runAs) scriptCommand(s *common.Script, args []string) (string, []string) {
+	if r != nil && r.Container != nil {
+		inner := *s
+		inner.Path = "/tmp/" + filepath.Base(s.Path)
+		return inner.Command(args)
+	}
+	return s.Command(args)
+}
@@ -0,0 +1,229 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+	"github.com/xulei1234/x-agent/module/sandbox"
+	proto "github.com/xulei1234/x-proto"
+)
+
+func TestMain(m *testing.M) {
+	// 容器任务重新执行测试二进制进入容器
+	sandbox.Main()
+	os.Exit(m.Run())
+}
+
+func TestDockerContainerPID(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/web/json":
+			_, _ = w.Write([]byte(`{"State":{"Running":true,"Pid":4242}}`))
+		case "/containers/stopped/json":
+			_, _ = w.Write([]byte(`{"State":{"Running":false,"Pid":0}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	ctx := context.Background()
+	if pid, err := dockerContainerPID(ctx, sock, "web"); err != nil || pid != 4242 {
+		t.Fatalf("pid=%d err=%v", pid, err)
+	}
+	if _, err := dockerContainerPID(ctx, sock, "stopped"); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Fatalf("expected not running error, got %v", err)
+	}
+	if _, err := dockerContainerPID(ctx, sock, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestContainerdPID(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "k8s.io", "abc123")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "init.pid"), []byte("777\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if pid, err := containerdPID(root, "", "abc123"); err != nil || pid != 777 {
+		t.Fatalf("pid=%d err=%v", pid, err)
+	}
+	if pid, err := containerdPID(root, "k8s.io", "abc123"); err != nil || pid != 777 {
+		t.Fatalf("pid=%d err=%v", pid, err)
+	}
+	for _, c := range []struct{ ns, id string }{
+		{"default", "abc123"},
+		{"", "other"},
+		{"", "../k8s.io/abc123"},
+		{"*", "abc123"},
+	} {
+		if _, err := containerdPID(root, c.ns, c.id); err == nil {
+			t.Fatalf("expected error for ns=%q id=%q", c.ns, c.id)
+		}
+	}
+}
+
+func TestContainerExec_Spec(t *testing.T) {
+	c := &containerExec{Name: "web", PID: 42}
+	if spec := c.spec(nil, ""); spec.PID != 42 || spec.Cred != nil || spec.Dir != "" {
+		t.Fatalf("spec=%+v", spec)
+	}
+	spec := c.spec(&syscall.Credential{Uid: 33, Gid: 33, Groups: []uint32{4}}, "/srv")
+	if spec.Dir != "/srv" || spec.Cred == nil || spec.Cred.Uid != 33 || spec.Cred.Gid != 33 || len(spec.Cred.Groups) != 1 {
+		t.Fatalf("spec=%+v cred=%+v", spec, spec.Cred)
+	}
+
+	if c.rootPath("/tmp") != "/proc/42/root/tmp" {
+		t.Fatalf("rootPath=%s", c.rootPath("/tmp"))
+	}
+}
+
+func TestLookupGroupsInRoot(t *testing.T) {
+	root := t.TempDir()
+	if groups, err := lookupGroupsInRoot(root, "app", 1000); err != nil || groups != nil {
+		t.Fatalf("groups=%v err=%v", groups, err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := "app:x:1000:\nwww:x:33:nginx,app\ndocker:x:999:app\nother:x:5:appx\n"
+	if err := os.WriteFile(filepath.Join(root, "etc", "group"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := lookupGroupsInRoot(root, "app", 1000)
+	if err != nil || len(groups) != 2 || groups[0] != 33 || groups[1] != 999 {
+		t.Fatalf("groups=%v err=%v", groups, err)
+	}
+}
+
+func TestContainerRunAs_SandboxPolicy(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("Sandbox.Classes", map[string]interface{}{"untrusted": true})
+
+	target := &ContainerTarget{Runtime: RuntimePID, PID: os.Getpid()}
+	extra := &TaskExtra{CmdExtra: proto.CmdExtra{Class: "untrusted"}, Container: target}
+	if _, err := lookupRunAs(extra); err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Fatalf("expected sandbox policy error, got %v", err)
+	}
+	viper.Set("Sandbox.Enabled", true)
+	if _, err := lookupRunAs(&TaskExtra{Container: target}); err == nil {
+		t.Fatalf("expected sandbox policy error")
+	}
+	// 任务显式关闭沙箱
+	disabled := false
+	ra, err := lookupRunAs(&TaskExtra{Sandbox: &SandboxOptions{Enabled: &disabled}, Container: target})
+	if err != nil || ra.Container == nil {
+		t.Fatalf("ra=%+v err=%v", ra, err)
+	}
+}
+
+func TestContainerRunAs_Exec(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	// 以测试进程自身作为“容器”：namespace、cgroup 与根目录即宿主机
+	extra := &TaskExtra{Container: &ContainerTarget{Runtime: RuntimePID, PID: os.Getpid()}}
+	ra, err := lookupRunAs(extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Container == nil || ra.Name != "root" || ra.Cred.Uid != 0 {
+		t.Fatalf("unexpected runAs %+v", ra)
+	}
+
+	cmd, err := gMgr.newTaskCmd(context.Background(), "sh", []string{"-c", `pwd; echo "$USER"`}, "/", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Skipf("container exec unavailable: %v %s", err, out)
+	}
+	if got := strings.Fields(string(out)); strings.Join(got, " ") != "/ root" {
+		t.Fatalf("got=%q", out)
+	}
+
+	if _, err := lookupRunAs(&TaskExtra{
+		CmdExtra:  proto.CmdExtra{User: "no-such-user-x-agent"},
+		Container: &ContainerTarget{Runtime: RuntimePID, PID: os.Getpid()},
+	}); err == nil {
+		t.Fatalf("expected error for missing container user")
+	}
+	if _, err := lookupRunAs(&TaskExtra{Container: &ContainerTarget{Runtime: RuntimePID, PID: 1 << 30}}); err == nil {
+		t.Fatalf("expected error for missing process")
+	}
+}
+
+// 容器内指向绝对路径的符号链接按容器根解析，不会落到宿主机
+func TestContainerRoot_Symlinks(t *testing.T) {
+	root, host := t.TempDir(), t.TempDir()
+	for _, d := range []string{"etc", "data"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "passwd.real"), []byte("app:x:1000:1000::/home/app:/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd.real", filepath.Join(root, "etc", "passwd")); err != nil {
+		t.Fatal(err)
+	}
+	// /tmp 指向宿主机的绝对路径，在容器根中解析为 <root><host>（不存在）
+	if err := os.Symlink(host, filepath.Join(root, "tmp")); err != nil {
+		t.Fatal(err)
+	}
+
+	pw, err := lookupPasswdInRoot(root, "app")
+	if err != nil || pw == nil || pw.UID != 1000 {
+		t.Fatalf("pw=%+v err=%v", pw, err)
+	}
+	if _, _, err := writeScriptInRoot(root, &common.ScriptSpec{Body: "echo hi"}, nil); err == nil {
+		t.Fatalf("expected /tmp to resolve inside root")
+	}
+	if entries, _ := os.ReadDir(host); len(entries) != 0 {
+		t.Fatalf("script written to host: %v", entries)
+	}
+
+	// 容器根中的 /tmp -> /data
+	_ = os.Remove(filepath.Join(root, "tmp"))
+	if err := os.Symlink("/data", filepath.Join(root, "tmp")); err != nil {
+		t.Fatal(err)
+	}
+	s, cleanup, err := writeScriptInRoot(root, &common.ScriptSpec{Body: "echo hi"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "data"))
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(s.Path) {
+		t.Fatalf("entries=%v path=%s", entries, s.Path)
+	}
+	// 容器内以容器视角的路径执行
+	if name, args := (&runAs{Container: &containerExec{PID: 1}}).scriptCommand(s, nil); name != "bash" || args[0] != "/tmp/"+entries[0].Name() {
+		t.Fatalf("name=%s args=%v", name, args)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "data")); len(entries) != 0 {
+		t.Fatalf("script not removed: %v", entries)
+	}
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+)
+
+// 任务类型（TaskExtra.Type）
+const (
+	TaskTypeCmd       = ""          // 默认：直接执行 Command.Name/Args
+	TaskTypeScript    = "script"    // 脚本：Extra.Script 落盘后以指定解释器执行
+	TaskTypeSpool     = "spool"     // 读取已落盘的任务输出：Extra.Spool
+	TaskTypeSchedule  = "schedule"  // 管理本地定时任务：Extra.Schedule
+	TaskTypeWorkflow  = "workflow"  // 多步骤工作流：Extra.Workflow
+	TaskTypeAccount   = "account"   // 本地用户/用户组/authorized_keys/sudoers 管理：Extra.Account
+	TaskTypeProcesses = "processes" // 查询进程列表：Extra.Processes
+)
+
+// TaskExtra 在 proto.CmdExtra 基础上扩展 agent 侧参数。
+// Extra 为 json，旧 channel 不下发扩展字段时行为保持不变。
+type TaskExtra struct {
+	proto.CmdExtra
+	Type   string             `json:"type,omitempty"`
+	Script *common.ScriptSpec `json:"script,omitempty"`
+	// Output 同步任务输出模式：separate（默认）/combined（兼容旧版合并输出）
+	Output    string           `json:"output,omitempty"`
+	Spool     *SpoolRequest    `json:"spool,omitempty"`
+	Schedule  *ScheduleRequest `json:"schedule,omitempty"`
+	Workflow  *Workflow        `json:"workflow,omitempty"`
+	Retry     *RetryPolicy     `json:"retry,omitempty"`
+	Account   *AccountRequest  `json:"account,omitempty"`
+	Processes *ProcessRequest  `json:"processes,omitempty"`
+	// LoginShell 以 CmdExtra.User 的 login shell（-l）执行；Umask 为八进制，如 0022
+	LoginShell bool   `json:"login_shell,omitempty"`
+	Umask      string `json:"umask,omitempty"`
+	// Sandbox namespace 隔离执行，未设置时按 Sandbox.* 配置策略决定
+	Sandbox *SandboxOptions `json:"sandbox,omitempty"`
+	// Container 在宿主机上的容器内执行（docker/containerd/指定 PID），User 为容器内用户
+	Container *ContainerTarget `json:"container,omitempty"`
+	// Priority 排队优先级 high/normal/low；并发分类沿用 CmdExtra.Class
+	Priority string `json:"priority,omitempty"`
+	// Locks 命名互斥锁（如 apt、service:nginx），LockTimeout 为最长等待时间
+	Locks       []string `json:"locks,omitempty"`
+	LockTimeout string   `json:"lock_timeout,omitempty"`
+	// Expand 开启 args/dir/envs（含工作流步骤）中 ${...} 的模板展开，默认关闭以免改写 shell 语法；
+	// X_AGENT_* 环境变量总会注入
+	Expand bool `json:"expand,omitempty"`
+}
+
+// SpoolRequest 按任务 ID 读取落盘输出，length<=0 表示读到末尾（单次受 Cmd.MaxOutputBytes 限制）
+type SpoolRequest struct {
+	TaskID string `json:"task_id"`
+	Stream string `json:"stream"` // stdout/stderr，默认 stdout
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
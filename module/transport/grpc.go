@@ -122,11 +122,11 @@ func (g *GrpcMgr) ConnectToChannel() error {
 		DialOptions: []grpc.DialOption{
 			grpc.WithTransportCredentials(tlsCred),
 			grpc.WithBlock(),
-			grpc.WithPerRPCCredentials(&cred.Credentials{common.GetDeviceUUID()}),
+			grpc.WithPerRPCCredentials(&cred.Credentials{UUID: common.GetDeviceUUID()}),
 		},
 	})
 	if err != nil {
-		logrus.WithError(err).Error("ConnectToChannel: fail to new client v3(%s)", err.Error())
+		logrus.WithError(err).Error("ConnectToChannel: fail to new client v3")
 		return err
 	}
 
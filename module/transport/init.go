@@ -2,6 +2,8 @@ package transport
 
 import (
 	"context"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
 	"go.etcd.io/etcd/client/v3"
 	"sync"
 	"sync/atomic"
@@ -12,8 +14,8 @@ import (
 
 // WorkerPool
 type WorkerPool struct {
-	tasks    chan *xps.CmdReply //任务队列
-	poolSize int                //启动goroutine的数目
+	queue    *taskQueue //任务队列（优先级 + 分类并发上限）
+	poolSize int        //启动goroutine的数目
 }
 
 type GrpcMgr struct {
@@ -21,6 +23,18 @@ type GrpcMgr struct {
 	client3      *clientv3.Client
 	cmdtask      *WorkerPool
 	streamCancel context.CancelFunc
+	spool        *common.Spool          // 任务输出落盘，nil 表示禁用
+	sched        *scheduler             // 本地定时任务
+	outbox       *outbox                // 发送失败待重发的任务结果
+	osinfo       *inventoryReporter     // OS 信息增量上报
+	pkgs         *inventoryReporter     // 软件包清单增量上报
+	procs        *common.ProcessSampler // 周期上报的进程采样
+	procQuery    *common.ProcessSampler // 按需查询的进程采样，与周期采样分开以免打乱其 CPU 计算区间
+	units        *inventoryReporter     // systemd unit 状态增量上报
+	failed       *failedUnits
+	metrics      *metricsBuffer // 待发送的指标聚合结果
+	collectors   *collectorSet
+	facts        *inventoryReporter // 采集插件 facts 增量上报
 
 	// closed: 标记任务队列是否已关闭（避免 close 后继续写入导致 panic）
 	closed atomic.Bool
@@ -33,14 +47,63 @@ var gMgr *GrpcMgr
 func init() {
 	gMgr = &GrpcMgr{
 		cmdtask: &WorkerPool{
-			tasks:    make(chan *xps.CmdReply, 200),
+			queue:    newTaskQueue(200, nil),
 			poolSize: 10,
 		},
+		outbox:     newOutbox(0, ""),
+		osinfo:     newOSInfoReporter(0),
+		pkgs:       newPackagesReporter(0),
+		procs:      common.NewProcessSampler(),
+		procQuery:  common.NewProcessSampler(),
+		units:      newInventoryReporter(InventorySystemd, 0),
+		failed:     &failedUnits{},
+		metrics:    newMetricsBuffer(0),
+		collectors: newCollectorSet("", "@every 1h", 0),
+		facts:      newInventoryReporter(InventoryFacts, 0),
 	}
+	gMgr.sched = newScheduler("", gMgr.enqueueTask)
 
 }
 
 func SetUp() error {
+	spool, err := common.NewSpool(
+		viper.GetString("Spool.Dir"),
+		viper.GetInt64("Spool.MaxBytes"),
+		viper.GetInt64("Spool.MaxTaskBytes"),
+		viper.GetDuration("Spool.TTL"),
+	)
+	if err != nil {
+		// 落盘只是增强能力，失败不影响任务执行
+		logrus.WithError(err).Warn("SetUp: spool disabled")
+	}
+	gMgr.spool = spool
+
+	var limits map[string]int
+	if err := viper.UnmarshalKey("Worker.ClassLimits", &limits); err != nil {
+		logrus.WithError(err).Warn("SetUp: invalid Worker.ClassLimits, ignored")
+	}
+	gMgr.cmdtask = &WorkerPool{
+		queue:    newTaskQueue(viper.GetInt("Worker.QueueSize"), limits),
+		poolSize: viper.GetInt("Worker.PoolSize"),
+	}
+	if gMgr.cmdtask.poolSize <= 0 {
+		gMgr.cmdtask.poolSize = 10
+	}
+
+	gMgr.outbox = newOutbox(viper.GetInt("Outbox.MaxSize"), viper.GetString("Outbox.Dir"))
+	if err := gMgr.outbox.Load(); err != nil {
+		logrus.WithError(err).Warn("SetUp: load outbox failed")
+	}
+	gMgr.osinfo = newOSInfoReporter(viper.GetDuration("IntervalTick.OSInfoFull"))
+	gMgr.pkgs = newPackagesReporter(viper.GetDuration("IntervalTick.PackagesFull"))
+	gMgr.units = newInventoryReporter(InventorySystemd, viper.GetDuration("IntervalTick.SystemdFull"))
+	gMgr.metrics = newMetricsBuffer(viper.GetInt("Metrics.MaxBuffered"))
+	gMgr.collectors = newCollectorSet(viper.GetString("Collector.Dir"), viper.GetString("Collector.DefaultSchedule"), viper.GetDuration("Collector.DefaultTimeout"))
+	gMgr.facts = newInventoryReporter(InventoryFacts, viper.GetDuration("IntervalTick.FactsFull"))
+	gMgr.sched = newScheduler(viper.GetString("Schedule.File"), gMgr.enqueueTask)
+	if err := gMgr.sched.Load(); err != nil {
+		logrus.WithError(err).Warn("SetUp: load schedules failed")
+	}
 	return gMgr.ConnectToChannel()
 }
 
@@ -48,9 +111,18 @@ func Run() error {
 	go gMgr.TaskReportAgentInfo()
 	go gMgr.TaskReportHBS()
 	go gMgr.TaskReportOSInfo()
+	go gMgr.TaskReportPackages()
+	go gMgr.TaskReportNetwork()
+	go gMgr.TaskReportProcesses()
+	go gMgr.TaskReportSystemd()
+	go gMgr.TaskReportMetrics()
+	go gMgr.TaskRunCollectors()
 	go gMgr.TaskConsumerCmds()
 	go gMgr.TaskPullCommands()
 	go gMgr.WatchGrpcAddressUpdate()
+	go gMgr.TaskRunSchedules()
+	go gMgr.TaskFlushOutbox()
+	go gMgr.TaskEvictSpool()
 	return nil
 }
 
@@ -65,8 +137,8 @@ func Close() {
 		// 先标记 closed，减少发送方的竞态窗口
 		gMgr.closed.Store(true)
 
-		if gMgr.cmdtask != nil && gMgr.cmdtask.tasks != nil {
-			close(gMgr.cmdtask.tasks)
+		if gMgr.cmdtask != nil && gMgr.cmdtask.queue != nil {
+			gMgr.cmdtask.queue.Close()
 		}
 		if gMgr.client3 != nil {
 			_ = gMgr.client3.Close()
@@ -0,0 +1,208 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	proto "github.com/xulei1234/x-proto"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// 变更类型（snapshotChange.Op）
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// snapshot 规范化后的上报内容：section -> key -> 值（json）。
+// 结构体按字段、列表按主键（网卡名、cpu 序号等）展开，便于逐项比较
+type snapshot map[string]map[string]json.RawMessage
+
+// snapshotChange 一项变更
+type snapshotChange struct {
+	Section string          `json:"section"`
+	Key     string          `json:"key"`
+	Op      string          `json:"op"`
+	Old     json.RawMessage `json:"old,omitempty"`
+	New     json.RawMessage `json:"new,omitempty"`
+}
+
+// Hash 内容摘要；map 序列化时键有序，结果稳定
+func (s snapshot) Hash() string {
+	b, _ := json.Marshal(s)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// setFields 结构体按 json 字段展开到 section
+func (s snapshot) setFields(section string, v interface{}) {
+	b, _ := json.Marshal(v)
+	m := make(map[string]json.RawMessage)
+	_ = json.Unmarshal(b, &m)
+	s[section] = m
+}
+
+// setItem 列表项按主键加入 section
+func (s snapshot) setItem(section, key string, v interface{}) {
+	if s[section] == nil {
+		s[section] = make(map[string]json.RawMessage)
+	}
+	b, _ := json.Marshal(v)
+	s[section][key] = b
+}
+
+// diffSnapshots 按 section、key 排序返回 old -> new 的变更
+func diffSnapshots(old, new snapshot) []snapshotChange {
+	var out []snapshotChange
+	for _, sec := range unionKeys(old, new) {
+		o, n := old[sec], new[sec]
+		for _, k := range unionKeys(o, n) {
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inOld:
+				out = append(out, snapshotChange{Section: sec, Key: k, Op: ChangeAdded, New: nv})
+			case !inNew:
+				out = append(out, snapshotChange{Section: sec, Key: k, Op: ChangeRemoved, Old: ov})
+			case string(ov) != string(nv):
+				out = append(out, snapshotChange{Section: sec, Key: k, Op: ChangeModified, Old: ov, New: nv})
+			}
+		}
+	}
+	return out
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 清单种类（inventoryReport.Kind）
+const (
+	InventoryOS        = "os"
+	InventoryPackages  = "packages"
+	InventoryNetwork   = "network"
+	InventoryProcesses = "processes"
+	InventorySystemd   = "systemd"
+	InventoryMetrics   = "metrics"
+	InventoryFacts     = "facts" // 采集插件输出
+)
+
+// 清单上报类型（inventoryReport.Type）
+const (
+	ReportFull  = "full"
+	ReportDelta = "delta"
+	ReportEvent = "event" // 状态事件（如 unit 进入 failed），不影响增量基线
+)
+
+// inventoryReport 清单上报（Dt=proto.MCodeSysInfo）：全量时 Full 为完整内容，增量时 Changes 为相对 BaseHash 的变更；
+// channel 发现 BaseHash 与本地不一致时等待下一次全量快照
+type inventoryReport struct {
+	Kind     string           `json:"kind"` // os/packages ...
+	Type     string           `json:"type"`
+	Hash     string           `json:"hash"`
+	BaseHash string           `json:"base_hash,omitempty"`
+	Time     int64            `json:"time"`
+	Changes  []snapshotChange `json:"changes,omitempty"`
+	Full     interface{}      `json:"full,omitempty"`
+}
+
+// inventoryReporter 记录最后一次成功上报的清单，决定发送全量或增量
+type inventoryReporter struct {
+	kind      string
+	fullEvery time.Duration
+	// legacyFull 全量按原格式发送（Body 直接为内容、Dt=0），兼容旧 channel
+	legacyFull bool
+	// annotate 对增量做类型细化（如软件包 upgraded/downgraded）
+	annotate func([]snapshotChange)
+
+	mu        sync.Mutex
+	last      snapshot
+	lastHash  string
+	lastFull  time.Time
+	forceFull bool
+}
+
+func newInventoryReporter(kind string, fullEvery time.Duration) *inventoryReporter {
+	return &inventoryReporter{kind: kind, fullEvery: fullEvery}
+}
+
+// RequestFull 下一次上报发送全量快照（如重新连接后）
+func (r *inventoryReporter) RequestFull() {
+	r.mu.Lock()
+	r.forceFull = true
+	r.mu.Unlock()
+}
+
+// Next 生成本次需要发送的消息，无变化时返回 nil；发送成功后调用 commit 更新基线。
+// full 为完整内容，snap 为其规范化结果
+func (r *inventoryReporter) Next(full interface{}, snap snapshot, now time.Time) (msg *xps.MsgRequest, commit func(), err error) {
+	hash := snap.Hash()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil || r.forceFull || (r.fullEvery > 0 && now.Sub(r.lastFull) >= r.fullEvery) {
+		var body []byte
+		if r.legacyFull {
+			body, err = json.Marshal(full)
+		} else {
+			body, err = json.Marshal(inventoryReport{Kind: r.kind, Type: ReportFull, Hash: hash, Time: now.Unix(), Full: full})
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		msg = &xps.MsgRequest{Body: &xps.Body{Stdout: body}}
+		if !r.legacyFull {
+			msg.Dt = proto.MCodeSysInfo
+		}
+		return msg, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.last, r.lastHash, r.lastFull, r.forceFull = snap, hash, now, false
+		}, nil
+	}
+	if hash == r.lastHash {
+		return nil, nil, nil
+	}
+
+	base := r.lastHash
+	changes := diffSnapshots(r.last, snap)
+	if r.annotate != nil {
+		r.annotate(changes)
+	}
+	body, err := json.Marshal(inventoryReport{
+		Kind:     r.kind,
+		Type:     ReportDelta,
+		Hash:     hash,
+		BaseHash: base,
+		Time:     now.Unix(),
+		Changes:  changes,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	msg = &xps.MsgRequest{Dt: proto.MCodeSysInfo, Body: &xps.Body{Stdout: body}}
+	return msg, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// 期间已有其他上报更新了基线则不覆盖
+		if r.lastHash == base {
+			r.last, r.lastHash = snap, hash
+		}
+	}, nil
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// 命名互斥锁（如 apt、service:nginx）由 taskQueue 调度：声明的锁被占用时任务留在队列中等待，
+// 不占用 worker；持有同名锁的任务串行执行
+
+// normalizeLocks 去空白、去重并排序
+func normalizeLocks(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// taskLockWait 执行类任务（Extra.Type 为 cmd/script/workflow）的锁与最长等待时间：
+// Extra.LockTimeout，默认与任务超时相同。非执行类任务忽略 locks
+func taskLockWait(extra *TaskExtra, fallback time.Duration) ([]string, time.Duration) {
+	switch extra.Type {
+	case TaskTypeCmd, TaskTypeScript, TaskTypeWorkflow:
+	default:
+		return nil, 0
+	}
+	locks := normalizeLocks(extra.Locks)
+	if len(locks) == 0 {
+		return nil, 0
+	}
+	wait := fallback
+	if s := strings.TrimSpace(extra.LockTimeout); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			wait = d
+		}
+	}
+	return locks, wait
+}
+
+// lockRecord 锁等待情况，附加在任务结果中
+type lockRecord struct {
+	Locks  []string `json:"locks"`
+	WaitMs int64    `json:"wait_ms"`
+}
+
+// lockTimeoutError 等待锁超时
+func lockTimeoutError(locks []string, waited time.Duration) error {
+	return fmt.Errorf("wait locks %s: timeout (waited %s)", strings.Join(locks, ","), waited.Round(time.Millisecond))
+}
+
+// annotate 将锁等待时长写入结果：json 结果（流式任务、工作流）增加 lock_wait_ms 字段，
+// 其他结果在 stderr 末尾追加一行 [x-agent] lock {...}
+func (r *lockRecord) annotate(body *xps.Body, jsonBody bool) {
+	if r == nil || body == nil {
+		return
+	}
+	if jsonBody {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(body.Stdout, &m); err == nil && m != nil {
+			m["lock_wait_ms"], _ = json.Marshal(r.WaitMs)
+			if b, err := json.Marshal(m); err == nil {
+				body.Stdout = b
+			}
+			return
+		}
+	}
+	b, _ := json.Marshal(r)
+	stderr := append([]byte(nil), body.Stderr...)
+	if len(stderr) > 0 && stderr[len(stderr)-1] != '\n' {
+		stderr = append(stderr, '\n')
+	}
+	body.Stderr = append(stderr, "[x-agent] lock "+string(b)+"\n"...)
+}
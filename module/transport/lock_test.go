@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-proto/xps"
+)
+
+func lockedTask(id string, wait time.Duration, locks ...string) *queuedTask {
+	t := qt(id, "", "")
+	t.locks = normalizeLocks(locks)
+	t.queuedAt = time.Now()
+	t.lockDeadline = t.queuedAt.Add(wait)
+	return t
+}
+
+func TestTaskQueue_Locks(t *testing.T) {
+	q := newTaskQueue(10, nil)
+	_, _ = q.Push(lockedTask("apt1", time.Minute, "apt", "service:nginx"))
+	_, _ = q.Push(lockedTask("apt2", time.Minute, "apt"))
+	_, _ = q.Push(qt("free", "", PriorityLow))
+
+	got, doneApt1 := popID(t, q)
+	if got != "apt1" {
+		t.Fatalf("got=%s", got)
+	}
+	// apt 被占用：等待锁的任务留在队列中，不阻塞其他任务
+	if got, done := popID(t, q); got != "free" {
+		t.Fatalf("got=%s", got)
+	} else {
+		done()
+	}
+	if q.Len() != 1 {
+		t.Fatalf("apt2 should stay queued, len=%d", q.Len())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	doneApt1()
+	task, done, _ := q.Pop()
+	if task.cr.Id != "apt2" || task.lockErr != nil || task.lockWait < 10*time.Millisecond {
+		t.Fatalf("unexpected task %+v", task)
+	}
+	done()
+}
+
+func TestTaskQueue_LockTimeout(t *testing.T) {
+	q := newTaskQueue(10, nil)
+	_, _ = q.Push(lockedTask("holder", time.Minute, "apt"))
+	_, doneHolder := popID(t, q)
+	defer doneHolder()
+
+	_, _ = q.Push(lockedTask("waiter", 30*time.Millisecond, "other", "apt"))
+	start := time.Now()
+	task, done, _ := q.Pop()
+	done()
+	if task.cr.Id != "waiter" || task.lockErr == nil || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("expected lock timeout, task=%+v", task)
+	}
+	// 超时出队的任务不占用锁
+	_, _ = q.Push(lockedTask("other", time.Minute, "other"))
+	if got, done := popID(t, q); got != "other" {
+		t.Fatalf("got=%s", got)
+	} else {
+		done()
+	}
+}
+
+func TestTaskLockWait(t *testing.T) {
+	locks, wait := taskLockWait(&TaskExtra{Locks: []string{"b", " a ", "", "b"}, LockTimeout: "5s"}, time.Minute)
+	if strings.Join(locks, ",") != "a,b" || wait != 5*time.Second {
+		t.Fatalf("locks=%v wait=%v", locks, wait)
+	}
+	if _, wait := taskLockWait(&TaskExtra{Type: TaskTypeScript, Locks: []string{"a"}}, time.Minute); wait != time.Minute {
+		t.Fatalf("wait=%v", wait)
+	}
+	// 非执行类任务忽略 locks
+	if locks, _ := taskLockWait(&TaskExtra{Type: TaskTypeSpool, Locks: []string{"a"}}, time.Minute); locks != nil {
+		t.Fatalf("locks=%v", locks)
+	}
+}
+
+func TestLockRecord_Annotate(t *testing.T) {
+	rec := &lockRecord{Locks: []string{"apt"}, WaitMs: 12}
+
+	body := &xps.Body{Stdout: []byte(`{"code":0,"lines":3}`)}
+	rec.annotate(body, true)
+	if !strings.Contains(string(body.Stdout), `"lock_wait_ms":12`) || !strings.Contains(string(body.Stdout), `"lines":3`) {
+		t.Fatalf("stdout=%s", body.Stdout)
+	}
+
+	body = &xps.Body{Stdout: []byte("raw output"), Stderr: []byte("warn")}
+	rec.annotate(body, false)
+	if string(body.Stdout) != "raw output" || string(body.Stderr) != "warn\n[x-agent] lock {\"locks\":[\"apt\"],\"wait_ms\":12}\n" {
+		t.Fatalf("body=%+v", body)
+	}
+
+	var none *lockRecord
+	none.annotate(body, false)
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+// logBatcher 将按行日志合并成批，通过一次 Log 调用回传（Line.Pos 为批次首行行号）。
+// 发送是同步的：上传慢或重试时不再读取新日志，由 AsyncExec 反压到子进程；
+// 重试仍失败的批次才会丢弃，并在下一批前插入缺口标记说明丢失行数。
+type logBatcher struct {
+	send     func(pos int32, out string) error
+	maxBytes int
+	retry    int
+	backoff  time.Duration
+
+	buf     bytes.Buffer
+	first   int32 // 当前批次首行行号
+	lines   int32 // 已接收行数
+	pending int64 // 当前批次行数
+	gap     int64 // 尚未报告的丢失行数
+	lost    int64 // 累计丢失行数
+}
+
+// newLogBatcher 创建批量回传器，行号从 start 开始
+func newLogBatcher(start int32, send func(pos int32, out string) error) *logBatcher {
+	b := &logBatcher{
+		send:     send,
+		first:    start,
+		lines:    start,
+		maxBytes: viper.GetInt("Log.BatchBytes"),
+		retry:    viper.GetInt("Log.Retry"),
+		backoff:  viper.GetDuration("Log.RetryBackoff"),
+	}
+	if b.maxBytes <= 0 {
+		b.maxBytes = 32 << 10
+	}
+	if b.retry < 0 {
+		b.retry = 0
+	}
+	if b.backoff <= 0 {
+		b.backoff = 500 * time.Millisecond
+	}
+	return b
+}
+
+// Add 追加一行，批次满时立即发送
+func (b *logBatcher) Add(line []byte) {
+	if b.buf.Len() > 0 && b.buf.Len()+len(line) > b.maxBytes {
+		b.Flush()
+	}
+	if b.buf.Len() == 0 {
+		b.first = b.lines
+	}
+	b.buf.Write(line)
+	b.lines++
+	b.pending++
+	if b.buf.Len() >= b.maxBytes {
+		b.Flush()
+	}
+}
+
+// Flush 发送当前批次（含待报告的缺口标记）
+func (b *logBatcher) Flush() {
+	if b.buf.Len() == 0 && b.gap == 0 {
+		return
+	}
+	if b.buf.Len() == 0 {
+		b.first = b.lines
+	}
+
+	out := b.buf.String()
+	if b.gap > 0 {
+		out = string(common.GapMarker(b.gap, "log upload failed")) + out
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := b.send(b.first, out); err == nil {
+			b.gap = 0
+			break
+		}
+		if attempt >= b.retry {
+			b.gap += b.pending
+			b.lost += b.pending
+			break
+		}
+		time.Sleep(b.backoff << attempt)
+	}
+
+	b.buf.Reset()
+	b.pending = 0
+}
+
+// Lines 已接收行数
+func (b *logBatcher) Lines() int32 {
+	return b.lines
+}
+
+// Lost 累计丢失行数
+func (b *logBatcher) Lost() int64 {
+	return b.lost
+}
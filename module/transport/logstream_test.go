@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sentBatch struct {
+	pos int32
+	out string
+}
+
+func newTestBatcher(maxBytes int, fail func(n int) bool) (*logBatcher, *[]sentBatch) {
+	var sent []sentBatch
+	calls := 0
+	b := &logBatcher{
+		maxBytes: maxBytes,
+		retry:    1,
+		backoff:  time.Millisecond,
+	}
+	b.send = func(pos int32, out string) error {
+		calls++
+		if fail != nil && fail(calls) {
+			return errors.New("rpc down")
+		}
+		sent = append(sent, sentBatch{pos: pos, out: out})
+		return nil
+	}
+	return b, &sent
+}
+
+func TestLogBatcher_BatchesBySize(t *testing.T) {
+	b, sent := newTestBatcher(8, nil)
+
+	b.Add([]byte("a1\n"))
+	b.Add([]byte("a2\n"))
+	if len(*sent) != 0 {
+		t.Fatalf("expected no flush before size reached, got=%v", *sent)
+	}
+	b.Add([]byte("a3\n")) // 超过 8 字节，先发送前两行
+	b.Flush()
+
+	if len(*sent) != 2 {
+		t.Fatalf("expected 2 batches, got=%v", *sent)
+	}
+	if (*sent)[0] != (sentBatch{pos: 0, out: "a1\na2\n"}) || (*sent)[1] != (sentBatch{pos: 2, out: "a3\n"}) {
+		t.Fatalf("unexpected batches: %v", *sent)
+	}
+	if b.Lines() != 3 || b.Lost() != 0 {
+		t.Fatalf("unexpected counters lines=%d lost=%d", b.Lines(), b.Lost())
+	}
+}
+
+func TestLogBatcher_RetryThenGapMarker(t *testing.T) {
+	// 第 1、2 次调用失败（首批重试耗尽），之后成功
+	b, sent := newTestBatcher(1024, func(n int) bool { return n <= 2 })
+
+	b.Add([]byte("l1\n"))
+	b.Add([]byte("l2\n"))
+	b.Flush()
+	if b.Lost() != 2 || len(*sent) != 0 {
+		t.Fatalf("expected first batch lost, lost=%d sent=%v", b.Lost(), *sent)
+	}
+
+	b.Add([]byte("l3\n"))
+	b.Flush()
+	if len(*sent) != 1 {
+		t.Fatalf("expected one batch, got=%v", *sent)
+	}
+	got := (*sent)[0]
+	if got.pos != 2 || !strings.HasPrefix(got.out, "[x-agent] gap: 2 lines lost") || !strings.HasSuffix(got.out, "l3\n") {
+		t.Fatalf("unexpected batch: %+v", got)
+	}
+
+	// 缺口已报告，不再重复
+	b.Add([]byte("l4\n"))
+	b.Flush()
+	if strings.Contains((*sent)[1].out, "gap") {
+		t.Fatalf("gap marker repeated: %+v", (*sent)[1])
+	}
+}
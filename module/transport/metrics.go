@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// metricsReport 指标批量上报（Dt=proto.MCodeSysInfo，kind=metrics），Points 按时间升序
+type metricsReport struct {
+	Kind     string                `json:"kind"`
+	Time     int64                 `json:"time"`
+	Interval int64                 `json:"interval"` // 聚合窗口，秒
+	Points   []common.MetricsPoint `json:"points"`
+}
+
+// metricsBuffer 缓存待发送的聚合结果（内存，有上限），离线期间累积，恢复后分批补发。
+// 超过上限时丢弃最旧的结果
+type metricsBuffer struct {
+	mu     sync.Mutex
+	points []common.MetricsPoint
+	max    int
+}
+
+func newMetricsBuffer(max int) *metricsBuffer {
+	if max <= 0 {
+		max = 1440
+	}
+	return &metricsBuffer{max: max}
+}
+
+// Push 追加一个聚合结果
+func (b *metricsBuffer) Push(p common.MetricsPoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.points = append(b.points, p)
+	if over := len(b.points) - b.max; over > 0 {
+		logrus.WithField("dropped", over).Warn("metricsBuffer: full, drop oldest points")
+		b.points = b.points[over:]
+	}
+}
+
+// Len 待发送数量
+func (b *metricsBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.points)
+}
+
+// Flush 每批最多 batch 个按顺序发送，遇到失败即停止（保留剩余），返回成功发送的数量
+func (b *metricsBuffer) Flush(batch int, send func([]common.MetricsPoint) error) int {
+	if batch <= 0 {
+		batch = 1
+	}
+	b.mu.Lock()
+	pending := b.points
+	b.points = nil
+	b.mu.Unlock()
+
+	sent := 0
+	for sent < len(pending) {
+		end := sent + batch
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if err := send(pending[sent:end]); err != nil {
+			break
+		}
+		sent = end
+	}
+
+	if rest := pending[sent:]; len(rest) > 0 {
+		b.mu.Lock()
+		// Flush 期间新进入的结果排在后面
+		b.points = append(append([]common.MetricsPoint(nil), rest...), b.points...)
+		if over := len(b.points) - b.max; over > 0 {
+			b.points = b.points[over:]
+		}
+		b.mu.Unlock()
+	}
+	return sent
+}
+
+func metricsMessage(points []common.MetricsPoint, interval time.Duration, now time.Time) (*xps.MsgRequest, error) {
+	body, err := json.Marshal(metricsReport{
+		Kind:     InventoryMetrics,
+		Time:     now.Unix(),
+		Interval: int64(interval / time.Second),
+		Points:   points,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &xps.MsgRequest{Dt: proto.MCodeSysInfo, Body: &xps.Body{Stdout: body}}, nil
+}
+
+// FlushMetrics 缓存的聚合结果达到 Metrics.BatchSize 时分批发送；离线时保留，下次继续补发
+func (g *GrpcMgr) FlushMetrics() {
+	batch := viper.GetInt("Metrics.BatchSize")
+	if g.metrics.Len() < batch {
+		return
+	}
+	interval := viper.GetDuration("Metrics.Interval")
+	timeout := viper.GetDuration("Timeout.Report")
+	n := g.metrics.Flush(batch, func(points []common.MetricsPoint) error {
+		msg, err := metricsMessage(points, interval, time.Now())
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err = g.client.Msg(ctx, msg)
+		return err
+	})
+	fields := logrus.Fields{"sent": n, "pending": g.metrics.Len()}
+	if g.metrics.Len() > 0 {
+		logrus.WithFields(fields).Warn("FlushMetrics: send failed, keep pending points")
+		return
+	}
+	logrus.WithFields(fields).Traceln("FlushMetrics: g.client.Msg success")
+}
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+func TestMetricsBuffer_FlushBatchesAndKeepsOnFailure(t *testing.T) {
+	b := newMetricsBuffer(4)
+	for i := int64(1); i <= 5; i++ {
+		b.Push(common.MetricsPoint{Time: i})
+	}
+	// 超过上限丢弃最旧的
+	if b.Len() != 4 {
+		t.Fatalf("len=%d", b.Len())
+	}
+
+	var batches [][]int64
+	calls := 0
+	n := b.Flush(3, func(ps []common.MetricsPoint) error {
+		calls++
+		if calls == 2 {
+			return errors.New("offline")
+		}
+		var ts []int64
+		for _, p := range ps {
+			ts = append(ts, p.Time)
+		}
+		batches = append(batches, ts)
+		return nil
+	})
+	if n != 3 || len(batches) != 1 || batches[0][0] != 2 || batches[0][2] != 4 {
+		t.Fatalf("sent=%d batches=%v", n, batches)
+	}
+	b.Push(common.MetricsPoint{Time: 6})
+	n = b.Flush(3, func(ps []common.MetricsPoint) error {
+		if ps[0].Time != 5 || ps[1].Time != 6 {
+			t.Fatalf("order=%+v", ps)
+		}
+		return nil
+	})
+	if n != 2 || b.Len() != 0 {
+		t.Fatalf("sent=%d pending=%d", n, b.Len())
+	}
+}
+
+func TestMetricsMessage(t *testing.T) {
+	msg, err := metricsMessage([]common.MetricsPoint{{Time: 60, Samples: 6}}, time.Minute, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r metricsReport
+	if err := json.Unmarshal(msg.Body.Stdout, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != InventoryMetrics || r.Interval != 60 || len(r.Points) != 1 {
+		t.Fatalf("report=%s", msg.Body.Stdout)
+	}
+}
@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// networkReport 连接数随时变化，每次上报全量；Hash 只覆盖监听端口，便于 channel 判断端口变化
+func networkReport(info *common.NetworkInfo, now time.Time) (*xps.MsgRequest, error) {
+	s := snapshot{"listening": {}}
+	for _, l := range info.Listening {
+		s.setItem("listening", fmt.Sprintf("%s/%s:%d", l.Proto, l.IP, l.Port), l)
+	}
+	body, err := json.Marshal(inventoryReport{
+		Kind: InventoryNetwork,
+		Type: ReportFull,
+		Hash: s.Hash(),
+		Time: now.Unix(),
+		Full: info,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &xps.MsgRequest{Dt: proto.MCodeSysInfo, Body: &xps.Body{Stdout: body}}, nil
+}
+
+// SendNetworkInfo 上报监听的 TCP/UDP 端口（含进程、用户、可执行文件）与已建立连接按对端的汇总
+func (g *GrpcMgr) SendNetworkInfo() {
+	info, err := common.GetNetworkInfo(viper.GetInt("Network.MaxConnSummaries"))
+	if err != nil {
+		logrus.WithError(err).Warn("SendNetworkInfo: collect connections failed")
+		return
+	}
+	msg, err := networkReport(info, time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+
+	timeout := viper.GetDuration("Timeout.Report")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := g.client.Msg(ctx, msg); err != nil {
+		logrus.Errorln("SendNetworkInfo: g.client.Msg failed = ", err.Error())
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"listening":   len(info.Listening),
+		"established": info.TotalEstablished,
+	}).Traceln("SendNetworkInfo: g.client.Msg success")
+}
@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+func TestNetworkReport_HashCoversListeningOnly(t *testing.T) {
+	info := &common.NetworkInfo{
+		Listening:   []common.ListenSocket{{Proto: "tcp", IP: "0.0.0.0", Port: 22}},
+		Established: []common.ConnSummary{{Proto: "tcp", Direction: common.ConnInbound, RemoteIP: "10.0.0.9", Port: 22, Count: 1}},
+	}
+	decode := func() inventoryReport {
+		msg, err := networkReport(info, time.Unix(1700000000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r inventoryReport
+		if err := json.Unmarshal(msg.Body.Stdout, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	a := decode()
+	if a.Kind != InventoryNetwork || a.Type != ReportFull || a.Full == nil {
+		t.Fatalf("report=%+v", a)
+	}
+
+	info.Established[0].Count = 10
+	if b := decode(); b.Hash != a.Hash {
+		t.Fatalf("connection counts should not change hash")
+	}
+	info.Listening = append(info.Listening, common.ListenSocket{Proto: "tcp", IP: "0.0.0.0", Port: 80})
+	if c := decode(); c.Hash == a.Hash {
+		t.Fatalf("new listening port should change hash")
+	}
+}
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+)
+
+// stableMemInfo 内存中不随负载变化的字段
+type stableMemInfo struct {
+	Total          uint64 `json:"total"`
+	SwapTotal      uint64 `json:"swaptotal"`
+	HugePagesTotal uint64 `json:"hugepagestotal"`
+	HugePageSize   uint64 `json:"hugepagesize"`
+}
+
+// stableFilesystem 文件系统中不随使用量变化的字段
+type stableFilesystem struct {
+	Device      string   `json:"device"`
+	Fstype      string   `json:"fstype"`
+	Opts        []string `json:"opts"`
+	Total       uint64   `json:"total"`
+	InodesTotal uint64   `json:"inodesTotal"`
+}
+
+// osInfoSnapshot 规范化 OS 信息：去掉 uptime、进程数、空闲内存、CPU 当前频率、文件系统用量等易变字段，
+// 网卡的 flags/地址排序后比较；CPU 插槽与内存条按插槽名展开
+func osInfoSnapshot(info *common.OSInfo) snapshot {
+	s := make(snapshot)
+
+	host := info.HostInfo
+	host.Uptime, host.Procs = 0, 0
+	s.setFields("host", host)
+
+	m := info.MemInfo
+	s.setFields("memory", stableMemInfo{
+		Total:          m.Total,
+		SwapTotal:      m.SwapTotal,
+		HugePagesTotal: m.HugePagesTotal,
+		HugePageSize:   m.HugePageSize,
+	})
+
+	s["interfaces"] = make(map[string]json.RawMessage)
+	for _, it := range info.InterfaceInfo {
+		it.Flags = append([]string(nil), it.Flags...)
+		sort.Strings(it.Flags)
+		it.Addrs = append([]proto.InterfaceAddr(nil), it.Addrs...)
+		sort.Slice(it.Addrs, func(i, j int) bool { return it.Addrs[i].Addr < it.Addrs[j].Addr })
+		s.setItem("interfaces", it.Name, it)
+	}
+
+	s["cpu"] = make(map[string]json.RawMessage)
+	for _, c := range info.CPUInfo {
+		c.Mhz = 0
+		s.setItem("cpu", strconv.Itoa(int(c.CPU)), c)
+	}
+
+	if st := info.Storage; st != nil {
+		s["filesystems"] = make(map[string]json.RawMessage)
+		for _, fs := range st.Filesystems {
+			opts := append([]string(nil), fs.Opts...)
+			sort.Strings(opts)
+			s.setItem("filesystems", fs.Mountpoint, stableFilesystem{
+				Device:      fs.Device,
+				Fstype:      fs.Fstype,
+				Opts:        opts,
+				Total:       fs.Total,
+				InodesTotal: fs.InodesTotal,
+			})
+		}
+		s["blockDevices"] = make(map[string]json.RawMessage)
+		for _, d := range st.BlockDevices {
+			s.setItem("blockDevices", d.Name, d)
+		}
+	}
+
+	if info.Platform != nil {
+		s.setFields("platform", info.Platform)
+	}
+
+	if hw := info.Hardware; hw != nil {
+		fields := *hw
+		fields.Processors, fields.Memory = nil, nil
+		s.setFields("hardware", fields)
+		s["processors"] = make(map[string]json.RawMessage)
+		for i, p := range hw.Processors {
+			s.setItem("processors", dmiKey(p.Socket, "", i), p)
+		}
+		s["memoryDimms"] = make(map[string]json.RawMessage)
+		for i, d := range hw.Memory {
+			s.setItem("memoryDimms", dmiKey(d.Locator, d.BankLocator, i), d)
+		}
+	}
+	return s
+}
+
+// dmiKey 插槽名通常唯一，缺失时以序号区分
+func dmiKey(locator, bank string, i int) string {
+	if locator == "" {
+		return "#" + strconv.Itoa(i)
+	}
+	if bank != "" {
+		return bank + "/" + locator
+	}
+	return locator
+}
+
+// newOSInfoReporter OS 信息的全量快照沿用原格式
+func newOSInfoReporter(fullEvery time.Duration) *inventoryReporter {
+	r := newInventoryReporter(InventoryOS, fullEvery)
+	r.legacyFull = true
+	return r
+}
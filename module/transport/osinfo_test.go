@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+)
+
+func testOSInfo() *common.OSInfo {
+	return &common.OSInfo{OSInfo: proto.OSInfo{
+		HostInfo: proto.HostInfoStat{Hostname: "web-1", Uptime: 100, Procs: 200, KernelVersion: "5.15.0"},
+		MemInfo:  proto.VirtualMemoryStat{Total: 8 << 30, Free: 1 << 30, Used: 3 << 30},
+		InterfaceInfo: []proto.InterfaceStat{
+			{Name: "eth0", MTU: 1500, Flags: []string{"up", "broadcast"}, Addrs: []proto.InterfaceAddr{{Addr: "10.0.0.2/24"}, {Addr: "10.0.0.1/24"}}},
+		},
+		CPUInfo: []proto.CPUInfoStat{{CPU: 0, ModelName: "Xeon", Mhz: 2400}},
+	}, Storage: &common.StorageInfo{
+		Filesystems:  []common.FilesystemInfo{{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4", Opts: []string{"rw", "relatime"}, Total: 100 << 30, Used: 10 << 30}},
+		BlockDevices: []common.BlockDeviceInfo{{Name: "sda", Type: "disk", Size: 120 << 30}},
+	}, Hardware: &common.HardwareInfo{
+		BIOS:       common.BIOSInfo{Vendor: "Dell Inc.", Version: "2.17.1"},
+		System:     common.SystemInfo{Product: "PowerEdge R740", Serial: "ABC1234"},
+		Processors: []common.CPUSocket{{Socket: "CPU1", Populated: true, Cores: 20}},
+		Memory:     []common.MemoryDIMM{{Locator: "A1", BankLocator: "BANK 0", SizeMB: 16384}},
+	}}
+}
+
+func TestOSInfoSnapshot_Hardware(t *testing.T) {
+	a, b := testOSInfo(), testOSInfo()
+	b.Hardware.BIOS.Version = "2.18.0"
+	b.Hardware.Memory = append(b.Hardware.Memory, common.MemoryDIMM{Locator: "A2", BankLocator: "BANK 1", SizeMB: 16384})
+
+	got := make(map[string]string)
+	for _, c := range diffSnapshots(osInfoSnapshot(a), osInfoSnapshot(b)) {
+		got[c.Section+"/"+c.Key] = c.Op
+	}
+	if len(got) != 2 || got["hardware/bios"] != ChangeModified || got["memoryDimms/BANK 1/A2"] != ChangeAdded {
+		t.Fatalf("changes=%v", got)
+	}
+}
+
+func TestOSInfoSnapshot_IgnoresVolatileFields(t *testing.T) {
+	a, b := testOSInfo(), testOSInfo()
+	b.HostInfo.Uptime, b.HostInfo.Procs = 9999, 1
+	b.MemInfo.Free, b.MemInfo.Used = 5<<30, 1<<30
+	b.CPUInfo[0].Mhz = 3100
+	b.InterfaceInfo[0].Flags = []string{"broadcast", "up"}
+	b.InterfaceInfo[0].Addrs = []proto.InterfaceAddr{{Addr: "10.0.0.1/24"}, {Addr: "10.0.0.2/24"}}
+	b.Storage.Filesystems[0].Used, b.Storage.Filesystems[0].Opts = 50<<30, []string{"relatime", "rw"}
+	if osInfoSnapshot(a).Hash() != osInfoSnapshot(b).Hash() {
+		t.Fatalf("volatile fields should not change hash: %+v", diffSnapshots(osInfoSnapshot(a), osInfoSnapshot(b)))
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	a, b := testOSInfo(), testOSInfo()
+	b.MemInfo.Total = 16 << 30
+	b.HostInfo.KernelVersion = "6.1.0"
+	b.InterfaceInfo = append(b.InterfaceInfo, proto.InterfaceStat{Name: "eth1", MTU: 9000})
+	b.CPUInfo = nil
+	b.Storage.BlockDevices = append(b.Storage.BlockDevices, common.BlockDeviceInfo{Name: "sdb", Type: "disk", Size: 1 << 40})
+
+	changes := diffSnapshots(osInfoSnapshot(a), osInfoSnapshot(b))
+	got := make(map[string]string)
+	for _, c := range changes {
+		got[c.Section+"/"+c.Key] = c.Op
+	}
+	want := map[string]string{
+		"blockDevices/sdb":   ChangeAdded,
+		"cpu/0":              ChangeRemoved,
+		"host/kernelVersion": ChangeModified,
+		"interfaces/eth1":    ChangeAdded,
+		"memory/total":       ChangeModified,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes=%+v", changes)
+	}
+	for k, op := range want {
+		if got[k] != op {
+			t.Fatalf("%s: got %q want %q (all=%v)", k, got[k], op, got)
+		}
+	}
+}
+
+func TestOSInfoReporter(t *testing.T) {
+	r := newOSInfoReporter(time.Hour)
+	now := time.Unix(1700000000, 0)
+	info := testOSInfo()
+
+	// 首次：全量（原格式）
+	msg, commit, err := r.Next(info, osInfoSnapshot(info), now)
+	if err != nil || msg == nil || msg.Dt != 0 {
+		t.Fatalf("expected full snapshot, msg=%+v err=%v", msg, err)
+	}
+	var full proto.OSInfo
+	if err := json.Unmarshal(msg.Body.Stdout, &full); err != nil || full.HostInfo.Hostname != "web-1" || !strings.Contains(string(msg.Body.Stdout), `"storage"`) {
+		t.Fatalf("full snapshot should be proto.OSInfo: %s", msg.Body.Stdout)
+	}
+	commit()
+
+	info.HostInfo.Uptime++
+	if msg, _, _ := r.Next(info, osInfoSnapshot(info), now.Add(time.Minute)); msg != nil {
+		t.Fatalf("no change expected, got %s", msg.Body.Stdout)
+	}
+
+	// 内存升级：增量；发送失败（未 commit）时下次仍基于旧基线
+	info.MemInfo.Total = 16 << 30
+	msg, _, _ = r.Next(info, osInfoSnapshot(info), now.Add(2*time.Minute))
+	if msg == nil || msg.Dt != proto.MCodeSysInfo {
+		t.Fatalf("expected delta, got %+v", msg)
+	}
+	info.InterfaceInfo = append(info.InterfaceInfo, proto.InterfaceStat{Name: "eth1"})
+	msg, commit, _ = r.Next(info, osInfoSnapshot(info), now.Add(3*time.Minute))
+	var delta inventoryReport
+	if err := json.Unmarshal(msg.Body.Stdout, &delta); err != nil {
+		t.Fatal(err)
+	}
+	if delta.Kind != InventoryOS || delta.Type != ReportDelta || len(delta.Changes) != 2 || delta.BaseHash == "" || delta.Hash == delta.BaseHash {
+		t.Fatalf("delta=%+v", delta)
+	}
+	commit()
+	if msg, _, _ := r.Next(info, osInfoSnapshot(info), now.Add(4*time.Minute)); msg != nil {
+		t.Fatalf("no change expected after commit")
+	}
+
+	// 周期全量与重连
+	if msg, _, _ := r.Next(info, osInfoSnapshot(info), now.Add(time.Hour)); msg == nil || msg.Dt != 0 {
+		t.Fatalf("expected periodic full snapshot")
+	}
+	r.RequestFull()
+	if msg, _, _ := r.Next(info, osInfoSnapshot(info), now.Add(5*time.Minute)); msg == nil || msg.Dt != 0 {
+		t.Fatalf("expected full snapshot after RequestFull")
+	}
+}
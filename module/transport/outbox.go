@@ -0,0 +1,232 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-proto/xps"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// outbox 缓存因连接问题发送失败的任务结果（有上限），连接恢复后按顺序重发，超过上限时丢弃最旧的结果。
+// 配置了 dir 时每条结果单独保存为一个文件（protojson，写临时文件后 rename），内存中只保留索引，
+// agent 重启后由 Load 恢复；重发成功但未来得及删除文件的结果重启后会再发一次（至少一次）。
+type outbox struct {
+	mu    sync.Mutex
+	items []*outboxItem
+	max   int
+	dir   string
+	seq   uint64 // 文件序号，保证重启后的发送顺序
+}
+
+type outboxItem struct {
+	seq uint64
+	id  string
+	msg *xps.MsgRequest // 未落盘时保存在内存，已落盘时为 nil，发送前从文件读取
+}
+
+func newOutbox(max int, dir string) *outbox {
+	if max <= 0 {
+		max = 1000
+	}
+	return &outbox{max: max, dir: strings.TrimSpace(dir)}
+}
+
+// retryableSendError 只有连接类错误值得重发；服务端拒绝的结果（超过消息大小限制、InvalidArgument 等）
+// 重发也不会成功
+func retryableSendError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func (o *outbox) path(seq uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d.json", seq))
+}
+
+func (o *outbox) write(seq uint64, m *xps.MsgRequest) error {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(o.dir, 0o700); err != nil {
+		return err
+	}
+	tmp := o.path(seq) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path(seq))
+}
+
+func (o *outbox) read(seq uint64) (*xps.MsgRequest, error) {
+	b, err := os.ReadFile(o.path(seq))
+	if err != nil {
+		return nil, err
+	}
+	m := &xps.MsgRequest{}
+	if err := protojson.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", o.path(seq), err)
+	}
+	return m, nil
+}
+
+// message 返回条目对应的结果
+func (o *outbox) message(it *outboxItem) (*xps.MsgRequest, error) {
+	if it.msg != nil {
+		return it.msg, nil
+	}
+	return o.read(it.seq)
+}
+
+// remove 删除条目的落盘文件
+func (o *outbox) remove(it *outboxItem) {
+	if it.msg == nil {
+		_ = os.Remove(o.path(it.seq))
+	}
+}
+
+// Load 从 dir 恢复待重发结果，须在 Push 之前调用；目录不存在视为空
+func (o *outbox) Load() error {
+	if o.dir == "" {
+		return nil
+	}
+	des, err := os.ReadDir(o.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// ReadDir 按文件名排序，序号定长补零即为发送顺序
+	for _, de := range des {
+		name, ok := strings.CutSuffix(de.Name(), ".json")
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if de.IsDir() || !ok || err != nil {
+			continue
+		}
+		m, err := o.read(seq)
+		if err != nil {
+			logrus.WithError(err).Warn("outbox: drop unreadable result")
+			_ = os.Remove(o.path(seq))
+			continue
+		}
+		o.items = append(o.items, &outboxItem{seq: seq, id: m.Id})
+		o.seq = max(o.seq, seq)
+	}
+	for len(o.items) > o.max {
+		o.remove(o.items[0])
+		o.items = o.items[1:]
+	}
+	logrus.WithField("count", len(o.items)).Infoln("outbox: loaded pending results")
+	return nil
+}
+
+// Push 追加一条待重发结果
+func (o *outbox) Push(m *xps.MsgRequest) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	it := &outboxItem{seq: o.seq, id: m.Id, msg: m}
+	if o.dir != "" {
+		if err := o.write(it.seq, m); err != nil {
+			logrus.WithError(err).WithField("task_id", m.Id).Error("outbox: persist result failed, keep in memory")
+		} else {
+			it.msg = nil
+		}
+	}
+	if len(o.items) >= o.max {
+		logrus.WithField("task_id", o.items[0].id).Warn("outbox: full, drop oldest result")
+		o.remove(o.items[0])
+		o.items = o.items[1:]
+	}
+	o.items = append(o.items, it)
+}
+
+// Len 待重发数量
+func (o *outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// Flush 按顺序重发，返回成功条数。连接类错误时停止并保留剩余结果；
+// 其他错误视为永久失败，丢弃该结果后继续发送，避免一条被拒绝的结果堵住后面所有结果。
+// 发送期间结果仍保留在 items 中，处理完才移除并删除文件，崩溃时不会丢失。
+func (o *outbox) Flush(send func(*xps.MsgRequest) error) int {
+	o.mu.Lock()
+	pending := append([]*outboxItem(nil), o.items...)
+	o.mu.Unlock()
+
+	sent := 0
+	done := make(map[*outboxItem]bool, len(pending))
+	for _, it := range pending {
+		l := logrus.WithField("task_id", it.id)
+		m, err := o.message(it)
+		if err != nil {
+			// 读取失败（包括 Flush 期间因超限被丢弃）
+			l.WithError(err).Warn("outbox: read result failed, drop")
+			done[it] = true
+			continue
+		}
+		if err := send(m); err != nil {
+			if retryableSendError(err) {
+				break
+			}
+			l.WithError(err).Error("outbox: result rejected, drop")
+			done[it] = true
+			continue
+		}
+		done[it] = true
+		sent++
+	}
+	if len(done) == 0 {
+		return 0
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Flush 期间可能有新结果进入或旧结果因超限被丢弃，按指针移除已处理的
+	rest := make([]*outboxItem, 0, len(o.items))
+	for _, it := range o.items {
+		if done[it] {
+			o.remove(it)
+		} else {
+			rest = append(rest, it)
+		}
+	}
+	o.items = rest
+	return sent
+}
+
+// FlushOutbox 重发 outbox 中缓存的任务结果
+func (g *GrpcMgr) FlushOutbox() {
+	if g.outbox.Len() == 0 {
+		return
+	}
+	timeout := viper.GetDuration("Timeout.Report")
+	n := g.outbox.Flush(func(m *xps.MsgRequest) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := g.client.Msg(ctx, m)
+		return err
+	})
+	logrus.WithFields(logrus.Fields{
+		"sent":    n,
+		"pending": g.outbox.Len(),
+	}).Infoln("FlushOutbox: done")
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+// 软件包增量类型：版本变化细分为升级/降级
+const (
+	ChangeUpgraded   = "upgraded"
+	ChangeDowngraded = "downgraded"
+)
+
+// packageList 软件包全量内容
+type packageList struct {
+	Source   string           `json:"source"` // dpkg/rpm
+	Packages []common.Package `json:"packages"`
+}
+
+// packageEntry 按 name:arch 聚合；同名同架构可并存多个版本（如 kernel），Version 取最高版本
+type packageEntry struct {
+	Name     string   `json:"name"`
+	Arch     string   `json:"arch"`
+	Version  string   `json:"version"`
+	Versions []string `json:"versions,omitempty"` // 多版本并存时的全部版本
+}
+
+// packagesSnapshot 以 name:arch 为 key
+func packagesSnapshot(pkgs []common.Package) snapshot {
+	entries := make(map[string]*packageEntry)
+	var order []string
+	for _, p := range pkgs {
+		key := p.Name + ":" + p.Arch
+		e, ok := entries[key]
+		if !ok {
+			e = &packageEntry{Name: p.Name, Arch: p.Arch, Version: p.Version}
+			entries[key] = e
+			order = append(order, key)
+		} else if common.CompareVersions(p.Version, e.Version) > 0 {
+			e.Version = p.Version
+		}
+		e.Versions = append(e.Versions, p.Version)
+	}
+
+	s := snapshot{"packages": make(map[string]json.RawMessage, len(entries))}
+	for _, key := range order {
+		e := entries[key]
+		if len(e.Versions) == 1 {
+			e.Versions = nil
+		}
+		s.setItem("packages", key, e)
+	}
+	return s
+}
+
+// annotatePackageChanges 版本变化标记为 upgraded/downgraded
+func annotatePackageChanges(changes []snapshotChange) {
+	for i := range changes {
+		c := &changes[i]
+		if c.Op != ChangeModified {
+			continue
+		}
+		var o, n packageEntry
+		if json.Unmarshal(c.Old, &o) != nil || json.Unmarshal(c.New, &n) != nil {
+			continue
+		}
+		switch common.CompareVersions(n.Version, o.Version) {
+		case 1:
+			c.Op = ChangeUpgraded
+		case -1:
+			c.Op = ChangeDowngraded
+		}
+	}
+}
+
+func newPackagesReporter(fullEvery time.Duration) *inventoryReporter {
+	r := newInventoryReporter(InventoryPackages, fullEvery)
+	r.annotate = annotatePackageChanges
+	return r
+}
+
+// SendPackages 软件包清单变化时上报增量（added/removed/upgraded/downgraded），首次、重连后及每
+// IntervalTick.PackagesFull 上报全量
+func (g *GrpcMgr) SendPackages() {
+	source, pkgs, err := common.GetInstalledPackages()
+	if err != nil {
+		logrus.WithError(err).Warn("SendPackages: read installed packages failed")
+		return
+	}
+	msg, commit, err := g.pkgs.Next(&packageList{Source: source, Packages: pkgs}, packagesSnapshot(pkgs), time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	if msg == nil {
+		logrus.Traceln("SendPackages: packages not changed")
+		return
+	}
+
+	timeout := viper.GetDuration("Timeout.Report")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := g.client.Msg(ctx, msg); err != nil {
+		logrus.Errorln("SendPackages: g.client.Msg failed = ", err.Error())
+		return
+	}
+	commit()
+	logrus.WithFields(logrus.Fields{"source": source, "packages": len(pkgs), "bytes": len(msg.Body.Stdout)}).Infoln("SendPackages: g.client.Msg success")
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+)
+
+func TestPackagesReporter_Delta(t *testing.T) {
+	r := newPackagesReporter(24 * time.Hour)
+	now := time.Unix(1700000000, 0)
+	before := []common.Package{
+		{Name: "bash", Version: "5.1-6", Arch: "amd64"},
+		{Name: "curl", Version: "7.81.0-1", Arch: "amd64"},
+		{Name: "kernel", Version: "5.14.0-70.el9", Arch: "x86_64"},
+		{Name: "vim", Version: "2:8.2-1", Arch: "amd64"},
+	}
+	msg, commit, err := r.Next(&packageList{Source: common.PackageSourceDpkg, Packages: before}, packagesSnapshot(before), now)
+	if err != nil || msg == nil || msg.Dt != proto.MCodeSysInfo {
+		t.Fatalf("expected full report, msg=%+v err=%v", msg, err)
+	}
+	var full inventoryReport
+	if err := json.Unmarshal(msg.Body.Stdout, &full); err != nil || full.Kind != InventoryPackages || full.Type != ReportFull || full.Full == nil {
+		t.Fatalf("full=%s", msg.Body.Stdout)
+	}
+	commit()
+
+	after := []common.Package{
+		{Name: "bash", Version: "5.1-6", Arch: "amd64"},
+		{Name: "curl", Version: "7.81.0-2", Arch: "amd64"},
+		{Name: "jq", Version: "1.6-2", Arch: "amd64"},
+		{Name: "kernel", Version: "5.14.0-70.el9", Arch: "x86_64"},
+		{Name: "kernel", Version: "5.14.0-362.el9", Arch: "x86_64"},
+		{Name: "vim", Version: "2:8.1-1", Arch: "amd64"},
+	}
+	msg, _, err = r.Next(&packageList{Packages: after}, packagesSnapshot(after), now.Add(time.Hour))
+	if err != nil || msg == nil {
+		t.Fatalf("expected delta, err=%v", err)
+	}
+	var delta inventoryReport
+	if err := json.Unmarshal(msg.Body.Stdout, &delta); err != nil || delta.Type != ReportDelta {
+		t.Fatalf("delta=%s", msg.Body.Stdout)
+	}
+	got := make(map[string]string)
+	for _, c := range delta.Changes {
+		got[c.Key] = c.Op
+	}
+	want := map[string]string{
+		"curl:amd64":    ChangeUpgraded,
+		"jq:amd64":      ChangeAdded,
+		"kernel:x86_64": ChangeUpgraded,
+		"vim:amd64":     ChangeDowngraded,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes=%v", got)
+	}
+	for k, op := range want {
+		if got[k] != op {
+			t.Fatalf("%s: got %q want %q", k, got[k], op)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// ProcessRequest Extra.Processes：按需返回进程列表
+type ProcessRequest struct {
+	Sort  string `json:"sort,omitempty"`  // cpu/mem/pid，默认 cpu
+	Limit int    `json:"limit,omitempty"` // <=0 表示全部
+	User  string `json:"user,omitempty"`  // 只返回该用户的进程
+}
+
+// processTop 周期上报的资源占用排行
+type processTop struct {
+	Total  int                  `json:"total"`
+	TopCPU []common.ProcessInfo `json:"topCpu"`
+	TopMem []common.ProcessInfo `json:"topMem"`
+}
+
+// processList 按需查询的进程列表
+type processList struct {
+	Total     int                  `json:"total"` // 过滤后的进程数
+	Processes []common.ProcessInfo `json:"processes"`
+}
+
+// processTopReport CPU 与内存占用前 n 的进程（kind=processes，每次全量）
+func processTopReport(procs []common.ProcessInfo, n int, now time.Time) (*xps.MsgRequest, error) {
+	body, err := json.Marshal(inventoryReport{
+		Kind: InventoryProcesses,
+		Type: ReportFull,
+		Time: now.Unix(),
+		Full: processTop{
+			Total:  len(procs),
+			TopCPU: common.TopProcesses(procs, common.ProcessSortCPU, n),
+			TopMem: common.TopProcesses(procs, common.ProcessSortMem, n),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &xps.MsgRequest{Dt: proto.MCodeSysInfo, Body: &xps.Body{Stdout: body}}, nil
+}
+
+// SendProcesses 采样进程并上报 CPU/内存占用排行（Process.TopN）
+func (g *GrpcMgr) SendProcesses() {
+	procs, err := g.procs.Sample()
+	if err != nil {
+		logrus.WithError(err).Warn("SendProcesses: sample processes failed")
+		return
+	}
+	msg, err := processTopReport(procs, viper.GetInt("Process.TopN"), time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+
+	timeout := viper.GetDuration("Timeout.Report")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := g.client.Msg(ctx, msg); err != nil {
+		logrus.Errorln("SendProcesses: g.client.Msg failed = ", err.Error())
+		return
+	}
+	logrus.WithField("total", len(procs)).Traceln("SendProcesses: g.client.Msg success")
+}
+
+// serveProcesses 响应 channel 查询完整进程列表的请求；使用独立的采样器，
+// CPU 使用率为上次按需查询以来（首次查询为进程启动以来）的平均值
+func (g *GrpcMgr) serveProcesses(id string, code uint32, req *ProcessRequest, l *logrus.Entry) {
+	if req == nil {
+		req = &ProcessRequest{}
+	}
+	fail := func(msg string) {
+		l.WithField("processes", req).Warn("serveProcesses: " + msg)
+		g.sendResult(id, code, &xps.Body{Code: -1, Stderr: []byte(msg)}, xps.Status_FAIL)
+	}
+	sortBy := strings.TrimSpace(req.Sort)
+	switch sortBy {
+	case "":
+		sortBy = common.ProcessSortCPU
+	case common.ProcessSortCPU, common.ProcessSortMem, common.ProcessSortPid:
+	default:
+		fail("unknown sort field: " + req.Sort)
+		return
+	}
+
+	procs, err := g.procQuery.Sample()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if user := strings.TrimSpace(req.User); user != "" {
+		kept := procs[:0]
+		for _, p := range procs {
+			if p.User == user {
+				kept = append(kept, p)
+			}
+		}
+		procs = kept
+	}
+	total := len(procs)
+	procs = common.TopProcesses(procs, sortBy, req.Limit)
+
+	b, err := json.Marshal(processList{Total: total, Processes: procs})
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	g.sendResult(id, code, &xps.Body{Stdout: b}, xps.Status_SUCC)
+}
@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+func TestProcessTopReport(t *testing.T) {
+	procs := []common.ProcessInfo{
+		{Pid: 1, CPUPercent: 1, RSS: 300},
+		{Pid: 2, CPUPercent: 90, RSS: 100},
+		{Pid: 3, CPUPercent: 5, RSS: 900},
+	}
+	msg, err := processTopReport(procs, 1, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		Kind string     `json:"kind"`
+		Full processTop `json:"full"`
+	}
+	if err := json.Unmarshal(msg.Body.Stdout, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != InventoryProcesses || r.Full.Total != 3 || len(r.Full.TopCPU) != 1 || r.Full.TopCPU[0].Pid != 2 || r.Full.TopMem[0].Pid != 3 {
+		t.Fatalf("report=%s", msg.Body.Stdout)
+	}
+}
@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// 任务优先级（Extra.Priority），同一优先级内先进先出
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal" // 默认
+	PriorityLow    = "low"
+)
+
+var priorityLevels = map[string]int{
+	PriorityHigh:   0,
+	PriorityNormal: 1,
+	PriorityLow:    2,
+}
+
+const numPriorities = 3
+
+var (
+	errQueueFull   = errors.New("rejected: task queue full")
+	errQueueClosed = errors.New("rejected: agent is shutting down")
+	errPreempted   = errors.New("rejected: preempted by higher priority task")
+)
+
+// priorityLevel 未知优先级按 normal 处理
+func priorityLevel(p string) int {
+	if lv, ok := priorityLevels[p]; ok {
+		return lv
+	}
+	return priorityLevels[PriorityNormal]
+}
+
+// queuedTask 排队中的任务
+type queuedTask struct {
+	cr       *xps.CmdReply
+	code     uint32 // 结果上报类型，拒绝时使用
+	class    string
+	priority int
+	// locks 执行前需持有的命名锁，lockDeadline 之后仍未获取则出队并以 lockErr 失败
+	locks        []string
+	lockDeadline time.Time
+	queuedAt     time.Time
+	lockWait     time.Duration // 出队时已等待锁的时长
+	lockErr      error
+}
+
+// taskQueue 带优先级、分类并发上限与命名锁的任务队列。
+// Pop 取优先级最高、所属分类未达并发上限且声明的锁均空闲的最早任务（同时占用这些锁）；
+// 等待锁超时的任务带 lockErr 出队；
+// 队列满时新任务若优先级更高，则挤掉排在最后的最低优先级任务，否则拒绝新任务。
+type taskQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	levels [numPriorities][]*queuedTask
+	size   int
+	max    int
+	limits map[string]int  // 分类 -> 并发上限，未配置的分类只受 worker 数限制
+	active map[string]int  // 分类 -> 执行中任务数
+	held   map[string]bool // 执行中任务持有的锁
+	closed bool
+}
+
+func newTaskQueue(max int, limits map[string]int) *taskQueue {
+	if max <= 0 {
+		max = 200
+	}
+	q := &taskQueue{
+		max:    max,
+		limits: map[string]int{},
+		active: map[string]int{},
+		held:   map[string]bool{},
+	}
+	for class, n := range limits {
+		if n > 0 {
+			q.limits[class] = n
+		}
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push 入队；返回被挤出的任务（需回传拒绝结果）或拒绝新任务的原因
+func (q *taskQueue) Push(t *queuedTask) (*queuedTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, errQueueClosed
+	}
+
+	var evicted *queuedTask
+	if q.size >= q.max {
+		lowest := numPriorities - 1
+		for lowest > t.priority && len(q.levels[lowest]) == 0 {
+			lowest--
+		}
+		if lowest <= t.priority {
+			return nil, errQueueFull
+		}
+		n := len(q.levels[lowest])
+		evicted = q.levels[lowest][n-1]
+		q.levels[lowest] = q.levels[lowest][:n-1]
+		q.size--
+	}
+
+	q.levels[t.priority] = append(q.levels[t.priority], t)
+	q.size++
+	if t.queuedAt.IsZero() {
+		t.queuedAt = time.Now()
+	}
+	if len(t.locks) > 0 && !t.lockDeadline.IsZero() {
+		// 到期时唤醒 worker 使超时任务出队
+		time.AfterFunc(time.Until(t.lockDeadline), q.cond.Broadcast)
+	}
+	q.cond.Signal()
+	return evicted, nil
+}
+
+// Pop 阻塞直到有可执行任务；返回的 done 在任务结束后调用以释放分类并发额度。
+// 队列关闭后返回 ok=false。
+func (q *taskQueue) Pop() (t *queuedTask, done func(), ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return nil, nil, false
+		}
+		if t = q.takeLocked(); t != nil {
+			break
+		}
+		q.cond.Wait()
+	}
+
+	q.active[t.class]++
+	class, locks := t.class, t.locks
+	if t.lockErr != nil {
+		locks = nil
+	}
+	return t, func() {
+		q.mu.Lock()
+		q.active[class]--
+		for _, n := range locks {
+			delete(q.held, n)
+		}
+		q.mu.Unlock()
+		// 释放额度后，之前因分类满而等待的 worker 可能可以继续
+		q.cond.Broadcast()
+	}, true
+}
+
+func (q *taskQueue) takeLocked() *queuedTask {
+	now := time.Now()
+	for lv := range q.levels {
+		for i, t := range q.levels[lv] {
+			if !q.locksFreeLocked(t.locks) {
+				if t.lockDeadline.IsZero() || now.Before(t.lockDeadline) {
+					continue
+				}
+				t.lockErr = lockTimeoutError(t.locks, now.Sub(t.queuedAt))
+			} else if limit, ok := q.limits[t.class]; ok && q.active[t.class] >= limit {
+				continue
+			}
+			q.levels[lv] = append(q.levels[lv][:i], q.levels[lv][i+1:]...)
+			q.size--
+			if t.lockErr == nil && len(t.locks) > 0 {
+				for _, n := range t.locks {
+					q.held[n] = true
+				}
+				t.lockWait = now.Sub(t.queuedAt)
+			}
+			return t
+		}
+	}
+	return nil
+}
+
+func (q *taskQueue) locksFreeLocked(locks []string) bool {
+	for _, n := range locks {
+		if q.held[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// Len 排队中的任务数
+func (q *taskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close 关闭队列并唤醒全部 worker，未执行的任务丢弃
+func (q *taskQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-proto/xps"
+)
+
+func qt(id, class, priority string) *queuedTask {
+	return &queuedTask{cr: &xps.CmdReply{Id: id}, class: class, priority: priorityLevel(priority)}
+}
+
+func popID(t *testing.T, q *taskQueue) (string, func()) {
+	t.Helper()
+	type res struct {
+		t    *queuedTask
+		done func()
+	}
+	ch := make(chan res, 1)
+	go func() {
+		t, done, _ := q.Pop()
+		ch <- res{t, done}
+	}()
+	select {
+	case r := <-ch:
+		return r.t.cr.Id, r.done
+	case <-time.After(time.Second):
+		t.Fatalf("pop blocked")
+		return "", nil
+	}
+}
+
+func TestTaskQueue_PriorityOrder(t *testing.T) {
+	q := newTaskQueue(10, nil)
+	for _, task := range []*queuedTask{
+		qt("low", "", PriorityLow),
+		qt("n1", "", ""),
+		qt("high", "", PriorityHigh),
+		qt("n2", "", PriorityNormal),
+	} {
+		if _, err := q.Push(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"high", "n1", "n2", "low"} {
+		if got, _ := popID(t, q); got != want {
+			t.Fatalf("got=%s want=%s", got, want)
+		}
+	}
+}
+
+func TestTaskQueue_ClassLimit(t *testing.T) {
+	q := newTaskQueue(10, map[string]int{"deploy": 1})
+	_, _ = q.Push(qt("d1", "deploy", PriorityHigh))
+	_, _ = q.Push(qt("d2", "deploy", PriorityHigh))
+	_, _ = q.Push(qt("p1", "probe", PriorityLow))
+
+	got, doneD1 := popID(t, q)
+	if got != "d1" {
+		t.Fatalf("got=%s want=d1", got)
+	}
+	// deploy 已达上限，跳过 d2
+	if got, _ := popID(t, q); got != "p1" {
+		t.Fatalf("got=%s want=p1", got)
+	}
+
+	waiting := make(chan string, 1)
+	go func() {
+		t, _, _ := q.Pop()
+		waiting <- t.cr.Id
+	}()
+	select {
+	case id := <-waiting:
+		t.Fatalf("expected d2 blocked by class limit, got=%s", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	doneD1()
+	select {
+	case id := <-waiting:
+		if id != "d2" {
+			t.Fatalf("got=%s want=d2", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("d2 not released after d1 done")
+	}
+}
+
+func TestTaskQueue_FullRejectAndPreempt(t *testing.T) {
+	q := newTaskQueue(2, nil)
+	_, _ = q.Push(qt("n1", "", PriorityNormal))
+	_, _ = q.Push(qt("l1", "", PriorityLow))
+
+	if _, err := q.Push(qt("l2", "", PriorityLow)); err != errQueueFull {
+		t.Fatalf("expected queue full, got=%v", err)
+	}
+	evicted, err := q.Push(qt("h1", "", PriorityHigh))
+	if err != nil || evicted == nil || evicted.cr.Id != "l1" {
+		t.Fatalf("expected l1 preempted, evicted=%v err=%v", evicted, err)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("len=%d", q.Len())
+	}
+
+	q.Close()
+	if _, err := q.Push(qt("x", "", PriorityHigh)); err != errQueueClosed {
+		t.Fatalf("expected closed, got=%v", err)
+	}
+	if _, _, ok := q.Pop(); ok {
+		t.Fatalf("expected pop to stop after close")
+	}
+}
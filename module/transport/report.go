@@ -12,17 +12,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
-	"encoding/json"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
 	"github.com/xulei1234/x-proto/xps"
 	"time"
 )
 
 var (
-	agentmd5  = make([]byte, 16)
-	osInfomd5 = make([]byte, 16)
+	agentmd5 = make([]byte, 16)
 )
 
 // bool indicate whether if report forcely
@@ -32,14 +31,15 @@ func (g *GrpcMgr) SendAgentInfo(force bool) {
 		Ip:       common.GetConfigIP(),
 		Version:  common.Version,
 		Idc:      common.GetDeviceZone(),
+		Region:   common.GetDeviceRegion(),
 	}
 	sum := md5.Sum([]byte(in.String()))
 	hash := sum[:] // to bytes
 	if bytes.Compare(hash, agentmd5) == 0 && !force {
-		logrus.Traceln("SendAgentInfo: Hostname & Ip & Version & Idc not changed")
+		logrus.Traceln("SendAgentInfo: Hostname & Ip & Version & Idc & Region not changed")
 		return
 	}
-	logrus.Warnf("SendAgentInfo: Hostname & Ip & Version & Idc changed, should upload")
+	logrus.Warnf("SendAgentInfo: Hostname & Ip & Version & Idc & Region changed, should upload")
 	timeout := viper.GetDuration("Timeout.Report")
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -49,34 +49,28 @@ func (g *GrpcMgr) SendAgentInfo(force bool) {
 		logrus.Error("SendAgentInfo: RegisterAgent failed: ", err.Error())
 	} else {
 		copy(agentmd5, hash)
-		logrus.Infoln("SendAgentInfo：RegisterAgent upload Suc :", in)
+		logrus.Infoln("SendAgentInfo：RegisterAgent upload Suc :", in.String())
 	}
 
 }
 
+// SendOSInfo 内容（不含易变字段）变化时上报增量，首次、重连后及每 IntervalTick.OSInfoFull 上报全量快照
 func (g *GrpcMgr) SendOSInfo() {
-	req := common.GetDeviceOsInfo()
-	body, marshErr := json.Marshal(req)
-	if marshErr != nil {
-		logrus.Error(marshErr.Error())
+	info := common.GetDeviceOsInfo()
+	msg, commit, err := g.osinfo.Next(info, osInfoSnapshot(info), time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
 		return
 	}
-
-	msg := &xps.MsgRequest{
-		Id: "",
-		//Type: proto.MsgTypeSysInfo,
-		Body: &xps.Body{
-			Code:   0,
-			Stdout: body,
-		},
-	}
-	sum := md5.Sum([]byte(req.HostInfo.Hostname))
-	hash := sum[:] // to bytes
-	if bytes.Compare(hash, osInfomd5) == 0 {
+	if msg == nil {
 		logrus.Traceln("SendOSInfo: common.GetDeviceOsInfo()  has not changed ")
 		return
 	}
-	logrus.Warnf("SendOSInfo: common.GetDeviceOsInfo()  has changed, will upload with client.Msg ")
+	kind := "full"
+	if msg.Dt == proto.MCodeSysInfo {
+		kind = "delta"
+	}
+	logrus.WithField("kind", kind).Infoln("SendOSInfo: os info changed, will upload with client.Msg ")
 	timeout := viper.GetDuration("Timeout.Report")
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	logrus.Traceln("SendOSInfo: g.client.Msg timeout = ", timeout)
@@ -84,12 +78,12 @@ func (g *GrpcMgr) SendOSInfo() {
 	if _, err := g.client.Msg(ctx, msg); err != nil {
 		logrus.Errorln("SendOSInfo: g.client.Msg failed = ", err.Error())
 	} else {
-		copy(osInfomd5, hash)
-		logrus.Infoln("SendOSInfo: g.client.Msg success ", req)
+		commit()
+		logrus.WithField("kind", kind).Infoln("SendOSInfo: g.client.Msg success ", string(msg.Body.Stdout))
 	}
 }
 
-func (g *GrpcMgr) SendMsgResult(id string, code uint32, body *xps.Body, status xps.Status) {
+func (g *GrpcMgr) SendMsgResult(id string, code uint32, body *xps.Body, status xps.Status) error {
 	timeout := viper.GetDuration("Timeout.Report")
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -106,10 +100,22 @@ func (g *GrpcMgr) SendMsgResult(id string, code uint32, body *xps.Body, status x
 	} else {
 		logrus.WithField("task_id", id).Infoln("SendMsgResult: g.client.Msg success ", code, status, body)
 	}
+	return err
+}
 
+// sendResult 发送任务结果：连接类错误放入 outbox 等待重发，服务端拒绝的结果重发也不会成功，记录后丢弃
+func (g *GrpcMgr) sendResult(id string, code uint32, body *xps.Body, status xps.Status) {
+	err := g.SendMsgResult(id, code, body, status)
+	switch {
+	case err == nil:
+	case retryableSendError(err):
+		g.outbox.Push(&xps.MsgRequest{Id: id, Dt: code, Body: body})
+	default:
+		logrus.WithField("task_id", id).WithError(err).Error("sendResult: result rejected, dropped")
+	}
 }
 
-func (g *GrpcMgr) SendLocalLog(id string, pos int32, out string, pc int32) {
+func (g *GrpcMgr) SendLocalLog(id string, pos int32, out string, pc int32) error {
 	timeout := viper.GetDuration("Timeout.Report")
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	logrus.Traceln("SendLocalLog： timeout = ", timeout)
@@ -130,7 +136,7 @@ func (g *GrpcMgr) SendLocalLog(id string, pos int32, out string, pc int32) {
 	} else {
 		logrus.WithField("task_id", id).Traceln("SendLocalLog： g.client.Log success ", out)
 	}
-
+	return err
 }
 
 func (g *GrpcMgr) SendHeartBeat() {
@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// RetryPolicy 任务重试策略（Extra.Retry）。
+// 未配置 ExitCodes/StderrPatterns 时任何非 0 退出都重试；配置后满足任一条件才重试。
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"max_attempts"`              // 总执行次数（含首次），<=1 不重试
+	Backoff        string   `json:"backoff,omitempty"`         // 首次重试前等待，默认 1s
+	MaxBackoff     string   `json:"max_backoff,omitempty"`     // 等待上限，默认 1m
+	Multiplier     float64  `json:"multiplier,omitempty"`      // 等待倍增系数，默认 2
+	ExitCodes      []int32  `json:"exit_codes,omitempty"`      // 可重试的退出码
+	StderrPatterns []string `json:"stderr_patterns,omitempty"` // 可重试的 stderr 正则
+}
+
+// retryPolicy 校验后的重试策略
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	multiplier  float64
+	exitCodes   map[int32]bool
+	patterns    []*regexp.Regexp
+}
+
+// newRetryPolicy 校验并补全默认值，p 为 nil 表示不重试
+func newRetryPolicy(p *RetryPolicy) (*retryPolicy, error) {
+	rp := &retryPolicy{
+		maxAttempts: 1,
+		backoff:     time.Second,
+		maxBackoff:  time.Minute,
+		multiplier:  2,
+	}
+	if p == nil {
+		return rp, nil
+	}
+
+	if p.MaxAttempts > 1 {
+		rp.maxAttempts = p.MaxAttempts
+	}
+	if p.Backoff != "" {
+		d, err := time.ParseDuration(p.Backoff)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid retry backoff %q", p.Backoff)
+		}
+		rp.backoff = d
+	}
+	if p.MaxBackoff != "" {
+		d, err := time.ParseDuration(p.MaxBackoff)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid retry max_backoff %q", p.MaxBackoff)
+		}
+		rp.maxBackoff = d
+	}
+	if p.Multiplier >= 1 {
+		rp.multiplier = p.Multiplier
+	}
+	if len(p.ExitCodes) > 0 {
+		rp.exitCodes = make(map[int32]bool, len(p.ExitCodes))
+		for _, c := range p.ExitCodes {
+			rp.exitCodes[c] = true
+		}
+	}
+	for _, s := range p.StderrPatterns {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry stderr pattern %q: %w", s, err)
+		}
+		rp.patterns = append(rp.patterns, re)
+	}
+	return rp, nil
+}
+
+// Retryable 判断本次失败是否值得重试；stderr 为进程的标准错误输出（流式任务为实时回传部分的末尾）
+func (p *retryPolicy) Retryable(body *xps.Body, stderr []byte) bool {
+	if body == nil || body.Code == 0 {
+		return false
+	}
+	if p.exitCodes == nil && p.patterns == nil {
+		return true
+	}
+	if p.exitCodes[body.Code] {
+		return true
+	}
+	for _, re := range p.patterns {
+		if re.Match(stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryStderrTail 流式任务保留用于匹配 StderrPatterns 的 stderr 末尾字节数
+const retryStderrTail = 64 << 10
+
+// stderrTail 保留写入内容的最后 max 字节；流式任务的 stderr 已实时回传，Body.Stderr 中没有进程输出
+type stderrTail struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func newStderrTail(max int) *stderrTail {
+	return &stderrTail{max: max}
+}
+
+func (t *stderrTail) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, b...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(b), nil
+}
+
+// Bytes 当前保留内容的副本
+func (t *stderrTail) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte(nil), t.buf...)
+}
+
+// Delay 第 attempt 次执行失败后的等待时间（指数退避，封顶 maxBackoff）
+func (p *retryPolicy) Delay(attempt int) time.Duration {
+	d := float64(p.backoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.multiplier
+		if d >= float64(p.maxBackoff) {
+			return p.maxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+// attemptRecord 每次执行的结果，以日志行回传
+type attemptRecord struct {
+	Attempt     int    `json:"attempt"`
+	MaxAttempts int    `json:"max_attempts"`
+	Code        int32  `json:"code"`
+	Stdout      string `json:"stdout,omitempty"`
+	Stderr      string `json:"stderr,omitempty"`
+	RetryInMs   int64  `json:"retry_in_ms,omitempty"`
+	Final       bool   `json:"final,omitempty"`
+}
+
+// reportAttempt 回传一次执行的结果（流式任务的输出已实时回传，这里不再重复）
+func (g *GrpcMgr) reportAttempt(id string, pos *int32, rec attemptRecord, withOutput bool, body *xps.Body, l *logrus.Entry) {
+	rec.Code = body.Code
+	if withOutput {
+		rec.Stdout = string(body.Stdout)
+		rec.Stderr = string(body.Stderr)
+	}
+	l.WithFields(logrus.Fields{
+		"attempt": rec.Attempt,
+		"code":    rec.Code,
+		"final":   rec.Final,
+	}).Infoln("ConsumerCmd: attempt finished")
+
+	b, _ := json.Marshal(rec)
+	_ = g.SendLocalLog(id, *pos, "[x-agent] attempt "+string(b)+"\n", 0)
+	*pos++
+}
@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	proto "github.com/xulei1234/x-proto"
+	"github.com/xulei1234/x-proto/xps"
+	"google.golang.org/grpc"
+)
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	p, err := newRetryPolicy(nil)
+	if err != nil || p.maxAttempts != 1 {
+		t.Fatalf("nil policy should mean no retry, p=%+v err=%v", p, err)
+	}
+
+	p, err = newRetryPolicy(&RetryPolicy{MaxAttempts: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Retryable(&xps.Body{Code: 0}, nil) || !p.Retryable(&xps.Body{Code: 1}, nil) {
+		t.Fatalf("without filters any non-zero exit should be retryable")
+	}
+
+	p, err = newRetryPolicy(&RetryPolicy{
+		MaxAttempts:    3,
+		ExitCodes:      []int32{75},
+		StderrPatterns: []string{`(?i)connection (refused|reset)`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		body *xps.Body
+		want bool
+	}{
+		{&xps.Body{Code: 75}, true},
+		{&xps.Body{Code: 1, Stderr: []byte("curl: Connection refused")}, true},
+		{&xps.Body{Code: 1, Stderr: []byte("permission denied")}, false},
+		{&xps.Body{Code: 0, Stderr: []byte("connection reset")}, false},
+	}
+	for i, c := range cases {
+		if got := p.Retryable(c.body, c.body.Stderr); got != c.want {
+			t.Fatalf("case %d: got=%v want=%v", i, got, c.want)
+		}
+	}
+
+	if _, err := newRetryPolicy(&RetryPolicy{StderrPatterns: []string{"("}}); err == nil {
+		t.Fatalf("expected invalid pattern error")
+	}
+	if _, err := newRetryPolicy(&RetryPolicy{Backoff: "soon"}); err == nil {
+		t.Fatalf("expected invalid backoff error")
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p, err := newRetryPolicy(&RetryPolicy{MaxAttempts: 5, Backoff: "1s", MaxBackoff: "5s", Multiplier: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Fatalf("attempt %d: got=%v want=%v", i+1, got, w)
+		}
+	}
+}
+
+// logClient 只接收日志行的 XServiceClient
+type logClient struct {
+	xps.XServiceClient
+	mu    sync.Mutex
+	lines []string
+}
+
+func (c *logClient) Log(_ context.Context, in *xps.LogRequest, _ ...grpc.CallOption) (*xps.Empty, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, in.GetLine().GetOut())
+	return &xps.Empty{}, nil
+}
+
+// 流式任务的 stderr 已实时回传，重试判断使用 execAttempt 保留的 stderr 末尾
+func TestExecAttempt_StreamStderrRetry(t *testing.T) {
+	p, err := newRetryPolicy(&RetryPolicy{MaxAttempts: 2, StderrPatterns: []string{`connection refused`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &logClient{}
+	g := &GrpcMgr{client: client}
+	extra := &TaskExtra{CmdExtra: proto.CmdExtra{Code: proto.MCodeLogLine}}
+	l := logrus.NewEntry(logrus.StandardLogger())
+
+	var pos int32
+	cmd := exec.Command("sh", "-c", `echo "curl: connection refused" >&2; exit 7`)
+	body, _, stderr := g.execAttempt(context.Background(), "t1", extra, cmd, &pos, l)
+	if body.Code != 7 || strings.Contains(string(body.Stderr), "refused") {
+		t.Fatalf("unexpected body %+v", body)
+	}
+	if !p.Retryable(body, stderr) {
+		t.Fatalf("stderr=%q should be retryable", stderr)
+	}
+
+	cmd = exec.Command("sh", "-c", `echo "permission denied" >&2; exit 7`)
+	body, _, stderr = g.execAttempt(context.Background(), "t1", extra, cmd, &pos, l)
+	if p.Retryable(body, stderr) {
+		t.Fatalf("stderr=%q should not be retryable", stderr)
+	}
+	if !strings.Contains(strings.Join(client.lines, ""), "connection refused") {
+		t.Fatalf("stderr should still be streamed, lines=%q", client.lines)
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	tail := newStderrTail(4)
+	_, _ = tail.Write([]byte("abc"))
+	_, _ = tail.Write([]byte("def"))
+	if got := string(tail.Bytes()); got != "cdef" {
+		t.Fatalf("got=%q", got)
+	}
+}
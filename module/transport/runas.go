@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/xulei1234/x-agent/module/sandbox"
+)
+
+// runAs 任务的执行身份与环境：目标用户（含附加组）、登录环境、login shell、umask 与沙箱
+type runAs struct {
+	Name  string
+	Home  string
+	Shell string
+	// Cred 为 nil 表示以 agent 当前用户执行
+	Cred *syscall.Credential
+	// LoginShell 通过 `<shell> -l -c` 执行，加载用户的 profile，未指定目录时在家目录执行
+	LoginShell bool
+	// Umask <0 表示不修改
+	Umask int
+	// Sandbox 非 nil 时在 namespace 沙箱中执行，降权由沙箱 init 完成
+	Sandbox *sandbox.Spec
+	// Container 非 nil 时在容器内执行，Name/Home/Shell/Cred 均为容器内的用户
+	Container *containerExec
+}
+
+// lookupRunAs 根据 Extra.User/LoginShell/Umask 构造执行身份；指定的用户不存在时返回错误（不回退为 root）。
+// 未指定用户时 Cred 为 nil，以 agent 当前用户执行，沙箱任务则为 nobody
+func lookupRunAs(extra *TaskExtra) (*runAs, error) {
+	if extra.Container != nil {
+		return lookupContainerRunAs(context.Background(), extra)
+	}
+	ra := &runAs{LoginShell: extra.LoginShell, Umask: -1}
+
+	var err error
+	if ra.Sandbox, err = resolveSandbox(extra); err != nil {
+		return nil, err
+	}
+
+	if s := strings.TrimSpace(extra.Umask); s != "" {
+		m, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || m > 0o777 {
+			return nil, fmt.Errorf("invalid umask %q", extra.Umask)
+		}
+		ra.Umask = int(m)
+	}
+
+	username := strings.TrimSpace(extra.User)
+	var u *user.User
+	if username == "" {
+		u, err = user.Current()
+	} else {
+		u, err = user.Lookup(username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup user %q: %w", username, err)
+	}
+	ra.Name, ra.Home = u.Username, u.HomeDir
+	ra.Shell = "/bin/sh"
+	// os/user 不提供登录 shell，本地用户从 /etc/passwd 读取
+	if pw, _ := lookupPasswd("/etc/passwd", u.Username); pw != nil && pw.Shell != "" {
+		ra.Shell = pw.Shell
+	}
+	if username == "" {
+		if ra.Sandbox != nil {
+			ra.Name, ra.Home, ra.Shell = nobodyIdentity()
+		}
+		return ra, nil
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: invalid uid %q", username, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: invalid gid %q", username, u.Gid)
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("user %q: lookup groups: %w", username, err)
+	}
+	groups := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		if n, err := strconv.ParseUint(id, 10, 32); err == nil && n != gid {
+			groups = append(groups, uint32(n))
+		}
+	}
+
+	ra.Cred = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}
+	if ra.Sandbox != nil {
+		ra.Sandbox.Cred = &sandbox.Credential{Uid: ra.Cred.Uid, Gid: ra.Cred.Gid, Groups: groups}
+	}
+	return ra, nil
+}
+
+// nobodyIdentity 沙箱内 nobody 的用户名与家目录，取自 uid 为 NobodyID 的本地用户。
+// nobody 的登录 shell 通常为 nologin、家目录通常不存在，分别使用 /bin/sh 与 /
+func nobodyIdentity() (name, home, shell string) {
+	name, home = "nobody", "/"
+	if u, err := user.LookupId(strconv.Itoa(sandbox.NobodyID)); err == nil {
+		name = u.Username
+		if fi, err := os.Stat(u.HomeDir); err == nil && fi.IsDir() {
+			home = u.HomeDir
+		}
+	}
+	return name, home, "/bin/sh"
+}
+
+// credential 兼容只需要 uid/gid 的调用方（脚本/文件属主）；未指定用户的沙箱任务以 nobody 执行
+func (r *runAs) credential() *syscall.Credential {
+	if r == nil {
+		return nil
+	}
+	if r.Cred == nil && r.Sandbox != nil {
+		return &syscall.Credential{Uid: sandbox.NobodyID, Gid: sandbox.NobodyID}
+	}
+	return r.Cred
+}
+
+// wrap 需要 login shell 或 umask 时，经 shell 设置后再 exec 原命令（参数原样传递，不经 shell 解析）
+func (r *runAs) wrap(name string, args []string) (string, []string) {
+	if r == nil || (!r.LoginShell && r.Umask < 0) {
+		return name, args
+	}
+	script := `exec "$0" "$@"`
+	if r.Umask >= 0 {
+		script = fmt.Sprintf("umask %04o && %s", r.Umask, script)
+	}
+	shell, flags := "/bin/sh", []string{"-c"}
+	if r.LoginShell {
+		shell, flags = r.Shell, []string{"-l", "-c"}
+	}
+	return shell, append(append(flags, script, name), args...)
+}
+
+// env 以实际执行身份（指定用户、沙箱的 nobody 或 agent 当前用户）覆盖 HOME/USER/LOGNAME/SHELL，
+// 避免继承 agent（root）的值
+func (r *runAs) env(env []string) []string {
+	if r == nil || r.Name == "" {
+		return env
+	}
+	out := make([]string, 0, len(env)+4)
+	for _, kv := range env {
+		switch k, _, _ := strings.Cut(kv, "="); k {
+		case "HOME", "USER", "LOGNAME", "SHELL", "MAIL":
+			continue
+		}
+		out = append(out, kv)
+	}
+	return append(out,
+		"HOME="+r.Home,
+		"USER="+r.Name,
+		"LOGNAME="+r.Name,
+		"SHELL="+r.Shell,
+	)
+}
+
+// withFiles 返回在沙箱中额外保留 paths（如脚本文件）的副本
+func (r *runAs) withFiles(paths ...string) *runAs {
+	if r == nil || r.Sandbox == nil {
+		return r
+	}
+	cp, sb := *r, *r.Sandbox
+	sb.Files = append(append([]string{}, sb.Files...), paths...)
+	cp.Sandbox = &sb
+	return &cp
+}
+
+// dir login shell 模式下未指定目录时在家目录执行
+func (r *runAs) dir(dir string) string {
+	if dir == "" && r != nil && r.LoginShell {
+		return r.Home
+	}
+	return dir
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"os/user"
+	"strings"
+	"syscall"
+	"testing"
+
+	proto "github.com/xulei1234/x-proto"
+)
+
+func TestLookupRunAs(t *testing.T) {
+	if _, err := lookupRunAs(&TaskExtra{CmdExtra: proto.CmdExtra{User: "no-such-user-x-agent"}}); err == nil {
+		t.Fatalf("expected error for missing user")
+	}
+	if _, err := lookupRunAs(&TaskExtra{Umask: "0999"}); err == nil {
+		t.Fatalf("expected error for invalid umask")
+	}
+
+	cur, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	ra, err := lookupRunAs(&TaskExtra{CmdExtra: proto.CmdExtra{User: cur.Username}, Umask: "027"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Cred == nil || ra.Home != cur.HomeDir || ra.Umask != 0o027 {
+		t.Fatalf("unexpected runAs %+v", ra)
+	}
+	for _, g := range ra.Cred.Groups {
+		if g == ra.Cred.Gid {
+			t.Fatalf("primary gid should not be repeated in supplementary groups")
+		}
+	}
+
+	// 未指定用户：不切换身份
+	ra, err = lookupRunAs(&TaskExtra{})
+	if err != nil || ra.Cred != nil {
+		t.Fatalf("expected no credential, ra=%+v err=%v", ra, err)
+	}
+}
+
+func TestRunAs_EnvAndWrap(t *testing.T) {
+	ra := &runAs{Name: "alice", Home: "/home/alice", Shell: "/bin/bash", Cred: &syscall.Credential{Uid: 1001}, Umask: -1}
+	env := ra.env([]string{"PATH=/bin", "HOME=/root", "USER=root", "LOGNAME=root", "FOO=bar"})
+	got := strings.Join(env, " ")
+	if got != "PATH=/bin FOO=bar HOME=/home/alice USER=alice LOGNAME=alice SHELL=/bin/bash" {
+		t.Fatalf("env=%s", got)
+	}
+
+	if name, args := ra.wrap("ls", []string{"-l"}); name != "ls" || len(args) != 1 {
+		t.Fatalf("no wrap expected, got %s %v", name, args)
+	}
+	ra.LoginShell = true
+	name, args := ra.wrap("ls", []string{"-l"})
+	if name != "/bin/bash" || strings.Join(args, "|") != `-l|-c|exec "$0" "$@"|ls|-l` {
+		t.Fatalf("got %s %q", name, args)
+	}
+	if ra.dir("") != "/home/alice" || ra.dir("/tmp") != "/tmp" {
+		t.Fatalf("login shell should default to home dir")
+	}
+}
+
+// 未指定用户的沙箱任务以 nobody 执行，身份相关环境变量不继承 agent 的值
+func TestRunAs_SandboxNobodyEnv(t *testing.T) {
+	enabled := true
+	ra, err := lookupRunAs(&TaskExtra{Sandbox: &SandboxOptions{Enabled: &enabled}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Cred != nil || ra.Sandbox == nil {
+		t.Fatalf("unexpected runAs %+v", ra)
+	}
+	name, home, _ := nobodyIdentity()
+	env := strings.Join(ra.env([]string{"HOME=/root", "USER=root", "LOGNAME=root", "SHELL=/bin/bash"}), " ")
+	if want := "HOME=" + home + " USER=" + name + " LOGNAME=" + name + " SHELL=/bin/sh"; env != want {
+		t.Fatalf("env=%s want=%s", env, want)
+	}
+	if name == "root" || home == "/root" {
+		t.Fatalf("nobody identity should not be root: %s %s", name, home)
+	}
+}
+
+func TestRunAs_UmaskApplied(t *testing.T) {
+	ra := &runAs{Umask: 0o027}
+	cmd, err := gMgr.newTaskCmd(context.Background(), "sh", []string{"-c", "umask; printf '%s|' \"$@\"", "x", "a b", "$HOME"}, "", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != "0027\na b|$HOME|" {
+		t.Fatalf("got=%q", got)
+	}
+}
@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/sandbox"
+)
+
+// SandboxOptions Extra.Sandbox：按任务覆盖 Sandbox.* 配置，未设置的字段使用配置
+type SandboxOptions struct {
+	Enabled  *bool    `json:"enabled,omitempty"`
+	Network  *bool    `json:"network,omitempty"`
+	Writable []string `json:"writable,omitempty"`
+	Tmpfs    []string `json:"tmpfs,omitempty"`
+	Seccomp  string   `json:"seccomp,omitempty"`
+}
+
+// resolveSandbox 合并任务参数与配置策略，返回 nil 表示不隔离。
+// 是否启用：Extra.Sandbox.Enabled > Sandbox.Classes[CmdExtra.Class] > Sandbox.Enabled
+func resolveSandbox(extra *TaskExtra) (*sandbox.Spec, error) {
+	opt := extra.Sandbox
+	if opt == nil {
+		opt = &SandboxOptions{}
+	}
+
+	enabled := viper.GetBool("Sandbox.Enabled")
+	if class := strings.TrimSpace(extra.Class); class != "" {
+		if v, ok := viper.GetStringMap("Sandbox.Classes")[strings.ToLower(class)]; ok {
+			enabled, _ = v.(bool)
+		}
+	}
+	if opt.Enabled != nil {
+		enabled = *opt.Enabled
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	spec := &sandbox.Spec{
+		Network:  viper.GetBool("Sandbox.Network"),
+		Writable: viper.GetStringSlice("Sandbox.Writable"),
+		Tmpfs:    viper.GetStringSlice("Sandbox.Tmpfs"),
+		Seccomp:  viper.GetString("Sandbox.Seccomp"),
+	}
+	if opt.Network != nil {
+		spec.Network = *opt.Network
+	}
+	if opt.Writable != nil {
+		spec.Writable = opt.Writable
+	}
+	if opt.Tmpfs != nil {
+		spec.Tmpfs = opt.Tmpfs
+	}
+	if opt.Seccomp != "" {
+		spec.Seccomp = opt.Seccomp
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/sandbox"
+	proto "github.com/xulei1234/x-proto"
+)
+
+func TestResolveSandbox_Policy(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("Sandbox.Enabled", false)
+	viper.Set("Sandbox.Classes", map[string]interface{}{"diag": true})
+	viper.Set("Sandbox.Tmpfs", []string{"/tmp"})
+	viper.Set("Sandbox.Seccomp", "default")
+
+	if spec, err := resolveSandbox(&TaskExtra{}); err != nil || spec != nil {
+		t.Fatalf("expected disabled by default, spec=%+v err=%v", spec, err)
+	}
+
+	spec, err := resolveSandbox(&TaskExtra{CmdExtra: proto.CmdExtra{Class: "diag"}})
+	if err != nil || spec == nil || spec.Network || len(spec.Tmpfs) != 1 {
+		t.Fatalf("expected class policy to enable sandbox, spec=%+v err=%v", spec, err)
+	}
+
+	on, off := true, false
+	spec, err = resolveSandbox(&TaskExtra{
+		CmdExtra: proto.CmdExtra{Class: "diag"},
+		Sandbox:  &SandboxOptions{Network: &on, Writable: []string{"/var/lib/app"}},
+	})
+	if err != nil || !spec.Network || spec.Writable[0] != "/var/lib/app" {
+		t.Fatalf("task options should override config, spec=%+v err=%v", spec, err)
+	}
+
+	if spec, _ := resolveSandbox(&TaskExtra{CmdExtra: proto.CmdExtra{Class: "diag"}, Sandbox: &SandboxOptions{Enabled: &off}}); spec != nil {
+		t.Fatalf("task should be able to disable sandbox")
+	}
+	if _, err := resolveSandbox(&TaskExtra{Sandbox: &SandboxOptions{Enabled: &on, Writable: []string{"relative"}}}); err == nil {
+		t.Fatalf("expected invalid writable path error")
+	}
+
+	// 未指定用户的沙箱任务：脚本属主为 nobody
+	if cred := (&runAs{Sandbox: &sandbox.Spec{}}).credential(); cred == nil || cred.Uid != sandbox.NobodyID {
+		t.Fatalf("cred=%+v", cred)
+	}
+}
@@ -0,0 +1,291 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xulei1234/x-agent/module/common"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// 错过执行时间（agent 停止/时钟跳变）后的处理策略
+const (
+	MissedSkip    = "skip"     // 跳过，等待下一次（默认）
+	MissedRunOnce = "run_once" // 立即补执行一次
+)
+
+// 定时任务管理动作
+const (
+	ScheduleAdd    = "add"
+	ScheduleRemove = "remove"
+	ScheduleList   = "list"
+)
+
+// Schedule channel 注册到 agent 本地的定时任务，按 agent 自己的时钟执行
+type Schedule struct {
+	ID      string      `json:"id"`
+	Cron    string      `json:"cron"`             // 5 段 cron 或 @hourly/@daily/@every <duration>
+	Jitter  string      `json:"jitter,omitempty"` // 随机延迟上限，如 30s，避免同一时刻集中执行
+	Missed  string      `json:"missed,omitempty"` // skip/run_once
+	Cmd     ScheduleCmd `json:"cmd"`
+	LastRun time.Time   `json:"last_run"` // 上次触发时间（持久化，用于重启后判断是否错过）
+}
+
+// ScheduleCmd 定时执行的命令，字段与 xps.Command 对应
+type ScheduleCmd struct {
+	Name  string          `json:"name"`
+	Dir   string          `json:"dir,omitempty"`
+	Envs  []string        `json:"envs,omitempty"`
+	Args  []string        `json:"args,omitempty"`
+	Extra json.RawMessage `json:"extra,omitempty"`
+}
+
+// ScheduleRequest Extra.Schedule：注册/删除/查询定时任务
+type ScheduleRequest struct {
+	Action   string    `json:"action"`
+	Schedule *Schedule `json:"schedule,omitempty"` // add
+	ID       string    `json:"id,omitempty"`       // remove
+}
+
+type scheduleItem struct {
+	Schedule
+	spec   *common.CronSpec
+	jitter time.Duration
+}
+
+// scheduler 本地定时任务表，变更即落盘到 file
+type scheduler struct {
+	mu    sync.Mutex
+	file  string
+	items map[string]*scheduleItem
+	// missedAfter 触发时间已过去超过该时长视为“错过”
+	missedAfter time.Duration
+	// run 将到期任务投递给 worker，与 channel 下发的任务走同一条 ConsumerCmd 路径
+	run func(cr *xps.CmdReply) bool
+}
+
+func newScheduler(file string, run func(cr *xps.CmdReply) bool) *scheduler {
+	return &scheduler{
+		file:        strings.TrimSpace(file),
+		items:       map[string]*scheduleItem{},
+		missedAfter: time.Minute,
+		run:         run,
+	}
+}
+
+func newScheduleItem(sc Schedule) (*scheduleItem, error) {
+	sc.ID = strings.TrimSpace(sc.ID)
+	if sc.ID == "" || strings.ContainsAny(sc.ID, `/\`) {
+		return nil, fmt.Errorf("invalid schedule id %q", sc.ID)
+	}
+	if strings.TrimSpace(sc.Cmd.Name) == "" {
+		return nil, fmt.Errorf("schedule %s: empty cmd name", sc.ID)
+	}
+	switch sc.Missed {
+	case "":
+		sc.Missed = MissedSkip
+	case MissedSkip, MissedRunOnce:
+	default:
+		return nil, fmt.Errorf("schedule %s: invalid missed policy %q", sc.ID, sc.Missed)
+	}
+
+	spec, err := common.ParseCron(sc.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", sc.ID, err)
+	}
+	var jitter time.Duration
+	if j := strings.TrimSpace(sc.Jitter); j != "" {
+		if jitter, err = time.ParseDuration(j); err != nil || jitter < 0 {
+			return nil, fmt.Errorf("schedule %s: invalid jitter %q", sc.ID, sc.Jitter)
+		}
+	}
+	return &scheduleItem{Schedule: sc, spec: spec, jitter: jitter}, nil
+}
+
+// Load 从本地文件恢复定时任务，文件不存在视为空
+func (s *scheduler) Load() error {
+	if s.file == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var list []Schedule
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("parse %s: %w", s.file, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range list {
+		it, err := newScheduleItem(sc)
+		if err != nil {
+			logrus.WithError(err).Warn("scheduler: skip invalid schedule")
+			continue
+		}
+		s.items[it.ID] = it
+	}
+	logrus.WithField("count", len(s.items)).Infoln("scheduler: loaded schedules")
+	return nil
+}
+
+// saveLocked 写临时文件后 rename，避免中途崩溃留下半截文件
+func (s *scheduler) saveLocked() {
+	if s.file == "" {
+		return
+	}
+	b, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		logrus.WithError(err).Error("scheduler: marshal schedules failed")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o700); err != nil {
+		logrus.WithError(err).Error("scheduler: mkdir failed")
+		return
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		logrus.WithError(err).Error("scheduler: write schedules failed")
+		return
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		logrus.WithError(err).Error("scheduler: rename schedules failed")
+	}
+}
+
+// Add 注册或替换定时任务，新任务从当前时间开始计算下一次执行
+func (s *scheduler) Add(sc Schedule) error {
+	it, err := newScheduleItem(sc)
+	if err != nil {
+		return err
+	}
+	if it.LastRun.IsZero() {
+		it.LastRun = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[it.ID] = it
+	s.saveLocked()
+	return nil
+}
+
+// Remove 删除定时任务，返回是否存在
+func (s *scheduler) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return false
+	}
+	delete(s.items, id)
+	s.saveLocked()
+	return true
+}
+
+// List 按 ID 排序返回全部定时任务
+func (s *scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked()
+}
+
+func (s *scheduler) listLocked() []Schedule {
+	list := make([]Schedule, 0, len(s.items))
+	for _, it := range s.items {
+		list = append(list, it.Schedule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Tick 检查并触发到期任务
+func (s *scheduler) Tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, it := range s.items {
+		next := it.spec.Next(it.LastRun)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		changed = true
+		it.LastRun = now
+
+		l := logrus.WithFields(logrus.Fields{"schedule": it.ID, "due": next.Format(time.RFC3339)})
+		if now.Sub(next) > s.missedAfter && it.Missed == MissedSkip {
+			l.Warn("scheduler: missed run skipped")
+			continue
+		}
+		s.dispatch(it, now, l)
+	}
+	if changed {
+		s.saveLocked()
+	}
+}
+
+func (s *scheduler) dispatch(it *scheduleItem, now time.Time, l *logrus.Entry) {
+	cr := &xps.CmdReply{
+		Id: fmt.Sprintf("%s-%d", it.ID, now.Unix()),
+		Cmd: &xps.Command{
+			Name:  it.Cmd.Name,
+			Dir:   it.Cmd.Dir,
+			Envs:  it.Cmd.Envs,
+			Args:  it.Cmd.Args,
+			Extra: it.Cmd.Extra,
+		},
+	}
+	run := func() {
+		if !s.run(cr) {
+			l.WithField("task_id", cr.Id).Warn("scheduler: enqueue failed")
+			return
+		}
+		l.WithField("task_id", cr.Id).Infoln("scheduler: task dispatched")
+	}
+	if it.jitter <= 0 {
+		run()
+		return
+	}
+	time.AfterFunc(time.Duration(rand.Int63n(int64(it.jitter))), run)
+}
+
+// serveSchedule 处理 channel 下发的定时任务管理请求，返回当前定时任务列表
+func (g *GrpcMgr) serveSchedule(id string, code uint32, req *ScheduleRequest, l *logrus.Entry) {
+	var err error
+	switch {
+	case req == nil:
+		err = fmt.Errorf("missing schedule request")
+	case req.Action == ScheduleAdd && req.Schedule != nil:
+		err = g.sched.Add(*req.Schedule)
+	case req.Action == ScheduleAdd:
+		err = fmt.Errorf("missing schedule")
+	case req.Action == ScheduleRemove:
+		if !g.sched.Remove(req.ID) {
+			err = fmt.Errorf("schedule %q not found", req.ID)
+		}
+	case req.Action == ScheduleList:
+	default:
+		err = fmt.Errorf("unknown schedule action %q", req.Action)
+	}
+	if err != nil {
+		l.WithError(err).Warn("serveSchedule: failed")
+		g.sendResult(id, code, &xps.Body{Code: -1, Stderr: []byte(err.Error())}, xps.Status_FAIL)
+		return
+	}
+
+	b, _ := json.Marshal(g.sched.List())
+	l.WithField("action", req.Action).Infoln("serveSchedule: done")
+	g.sendResult(id, code, &xps.Body{Stdout: b}, xps.Status_SUCC)
+}
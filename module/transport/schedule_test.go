@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-proto/xps"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestScheduler_TickAndPersist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schedules.json")
+
+	var got []*xps.CmdReply
+	s := newScheduler(file, func(cr *xps.CmdReply) bool {
+		got = append(got, cr)
+		return true
+	})
+
+	base := time.Date(2024, 1, 1, 10, 0, 30, 0, time.UTC)
+	err := s.Add(Schedule{
+		ID:      "disk",
+		Cron:    "*/5 * * * *",
+		Cmd:     ScheduleCmd{Name: "df", Args: []string{"-h"}},
+		LastRun: base,
+	})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	s.Tick(base.Add(time.Minute))
+	if len(got) != 0 {
+		t.Fatalf("expected no run before due, got=%d", len(got))
+	}
+	s.Tick(time.Date(2024, 1, 1, 10, 5, 1, 0, time.UTC))
+	if len(got) != 1 || got[0].GetCmd().GetName() != "df" || got[0].Id != "disk-1704103501" {
+		t.Fatalf("expected one dispatched run, got=%v", got)
+	}
+
+	// 重新加载后保留 LastRun
+	s2 := newScheduler(file, nil)
+	if err := s2.Load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	list := s2.List()
+	if len(list) != 1 || !list[0].LastRun.Equal(time.Date(2024, 1, 1, 10, 5, 1, 0, time.UTC)) || list[0].Missed != MissedSkip {
+		t.Fatalf("unexpected persisted schedules: %+v", list)
+	}
+}
+
+func TestScheduler_MissedPolicy(t *testing.T) {
+	var runs []string
+	s := newScheduler("", func(cr *xps.CmdReply) bool {
+		runs = append(runs, cr.Id)
+		return true
+	})
+
+	last := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = s.Add(Schedule{ID: "skip", Cron: "@hourly", Cmd: ScheduleCmd{Name: "true"}, LastRun: last})
+	_ = s.Add(Schedule{ID: "once", Cron: "@hourly", Missed: MissedRunOnce, Cmd: ScheduleCmd{Name: "true"}, LastRun: last})
+
+	// agent 停了 5 小时：skip 不执行，run_once 只补一次
+	now := last.Add(5*time.Hour + 10*time.Minute)
+	s.Tick(now)
+	s.Tick(now.Add(time.Second))
+	if len(runs) != 1 || runs[0] != "once-1704085800" {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+}
+
+func TestScheduler_AddInvalid(t *testing.T) {
+	s := newScheduler("", nil)
+	for _, sc := range []Schedule{
+		{ID: "", Cron: "* * * * *", Cmd: ScheduleCmd{Name: "x"}},
+		{ID: "a", Cron: "bad", Cmd: ScheduleCmd{Name: "x"}},
+		{ID: "a", Cron: "* * * * *"},
+		{ID: "a", Cron: "* * * * *", Cmd: ScheduleCmd{Name: "x"}, Missed: "later"},
+		{ID: "a", Cron: "* * * * *", Cmd: ScheduleCmd{Name: "x"}, Jitter: "soon"},
+	} {
+		if err := s.Add(sc); err == nil {
+			t.Fatalf("expected error for %+v", sc)
+		}
+	}
+}
+
+func TestOutbox_FlushKeepsOrderOnFailure(t *testing.T) {
+	o := newOutbox(2, "")
+	o.Push(&xps.MsgRequest{Id: "1"})
+	o.Push(&xps.MsgRequest{Id: "2"})
+	o.Push(&xps.MsgRequest{Id: "3"}) // 超限丢弃最旧
+
+	var sent []string
+	n := o.Flush(func(m *xps.MsgRequest) error {
+		if m.Id == "3" {
+			return status.Error(codes.Unavailable, "down")
+		}
+		sent = append(sent, m.Id)
+		return nil
+	})
+	if n != 1 || len(sent) != 1 || sent[0] != "2" || o.Len() != 1 {
+		t.Fatalf("unexpected flush result n=%d sent=%v pending=%d", n, sent, o.Len())
+	}
+
+	n = o.Flush(func(*xps.MsgRequest) error { return nil })
+	if n != 1 || o.Len() != 0 {
+		t.Fatalf("expected remaining result flushed, n=%d pending=%d", n, o.Len())
+	}
+}
+
+func TestOutbox_DropRejected(t *testing.T) {
+	o := newOutbox(10, "")
+	for _, id := range []string{"big", "ok", "later"} {
+		o.Push(&xps.MsgRequest{Id: id})
+	}
+
+	// 被服务端拒绝的结果不再阻塞后续结果
+	var sent []string
+	n := o.Flush(func(m *xps.MsgRequest) error {
+		switch m.Id {
+		case "big":
+			return status.Error(codes.ResourceExhausted, "message larger than max")
+		case "later":
+			return status.Error(codes.DeadlineExceeded, "timeout")
+		}
+		sent = append(sent, m.Id)
+		return nil
+	})
+	if n != 1 || strings.Join(sent, ",") != "ok" || o.Len() != 1 {
+		t.Fatalf("n=%d sent=%v pending=%d", n, sent, o.Len())
+	}
+
+	for err, want := range map[error]bool{
+		status.Error(codes.Unavailable, ""):      true,
+		status.Error(codes.DeadlineExceeded, ""): true,
+		status.Error(codes.InvalidArgument, ""):  false,
+		errors.New("plain"):                      false,
+	} {
+		if retryableSendError(err) != want {
+			t.Fatalf("retryable(%v) != %v", err, want)
+		}
+	}
+}
+
+func TestOutbox_Persist(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	down := status.Error(codes.Unavailable, "down")
+	o := newOutbox(10, dir)
+	o.Push(&xps.MsgRequest{Id: "1", Dt: 2, Body: &xps.Body{Code: 1, Stderr: []byte("boom")}})
+	o.Push(&xps.MsgRequest{Id: "2"})
+	o.Flush(func(m *xps.MsgRequest) error {
+		if m.Id == "2" {
+			return down
+		}
+		return nil
+	})
+
+	// 模拟重启：新 outbox 从目录恢复未发送的结果
+	o2 := newOutbox(10, dir)
+	if err := o2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o2.Len() != 1 {
+		t.Fatalf("pending=%d", o2.Len())
+	}
+	o.Push(&xps.MsgRequest{Id: "3", Dt: 2, Body: &xps.Body{Code: 1, Stderr: []byte("boom")}})
+	o3 := newOutbox(10, dir)
+	if err := o3.Load(); err != nil {
+		t.Fatal(err)
+	}
+	// 恢复后的序号接续，新结果排在后面
+	o3.Push(&xps.MsgRequest{Id: "4"})
+	var ids []string
+	o3.Flush(func(m *xps.MsgRequest) error {
+		ids = append(ids, m.Id)
+		if m.Id == "3" && (m.Dt != 2 || string(m.Body.GetStderr()) != "boom" || m.Body.GetCode() != 1) {
+			t.Fatalf("unexpected restored result %+v", m)
+		}
+		return nil
+	})
+	if strings.Join(ids, ",") != "2,3,4" {
+		t.Fatalf("ids=%v", ids)
+	}
+	if des, _ := os.ReadDir(dir); len(des) != 0 {
+		t.Fatalf("expected all result files removed, got %d", len(des))
+	}
+}
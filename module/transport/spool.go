@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xulei1234/x-agent/module/common"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// spoolResult 落盘输出读取结果，序列化为 json 放在 Body.Stdout（Data 为 base64）
+type spoolResult struct {
+	TaskID string `json:"task_id"`
+	Stream string `json:"stream"`
+	Size   int64  `json:"size"`   // 落盘文件总大小
+	Offset int64  `json:"offset"` // 本次数据起始偏移
+	Data   []byte `json:"data"`
+	EOF    bool   `json:"eof"` // 是否已读到末尾
+}
+
+// serveSpool 响应 channel 读取落盘输出的请求
+func (g *GrpcMgr) serveSpool(id string, code uint32, req *SpoolRequest, l *logrus.Entry) {
+	fail := func(msg string) {
+		l.WithField("spool", req).Warn("serveSpool: " + msg)
+		g.sendResult(id, code, &xps.Body{Code: -1, Stderr: []byte(msg)}, xps.Status_FAIL)
+	}
+	if req == nil {
+		fail("missing spool request")
+		return
+	}
+
+	stream := strings.TrimSpace(req.Stream)
+	if stream == "" {
+		stream = common.StreamStdout
+	}
+	length := req.Length
+	if limit := int64(common.MaxOutputBytes()); length <= 0 || length > limit {
+		length = limit
+	}
+
+	data, size, err := g.spool.Read(req.TaskID, stream, req.Offset, length)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	b, err := json.Marshal(spoolResult{
+		TaskID: req.TaskID,
+		Stream: stream,
+		Size:   size,
+		Offset: req.Offset,
+		Data:   data,
+		EOF:    req.Offset+int64(len(data)) >= size,
+	})
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	g.sendResult(id, code, &xps.Body{Stdout: b}, xps.Status_SUCC)
+}
@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+	proto "github.com/xulei1234/x-proto"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// ChangeFailed unit 进入 failed 状态（ReportEvent）
+const ChangeFailed = "failed"
+
+// systemdList systemd unit 全量内容
+type systemdList struct {
+	Units []common.SystemdUnit `json:"units"`
+}
+
+// systemdSnapshot 以 unit 名为 key
+func systemdSnapshot(units []common.SystemdUnit) snapshot {
+	s := snapshot{"units": make(map[string]json.RawMessage, len(units))}
+	for _, u := range units {
+		s.setItem("units", u.Name, u)
+	}
+	return s
+}
+
+// failedUnits 记录已上报过的 failed unit，只对新进入 failed 的 unit 发送事件
+type failedUnits struct {
+	mu    sync.Mutex
+	known map[string]bool // nil 表示尚未建立基线
+}
+
+// Entered 返回相对上次 Commit 新进入 failed 的 unit；首次调用只建立基线（已 failed 的 unit 由全量清单体现）
+func (f *failedUnits) Entered(units []common.SystemdUnit) []common.SystemdUnit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.known == nil {
+		f.known = make(map[string]bool, len(units))
+		for _, u := range units {
+			f.known[u.Name] = true
+		}
+		return nil
+	}
+	var out []common.SystemdUnit
+	for _, u := range units {
+		if !f.known[u.Name] {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// Commit 以当前 failed 列表为基线；已恢复的 unit 再次失败时重新上报
+func (f *failedUnits) Commit(units []common.SystemdUnit) {
+	known := make(map[string]bool, len(units))
+	for _, u := range units {
+		known[u.Name] = true
+	}
+	f.mu.Lock()
+	f.known = known
+	f.mu.Unlock()
+}
+
+// systemdFailedEvent kind=systemd、type=event，每个新失败的 unit 一项 op=failed 的变更
+func systemdFailedEvent(units []common.SystemdUnit, now time.Time) (*xps.MsgRequest, error) {
+	changes := make([]snapshotChange, 0, len(units))
+	for _, u := range units {
+		b, err := json.Marshal(u)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, snapshotChange{Section: "units", Key: u.Name, Op: ChangeFailed, New: b})
+	}
+	body, err := json.Marshal(inventoryReport{
+		Kind:    InventorySystemd,
+		Type:    ReportEvent,
+		Time:    now.Unix(),
+		Changes: changes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &xps.MsgRequest{Dt: proto.MCodeSysInfo, Body: &xps.Body{Stdout: body}}, nil
+}
+
+// SendSystemdUnits 上报 unit 状态清单（active/sub/enabled、MainPID、重启次数），变化时只发送增量，
+// 首次、重连后及每 IntervalTick.SystemdFull 上报全量
+func (g *GrpcMgr) SendSystemdUnits() {
+	units, err := common.ListSystemdUnits(viper.GetStringSlice("Systemd.UnitTypes"))
+	if err != nil {
+		logrus.WithError(err).Warn("SendSystemdUnits: list units failed")
+		return
+	}
+	msg, commit, err := g.units.Next(&systemdList{Units: units}, systemdSnapshot(units), time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	if msg == nil {
+		logrus.Traceln("SendSystemdUnits: units not changed")
+		return
+	}
+
+	timeout := viper.GetDuration("Timeout.Report")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := g.client.Msg(ctx, msg); err != nil {
+		logrus.Errorln("SendSystemdUnits: g.client.Msg failed = ", err.Error())
+		return
+	}
+	commit()
+	logrus.WithFields(logrus.Fields{"units": len(units), "bytes": len(msg.Body.Stdout)}).Infoln("SendSystemdUnits: g.client.Msg success")
+}
+
+// CheckFailedUnits 检测新进入 failed 的 unit 并立即上报事件；发送失败时下次检测重试
+func (g *GrpcMgr) CheckFailedUnits() {
+	failed, err := common.ListFailedUnits()
+	if err != nil {
+		logrus.WithError(err).Warn("CheckFailedUnits: list failed units failed")
+		return
+	}
+	entered := g.failed.Entered(failed)
+	if len(entered) == 0 {
+		g.failed.Commit(failed)
+		return
+	}
+	msg, err := systemdFailedEvent(entered, time.Now())
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+
+	timeout := viper.GetDuration("Timeout.Report")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := g.client.Msg(ctx, msg); err != nil {
+		logrus.Errorln("CheckFailedUnits: g.client.Msg failed = ", err.Error())
+		return
+	}
+	g.failed.Commit(failed)
+	for _, u := range entered {
+		logrus.WithFields(logrus.Fields{"unit": u.Name, "sub": u.SubState}).Warn("CheckFailedUnits: unit entered failed state")
+	}
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+func TestFailedUnits(t *testing.T) {
+	var f failedUnits
+	a := common.SystemdUnit{Name: "a.service", ActiveState: "failed"}
+	b := common.SystemdUnit{Name: "b.service", ActiveState: "failed"}
+
+	// 首次只建立基线
+	if got := f.Entered([]common.SystemdUnit{a}); got != nil {
+		t.Fatalf("baseline got=%+v", got)
+	}
+	got := f.Entered([]common.SystemdUnit{a, b})
+	if len(got) != 1 || got[0].Name != "b.service" {
+		t.Fatalf("got=%+v", got)
+	}
+	// 未 Commit（发送失败）时下次仍然上报
+	if got := f.Entered([]common.SystemdUnit{a, b}); len(got) != 1 {
+		t.Fatalf("retry got=%+v", got)
+	}
+	f.Commit([]common.SystemdUnit{a, b})
+	if got := f.Entered([]common.SystemdUnit{a, b}); len(got) != 0 {
+		t.Fatalf("committed got=%+v", got)
+	}
+	// a 恢复后再次失败
+	f.Commit([]common.SystemdUnit{b})
+	if got := f.Entered([]common.SystemdUnit{a, b}); len(got) != 1 || got[0].Name != "a.service" {
+		t.Fatalf("refail got=%+v", got)
+	}
+}
+
+func TestSystemdInventory(t *testing.T) {
+	r := newInventoryReporter(InventorySystemd, 0)
+	units := []common.SystemdUnit{
+		{Name: "nginx.service", ActiveState: "active", SubState: "running", MainPID: 10},
+		{Name: "cron.service", ActiveState: "active", SubState: "running", MainPID: 11},
+	}
+	now := time.Unix(1700000000, 0)
+	_, commit, err := r.Next(&systemdList{Units: units}, systemdSnapshot(units), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit()
+
+	units[0].MainPID, units[0].NRestarts = 20, 1
+	msg, _, err := r.Next(&systemdList{Units: units}, systemdSnapshot(units), now.Add(time.Minute))
+	if err != nil || msg == nil {
+		t.Fatalf("msg=%v err=%v", msg, err)
+	}
+	var rep inventoryReport
+	if err := json.Unmarshal(msg.Body.Stdout, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Kind != InventorySystemd || rep.Type != ReportDelta || len(rep.Changes) != 1 || rep.Changes[0].Key != "nginx.service" {
+		t.Fatalf("report=%s", msg.Body.Stdout)
+	}
+}
+
+func TestSystemdFailedEvent(t *testing.T) {
+	msg, err := systemdFailedEvent([]common.SystemdUnit{{Name: "a.service", ActiveState: "failed", Result: "exit-code"}}, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep inventoryReport
+	if err := json.Unmarshal(msg.Body.Stdout, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Type != ReportEvent || len(rep.Changes) != 1 || rep.Changes[0].Op != ChangeFailed || rep.Changes[0].Key != "a.service" {
+		t.Fatalf("event=%s", msg.Body.Stdout)
+	}
+}
@@ -2,6 +2,7 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/xulei1234/x-agent/module/common"
@@ -62,27 +63,189 @@ func (g *GrpcMgr) TaskReportOSInfo() {
 	}
 }
 
+// TaskReportPackages 周期上报软件包清单（增量）
+func (g *GrpcMgr) TaskReportPackages() {
+	logrus.Infoln("TaskReportPackages: start")
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.ReportPackages"))
+	defer ticker.Stop()
+
+	for {
+		g.SendPackages()
+		<-ticker.C
+	}
+}
+
+// TaskReportNetwork 周期上报监听端口与连接汇总
+func (g *GrpcMgr) TaskReportNetwork() {
+	logrus.Infoln("TaskReportNetwork: start")
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.ReportNetwork"))
+	defer ticker.Stop()
+
+	for {
+		g.SendNetworkInfo()
+		<-ticker.C
+	}
+}
+
+// TaskReportProcesses 周期采样进程并上报资源占用排行
+func (g *GrpcMgr) TaskReportProcesses() {
+	logrus.Infoln("TaskReportProcesses: start")
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.ReportProcesses"))
+	defer ticker.Stop()
+
+	for {
+		g.SendProcesses()
+		<-ticker.C
+	}
+}
+
+// TaskReportSystemd 周期上报 systemd unit 清单，并高频检测进入 failed 的 unit；非 systemd 主机不启动
+func (g *GrpcMgr) TaskReportSystemd() {
+	if !common.SystemdBooted() {
+		logrus.Infoln("TaskReportSystemd: system not booted with systemd, skip")
+		return
+	}
+	logrus.Infoln("TaskReportSystemd: start")
+
+	go func() {
+		ticker := time.NewTicker(viper.GetDuration("IntervalTick.SystemdFailed"))
+		defer ticker.Stop()
+		for {
+			g.CheckFailedUnits()
+			<-ticker.C
+		}
+	}()
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.ReportSystemd"))
+	defer ticker.Stop()
+
+	for {
+		g.SendSystemdUnits()
+		<-ticker.C
+	}
+}
+
+// TaskReportMetrics 每 Metrics.SampleInterval 采样主机指标，按 Metrics.Interval 聚合后分批上报
+func (g *GrpcMgr) TaskReportMetrics() {
+	if !viper.GetBool("Metrics.Enabled") {
+		logrus.Infoln("TaskReportMetrics: disabled")
+		return
+	}
+	logrus.Infoln("TaskReportMetrics: start")
+
+	sampler := common.NewMetricsSampler()
+	agg := common.NewMetricsAggregator(viper.GetDuration("Metrics.Interval"))
+	ticker := time.NewTicker(viper.GetDuration("Metrics.SampleInterval"))
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if p := agg.Add(now, sampler.Sample()); p != nil {
+			g.metrics.Push(*p)
+			g.FlushMetrics()
+		}
+		<-ticker.C
+	}
+}
+
+// TaskRunCollectors 按各插件清单的 schedule 执行 Collector.Dir 下的采集插件，合并结果后上报
+func (g *GrpcMgr) TaskRunCollectors() {
+	if viper.GetString("Collector.Dir") == "" {
+		logrus.Infoln("TaskRunCollectors: Collector.Dir not set, disabled")
+		return
+	}
+	logrus.Infoln("TaskRunCollectors: start")
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.Collectors"))
+	defer ticker.Stop()
+
+	for {
+		g.RunCollectors()
+		g.SendFacts()
+		<-ticker.C
+	}
+}
+
 func (g *GrpcMgr) TaskConsumerCmds() {
 	logrus.Infoln("TaskConsumerCmds: start")
 
 	for i := 0; i < g.cmdtask.poolSize; i++ {
 		workerId := i
 		go func() {
-			for t := range g.cmdtask.tasks {
-				if t == nil {
-					continue
+			for {
+				t, done, ok := g.cmdtask.queue.Pop()
+				if !ok {
+					break
 				}
 				logrus.WithFields(logrus.Fields{
-					"worker":  workerId,
-					"task_id": t.Id,
+					"worker":   workerId,
+					"task_id":  t.cr.Id,
+					"class":    t.class,
+					"priority": t.priority,
 				}).Debug("TaskConsumerCmds: received task")
-				g.ConsumerCmd(t)
+				if t.lockErr != nil {
+					logrus.WithField("task_id", t.cr.Id).WithError(t.lockErr).Warn("TaskConsumerCmds: acquire locks failed")
+					g.sendResult(t.cr.Id, t.code, &xps.Body{Code: -1, Stderr: []byte(t.lockErr.Error())}, xps.Status_FAIL)
+				} else {
+					var lock *lockRecord
+					if len(t.locks) > 0 {
+						lock = &lockRecord{Locks: t.locks, WaitMs: t.lockWait.Milliseconds()}
+					}
+					g.ConsumerCmd(t.cr, lock)
+				}
+				done()
 			}
-			logrus.WithField("worker", workerId).Warn("TaskConsumerCmds: tasks channel closed, worker exit")
+			logrus.WithField("worker", workerId).Warn("TaskConsumerCmds: tasks queue closed, worker exit")
 		}()
 	}
 }
 
+// TaskRunSchedules 按本地时钟触发定时任务
+func (g *GrpcMgr) TaskRunSchedules() {
+	logrus.Infoln("TaskRunSchedules: start")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if g.isClosed() {
+			return
+		}
+		g.sched.Tick(time.Now())
+	}
+}
+
+// TaskEvictSpool 周期执行输出落盘目录的 TTL/容量淘汰，避免长时间没有新任务时过期文件一直保留
+func (g *GrpcMgr) TaskEvictSpool() {
+	if g.spool == nil {
+		logrus.Infoln("TaskEvictSpool: spool disabled")
+		return
+	}
+	logrus.Infoln("TaskEvictSpool: start")
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.Spool"))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.spool.Evict()
+	}
+}
+
+// TaskFlushOutbox 周期重发缓存的任务结果
+func (g *GrpcMgr) TaskFlushOutbox() {
+	logrus.Infoln("TaskFlushOutbox: start")
+
+	ticker := time.NewTicker(viper.GetDuration("IntervalTick.Outbox"))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.FlushOutbox()
+	}
+}
+
 func (g *GrpcMgr) TaskPullCommands() {
 	// retry to establish stream forever
 	logrus.Infoln("TaskPullCommands: start")
@@ -104,6 +267,11 @@ func (g *GrpcMgr) TaskPullCommands() {
 		atomic.StoreInt64(&attempt, 0)
 
 		g.SendAgentInfo(true)
+		// 重连期间 channel 可能丢失增量，下次上报全量快照
+		g.osinfo.RequestFull()
+		g.pkgs.RequestFull()
+		g.units.RequestFull()
+		g.facts.RequestFull()
 		logrus.Info("TaskPullCommands: listen on stream to receive commands")
 
 		for {
@@ -112,17 +280,7 @@ func (g *GrpcMgr) TaskPullCommands() {
 				// 上报确认消息
 				go g.SendMsgResult(cr.Id, proto.MCodeConfirm, &xps.Body{}, xps.Status_SUCC)
 
-				if g.isClosed() {
-					logrus.WithField("task_id", cr.Id).Warn("TaskPullCommands: tasks channel closed, drop command")
-					continue
-				}
-
-				select {
-				case g.cmdtask.tasks <- cr:
-				default:
-					// 队列满时避免阻塞 stream 读取；按需可改为阻塞/丢弃策略
-					logrus.WithField("task_id", cr.Id).Warn("TaskPullCommands: tasks queue full, drop command")
-				}
+				g.enqueueTask(cr)
 				continue
 			}
 
@@ -139,6 +297,52 @@ func (g *GrpcMgr) TaskPullCommands() {
 	}
 }
 
+// enqueueTask 非阻塞投递到 worker 队列，返回是否成功；
+// 被拒绝（或被更高优先级任务挤出）的任务回传失败结果说明原因，而不是静默丢弃
+func (g *GrpcMgr) enqueueTask(cr *xps.CmdReply) bool {
+	if g.isClosed() {
+		logrus.WithField("task_id", cr.Id).Warn("enqueueTask: tasks queue closed, drop command")
+		return false
+	}
+
+	// 这里只取排队需要的字段，解析失败时 ConsumerCmd 会再次记录
+	var extra TaskExtra
+	if b := cr.GetCmd().GetExtra(); len(b) > 0 {
+		_ = json.Unmarshal(b, &extra)
+	}
+	t := &queuedTask{
+		cr:       cr,
+		code:     extra.Code,
+		class:    extra.Class,
+		priority: priorityLevel(extra.Priority),
+		queuedAt: time.Now(),
+	}
+	// 命名锁在队列中等待，等待时间不计入任务超时
+	if locks, wait := taskLockWait(&extra, parseCmdTimeout(extra.Timeout, viper.GetDuration("Timeout.CmdRun"), logrus.WithField("task_id", cr.Id))); len(locks) > 0 {
+		t.locks, t.lockDeadline = locks, t.queuedAt.Add(wait)
+	}
+
+	evicted, err := g.cmdtask.queue.Push(t)
+	if evicted != nil {
+		g.rejectTask(evicted, errPreempted)
+	}
+	if err != nil {
+		g.rejectTask(t, err)
+		return false
+	}
+	return true
+}
+
+func (g *GrpcMgr) rejectTask(t *queuedTask, reason error) {
+	logrus.WithFields(logrus.Fields{
+		"task_id":  t.cr.Id,
+		"class":    t.class,
+		"priority": t.priority,
+		"queued":   g.cmdtask.queue.Len(),
+	}).Warnf("enqueueTask: %v", reason)
+	go g.sendResult(t.cr.Id, t.code, &xps.Body{Code: -1, Stderr: []byte(reason.Error())}, xps.Status_FAIL)
+}
+
 func backoffDuration(attempt int64) time.Duration {
 	// 退避：1s 起步，指数增长，封顶 60s
 	if attempt < 1 {
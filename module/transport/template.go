@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/xulei1234/x-agent/module/common"
+)
+
+// agent 注入的任务变量，同时作为环境变量与 ${...} 模板变量
+const (
+	VarUUID     = "X_AGENT_UUID"
+	VarHostname = "X_AGENT_HOSTNAME"
+	VarZone     = "X_AGENT_ZONE"
+	VarRegion   = "X_AGENT_REGION"
+	VarIP       = "X_AGENT_IP"
+	VarTaskID   = "X_AGENT_TASK_ID"
+	VarVersion  = "X_AGENT_VERSION"
+	VarTmpDir   = "X_AGENT_TMPDIR"
+)
+
+// varRefPattern 匹配 ${NAME}、${NAME:-default}；前导 $$ 表示转义（$${NAME} 输出字面量 ${NAME}）。
+// 名称不含 "."，不会与工作流的 ${steps.<id>.stdout} 冲突。与 shell 语法重叠（如 ${HOME:-/root}
+// 会在 agent 侧被替换为默认值），因此只在任务显式开启时展开
+var varRefPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// deviceUUID GetDeviceUUID 需读取 SMBIOS 表并有多级回退，进程内只取一次
+var deviceUUID = sync.OnceValue(common.GetDeviceUUID)
+
+// taskVars 单个任务可用的模板变量
+type taskVars struct {
+	agent  map[string]string // agent 变量，注入环境
+	lookup map[string]string // RuntimeEnv < agent 变量 < 任务 Envs（后者覆盖前者）
+	// expand 为 false 时只注入环境变量，不做模板展开（Extra.Expand）
+	expand bool
+}
+
+// newTaskVars 收集 agent 变量；envs 为任务下发的 KEY=VALUE，按顺序展开后可被后续引用
+func (g *GrpcMgr) newTaskVars(id string, envs []string, expand bool) *taskVars {
+	tmp := strings.TrimSpace(viper.GetString("Cmd.TmpDir"))
+	if tmp == "" {
+		tmp = os.TempDir()
+	}
+	v := &taskVars{
+		agent: map[string]string{
+			VarUUID:     deviceUUID(),
+			VarHostname: common.GetDeviceHostname(),
+			VarZone:     common.GetDeviceZone(),
+			VarRegion:   common.GetDeviceRegion(),
+			VarIP:       common.GetConfigIP(),
+			VarTaskID:   id,
+			VarVersion:  common.Version,
+			VarTmpDir:   tmp,
+		},
+		lookup: make(map[string]string),
+		expand: expand,
+	}
+	if g != nil && g.client3 != nil {
+		if conn := g.client3.ActiveConnection(); conn != nil {
+			if host, port, ok := splitHostPortLoose(conn.Target()); ok {
+				v.lookup["SERVER_CHANNEL_HOST"], v.lookup["SERVER_CHANNEL_PORT"] = host, port
+			}
+		}
+	}
+	for k, val := range viper.GetStringMapString("RuntimeEnv") {
+		if kk := strings.TrimSpace(k); kk != "" {
+			v.lookup[strings.ToUpper(kk)] = val
+		}
+	}
+	for k, val := range v.agent {
+		v.lookup[k] = val
+	}
+	for _, kv := range envs {
+		k, val, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			continue
+		}
+		v.lookup[k] = v.Expand(val)
+	}
+	return v
+}
+
+// Expand 替换 ${NAME} / ${NAME:-default}；未定义且无默认值的引用原样保留，
+// 带默认值的引用即使 NAME 在 shell 中有定义也会被替换为默认值
+func (v *taskVars) Expand(s string) string {
+	if v == nil || !v.expand || !strings.Contains(s, "${") {
+		return s
+	}
+	return varRefPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		sub := varRefPattern.FindStringSubmatch(m)
+		if val, ok := v.lookup[sub[1]]; ok && (val != "" || sub[2] == "") {
+			return val
+		}
+		if sub[2] != "" {
+			return sub[3]
+		}
+		return m
+	})
+}
+
+// ExpandAll 逐个展开
+func (v *taskVars) ExpandAll(in []string) []string {
+	if len(in) == 0 {
+		return in
+	}
+	out := make([]string, len(in))
+	for i, s := range in {
+		out[i] = v.Expand(s)
+	}
+	return out
+}
+
+// ExpandEnv 只展开 KEY=VALUE 中的值
+func (v *taskVars) ExpandEnv(envs []string) []string {
+	if len(envs) == 0 {
+		return envs
+	}
+	out := make([]string, len(envs))
+	for i, kv := range envs {
+		if k, val, ok := strings.Cut(kv, "="); ok {
+			out[i] = k + "=" + v.Expand(val)
+		} else {
+			out[i] = kv
+		}
+	}
+	return out
+}
+
+// Env agent 变量对应的环境变量（按名称排序）
+func (v *taskVars) Env() []string {
+	if v == nil {
+		return nil
+	}
+	out := make([]string, 0, len(v.agent))
+	for k, val := range v.agent {
+		out = append(out, k+"="+val)
+	}
+	sort.Strings(out)
+	return out
+}
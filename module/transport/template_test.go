@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTaskVars_Expand(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("IDC.Zone", "zone-a")
+	viper.Set("IDC.Region", "cn-north")
+	viper.Set("Cmd.TmpDir", "/var/tmp")
+	viper.Set("RuntimeEnv", map[string]string{"app_root": "/opt/app"})
+
+	v := gMgr.newTaskVars("task-1", []string{"DEPLOY=${APP_ROOT}/releases/${X_AGENT_TASK_ID}", "EMPTY="}, true)
+	for in, want := range map[string]string{
+		"${X_AGENT_ZONE}/${X_AGENT_REGION}":    "zone-a/cn-north",
+		"${X_AGENT_TMPDIR}/${X_AGENT_TASK_ID}": "/var/tmp/task-1",
+		"${DEPLOY}":                            "/opt/app/releases/task-1",
+		"${EMPTY:-fallback}":                   "fallback",
+		"${EMPTY}":                             "",
+		"${UNDEFINED:-x}":                      "x",
+		// 未定义的引用保留给 shell
+		`echo ${HOME} $X_AGENT_ZONE`: `echo ${HOME} $X_AGENT_ZONE`,
+		"$${X_AGENT_ZONE}":           "${X_AGENT_ZONE}",
+		"${steps.build.stdout}":      "${steps.build.stdout}",
+	} {
+		if got := v.Expand(in); got != want {
+			t.Errorf("Expand(%q)=%q want %q", in, got, want)
+		}
+	}
+
+	if got := v.ExpandEnv([]string{"OUT=${X_AGENT_ZONE}", "RAW"}); strings.Join(got, ",") != "OUT=zone-a,RAW" {
+		t.Fatalf("ExpandEnv=%v", got)
+	}
+
+	env := strings.Join(v.Env(), "\n")
+	for _, want := range []string{"X_AGENT_TASK_ID=task-1", "X_AGENT_ZONE=zone-a", "X_AGENT_VERSION="} {
+		if !strings.Contains(env, want) {
+			t.Fatalf("missing %s in env:\n%s", want, env)
+		}
+	}
+
+	// 默认关闭：shell 的 ${HOME:-/root} 等语法原样保留
+	off := gMgr.newTaskVars("task-1", []string{"DEPLOY=${APP_ROOT}"}, false)
+	for _, in := range []string{"${X_AGENT_ZONE}", "${HOME:-/root}", "$${X_AGENT_ZONE}"} {
+		if got := off.Expand(in); got != in {
+			t.Fatalf("expansion should be disabled, Expand(%q)=%q", in, got)
+		}
+	}
+	if len(off.Env()) == 0 {
+		t.Fatalf("env should still be injected when expansion is disabled")
+	}
+}
+
+func TestTaskVars_InjectedEnv(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("IDC.Zone", "zone-b")
+
+	v := gMgr.newTaskVars("task-2", nil, true)
+	cmd, err := gMgr.newTaskCmd(context.Background(), "sh", v.ExpandAll([]string{"-c", `echo "$X_AGENT_TASK_ID ${X_AGENT_ZONE}"`}), "", v.Env(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "task-2 zone-b" {
+		t.Fatalf("got=%q", got)
+	}
+}
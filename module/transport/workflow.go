@@ -0,0 +1,505 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xulei1234/x-agent/module/common"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// 工作流步骤类型
+const (
+	StepTypeCmd    = "cmd"
+	StepTypeScript = "script"
+	StepTypeFile   = "file"
+	StepTypeWait   = "wait"
+)
+
+// 步骤执行条件
+const (
+	WhenSuccess = "success" // 依赖全部成功且工作流未失败（默认）
+	WhenFailure = "failure" // 工作流已有步骤失败
+	WhenAlways  = "always"  // 无论成功失败
+)
+
+// 步骤状态
+const (
+	StepSucceeded = "success"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// 文件操作
+const (
+	FileOpWrite  = "write"
+	FileOpDelete = "delete"
+	FileOpMkdir  = "mkdir"
+)
+
+// Workflow 在 agent 本地执行的多步骤任务，steps 按 depends_on 组成 DAG，按拓扑序依次执行
+type Workflow struct {
+	Steps []WorkflowStep `json:"steps"`
+}
+
+// WorkflowStep 工作流步骤。
+// cmd/script/file 中的 ${steps.<id>.stdout|stderr|code} 会替换为前序步骤的输出，实现步骤间传值。
+type WorkflowStep struct {
+	ID              string             `json:"id"`
+	Type            string             `json:"type"`
+	DependsOn       []string           `json:"depends_on,omitempty"`
+	When            string             `json:"when,omitempty"`
+	Timeout         string             `json:"timeout,omitempty"`     // 单步超时，默认受整个任务超时约束
+	Retry           int                `json:"retry,omitempty"`       // 失败后重试次数
+	RetryDelay      string             `json:"retry_delay,omitempty"` // 默认 1s
+	ContinueOnError bool               `json:"continue_on_error,omitempty"`
+	Cmd             *StepCmd           `json:"cmd,omitempty"`
+	Script          *common.ScriptSpec `json:"script,omitempty"`
+	File            *StepFile          `json:"file,omitempty"`
+	Wait            string             `json:"wait,omitempty"`       // wait 步骤的等待时长
+	OnFailure       []WorkflowStep     `json:"on_failure,omitempty"` // 本步骤最终失败时依次执行的回滚步骤
+}
+
+// StepCmd cmd 步骤的命令
+type StepCmd struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+	Dir  string   `json:"dir,omitempty"`
+	Envs []string `json:"envs,omitempty"`
+}
+
+// StepFile file 步骤的文件操作
+type StepFile struct {
+	Op      string `json:"op"` // write/delete/mkdir
+	Path    string `json:"path"`
+	Content string `json:"content,omitempty"`
+	Mode    string `json:"mode,omitempty"` // 八进制，如 0644
+}
+
+// stepResult 单个步骤的执行结果，同时用作进度上报内容
+type stepResult struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	Code       int32         `json:"code"`
+	Attempts   int           `json:"attempts,omitempty"`
+	DurationMs int64         `json:"duration_ms"`
+	Stdout     string        `json:"stdout,omitempty"`
+	Stderr     string        `json:"stderr,omitempty"`
+	Rollback   []*stepResult `json:"rollback,omitempty"`
+}
+
+// workflowLogOutputBytes 进度行中每个步骤 stdout/stderr 保留的字节数（头尾）
+const workflowLogOutputBytes = 4 << 10
+
+// trimmed 返回输出截断到 n 字节（保留头尾）的副本用于上报；原结果保留完整输出供 ${steps.*} 引用
+func (r *stepResult) trimmed(n int) *stepResult {
+	c := *r
+	c.Stdout = string(common.TruncateHeadTail([]byte(r.Stdout), n))
+	c.Stderr = string(common.TruncateHeadTail([]byte(r.Stderr), n))
+	c.Rollback = nil
+	for _, rb := range r.Rollback {
+		c.Rollback = append(c.Rollback, rb.trimmed(n))
+	}
+	return &c
+}
+
+// workflowResult 工作流终态结果，序列化为 json 放在 Body.Stdout
+type workflowResult struct {
+	Status string        `json:"status"`
+	Steps  []*stepResult `json:"steps"`
+}
+
+// marshal 序列化终态结果，总大小不超过 max：各步骤输出平均分配预算，超出（json 转义开销）时逐次减半，
+// 仍超出时只保留步骤状态
+func (w *workflowResult) marshal(max int) []byte {
+	streams := 0
+	for _, st := range w.Steps {
+		streams += 2 * (1 + len(st.Rollback))
+	}
+	per := max / (streams + 1)
+	for {
+		out := &workflowResult{Status: w.Status}
+		for _, st := range w.Steps {
+			out.Steps = append(out.Steps, st.trimmed(per))
+		}
+		b, _ := json.Marshal(out)
+		if len(b) <= max || per == 0 {
+			return b
+		}
+		per /= 2
+	}
+}
+
+// stepRefPattern 匹配 ${steps.<id>.stdout|stderr|code}
+var stepRefPattern = regexp.MustCompile(`\$\{steps\.([^.}]+)\.(stdout|stderr|code)\}`)
+
+// workflowOrder 校验步骤并返回拓扑序（同层保持声明顺序）
+func workflowOrder(wf *Workflow) ([]*WorkflowStep, error) {
+	if wf == nil || len(wf.Steps) == 0 {
+		return nil, fmt.Errorf("empty workflow")
+	}
+
+	byID := make(map[string]*WorkflowStep, len(wf.Steps))
+	for i := range wf.Steps {
+		st := &wf.Steps[i]
+		if err := validateStep(st); err != nil {
+			return nil, err
+		}
+		if _, ok := byID[st.ID]; ok {
+			return nil, fmt.Errorf("duplicate step id %q", st.ID)
+		}
+		byID[st.ID] = st
+	}
+
+	indegree := make(map[string]int, len(byID))
+	for _, st := range byID {
+		for _, dep := range st.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return nil, fmt.Errorf("step %q depends on unknown step %q", st.ID, dep)
+			}
+			indegree[st.ID]++
+		}
+	}
+
+	order := make([]*WorkflowStep, 0, len(byID))
+	done := make(map[string]bool, len(byID))
+	for len(order) < len(byID) {
+		progressed := false
+		for i := range wf.Steps {
+			st := &wf.Steps[i]
+			if done[st.ID] || indegree[st.ID] > 0 {
+				continue
+			}
+			done[st.ID] = true
+			order = append(order, st)
+			progressed = true
+			for j := range wf.Steps {
+				for _, dep := range wf.Steps[j].DependsOn {
+					if dep == st.ID {
+						indegree[wf.Steps[j].ID]--
+					}
+				}
+			}
+		}
+		if !progressed {
+			return nil, fmt.Errorf("workflow has dependency cycle")
+		}
+	}
+	return order, nil
+}
+
+func validateStep(st *WorkflowStep) error {
+	if strings.TrimSpace(st.ID) == "" {
+		return fmt.Errorf("step id is required")
+	}
+	switch st.When {
+	case "", WhenSuccess, WhenFailure, WhenAlways:
+	default:
+		return fmt.Errorf("step %q: invalid when %q", st.ID, st.When)
+	}
+	switch st.Type {
+	case StepTypeCmd:
+		if st.Cmd == nil || st.Cmd.Name == "" {
+			return fmt.Errorf("step %q: missing cmd", st.ID)
+		}
+	case StepTypeScript:
+		if st.Script == nil {
+			return fmt.Errorf("step %q: missing script", st.ID)
+		}
+	case StepTypeFile:
+		if st.File == nil || st.File.Path == "" {
+			return fmt.Errorf("step %q: missing file", st.ID)
+		}
+	case StepTypeWait:
+		if _, err := time.ParseDuration(st.Wait); err != nil {
+			return fmt.Errorf("step %q: invalid wait %q", st.ID, st.Wait)
+		}
+	default:
+		return fmt.Errorf("step %q: unknown type %q", st.ID, st.Type)
+	}
+	for i := range st.OnFailure {
+		if err := validateStep(&st.OnFailure[i]); err != nil {
+			return fmt.Errorf("step %q rollback: %w", st.ID, err)
+		}
+	}
+	return nil
+}
+
+// workflowRunner 工作流执行器，exec 负责执行单个步骤一次
+type workflowRunner struct {
+	exec     func(ctx context.Context, st *WorkflowStep, expand func(string) string) *xps.Body
+	progress func(r *stepResult, done, total int)
+
+	steps   map[string]*WorkflowStep
+	results map[string]*stepResult
+	failed  bool
+}
+
+// Run 执行工作流；校验失败返回 error
+func (r *workflowRunner) Run(ctx context.Context, wf *Workflow) (*workflowResult, error) {
+	order, err := workflowOrder(wf)
+	if err != nil {
+		return nil, err
+	}
+
+	r.steps = make(map[string]*WorkflowStep, len(order))
+	r.results = make(map[string]*stepResult, len(order))
+	for _, st := range order {
+		r.steps[st.ID] = st
+	}
+
+	out := &workflowResult{Status: StepSucceeded}
+	for i, st := range order {
+		res := &stepResult{ID: st.ID, Status: StepSkipped}
+		switch {
+		case ctx.Err() != nil:
+			res.Stderr = ctx.Err().Error()
+		case r.shouldRun(st):
+			res = r.runStep(ctx, st)
+			if res.Status == StepFailed {
+				for j := range st.OnFailure {
+					res.Rollback = append(res.Rollback, r.runStep(ctx, &st.OnFailure[j]))
+				}
+				if !st.ContinueOnError {
+					r.failed = true
+				}
+			}
+		}
+
+		r.results[st.ID] = res
+		out.Steps = append(out.Steps, res)
+		if r.progress != nil {
+			r.progress(res, i+1, len(order))
+		}
+	}
+
+	if r.failed || ctx.Err() != nil {
+		out.Status = StepFailed
+	}
+	return out, nil
+}
+
+func (r *workflowRunner) shouldRun(st *WorkflowStep) bool {
+	switch st.When {
+	case WhenAlways:
+		return true
+	case WhenFailure:
+		return r.failed
+	}
+	if r.failed {
+		return false
+	}
+	for _, dep := range st.DependsOn {
+		res := r.results[dep]
+		if res.Status == StepSucceeded {
+			continue
+		}
+		if res.Status == StepFailed && r.steps[dep].ContinueOnError {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func (r *workflowRunner) runStep(ctx context.Context, st *WorkflowStep) *stepResult {
+	res := &stepResult{ID: st.ID}
+	start := time.Now()
+	defer func() { res.DurationMs = time.Since(start).Milliseconds() }()
+
+	timeout, _ := time.ParseDuration(st.Timeout)
+	delay, err := time.ParseDuration(st.RetryDelay)
+	if err != nil || delay <= 0 {
+		delay = time.Second
+	}
+
+	for {
+		res.Attempts++
+
+		sctx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			sctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		body := r.exec(sctx, st, r.expand)
+		cancel()
+
+		res.Code = body.Code
+		res.Stdout = string(body.Stdout)
+		res.Stderr = string(body.Stderr)
+		if body.Code == 0 {
+			res.Status = StepSucceeded
+			return res
+		}
+		if res.Attempts > st.Retry || ctx.Err() != nil {
+			res.Status = StepFailed
+			return res
+		}
+
+		select {
+		case <-ctx.Done():
+			res.Status = StepFailed
+			return res
+		case <-time.After(delay):
+		}
+	}
+}
+
+// expand 替换 ${steps.<id>.stdout|stderr|code}，引用未执行的步骤时替换为空
+func (r *workflowRunner) expand(s string) string {
+	return stepRefPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := stepRefPattern.FindStringSubmatch(m)
+		res, ok := r.results[sub[1]]
+		if !ok {
+			return ""
+		}
+		switch sub[2] {
+		case "stdout":
+			return strings.TrimRight(res.Stdout, "\n")
+		case "stderr":
+			return strings.TrimRight(res.Stderr, "\n")
+		default:
+			return strconv.Itoa(int(res.Code))
+		}
+	})
+}
+
+// runWorkflow 执行工作流任务：每个步骤结束上报一行进度（行号从 pos 开始，pc 为完成百分比），最后发送汇总结果
+func (g *GrpcMgr) runWorkflow(ctx context.Context, id string, code uint32, wf *Workflow, ra *runAs, vars *taskVars, pos int32, lock *lockRecord, l *logrus.Entry) {
+	env := vars.Env()
+	r := &workflowRunner{
+		exec: func(ctx context.Context, st *WorkflowStep, expand func(string) string) *xps.Body {
+			// 先展开 agent 变量，再替换步骤输出（步骤输出中的 ${...} 不再展开）
+			return g.execStep(ctx, st, func(s string) string { return expand(vars.Expand(s)) }, env, ra, l)
+		},
+		progress: func(res *stepResult, done, total int) {
+			l.WithFields(logrus.Fields{"step": res.ID, "status": res.Status}).Infoln("runWorkflow: step finished")
+			b, _ := json.Marshal(res.trimmed(workflowLogOutputBytes))
+			_ = g.SendLocalLog(id, pos+int32(done-1), string(b)+"\n", int32(done*100/total))
+		},
+	}
+
+	res, err := r.Run(ctx, wf)
+	if err != nil {
+		l.WithError(err).Warn("runWorkflow: invalid workflow")
+		g.sendResult(id, code, &xps.Body{Code: -1, Stderr: []byte(err.Error())}, xps.Status_FAIL)
+		return
+	}
+
+	body := &xps.Body{}
+	body.Stdout = res.marshal(common.MaxOutputBytes())
+	status := xps.Status_SUCC
+	if res.Status != StepSucceeded {
+		body.Code = 1
+		status = xps.Status_FAIL
+	}
+	l.WithField("status", res.Status).Infoln("runWorkflow: finished")
+	lock.annotate(body, true)
+	g.sendResult(id, code, body, status)
+}
+
+// execStep 执行单个步骤一次；env 为 agent 注入的环境变量
+func (g *GrpcMgr) execStep(ctx context.Context, st *WorkflowStep, expand func(string) string, env []string, ra *runAs, l *logrus.Entry) *xps.Body {
+	fail := func(err error) *xps.Body {
+		return &xps.Body{Code: -1, Stderr: []byte(err.Error())}
+	}
+	expandAll := func(in []string) []string {
+		out := make([]string, len(in))
+		for i, s := range in {
+			out[i] = expand(s)
+		}
+		return out
+	}
+
+	switch st.Type {
+	case StepTypeCmd:
+		cmd, err := g.newTaskCmd(ctx, expand(st.Cmd.Name), expandAll(st.Cmd.Args), expand(st.Cmd.Dir), append(append([]string{}, env...), expandAll(st.Cmd.Envs)...), ra)
+		if err != nil {
+			return fail(err)
+		}
+		return common.SyncExec(cmd)
+
+	case StepTypeScript:
+		spec := *st.Script
+		spec.Body = expand(spec.Body)
+		script, cleanup, err := ra.writeScript(&spec)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() {
+			if err := cleanup(); err != nil {
+				l.WithError(err).WithField("script", script.Path).Warn("execStep: cleanup script failed")
+			}
+		}()
+		l.WithFields(logrus.Fields{"step": st.ID, "script_sha256": script.SHA256}).Infoln("execStep: run script")
+		name, args := ra.scriptCommand(script, nil)
+		cmd, err := g.newTaskCmd(ctx, name, args, "", env, ra.withFiles(script.Path))
+		if err != nil {
+			return fail(err)
+		}
+		return common.SyncExec(cmd)
+
+	case StepTypeFile:
+		// 沙箱/容器中的路径与宿主机不同，不支持
+		if ra != nil && (ra.Sandbox != nil || ra.Container != nil) {
+			return fail(fmt.Errorf("file step is not supported in sandbox or container mode"))
+		}
+		name, args, stdin, err := fileOpCommand(st.File, expand)
+		if err != nil {
+			return fail(err)
+		}
+		// 以任务身份执行，权限检查（含符号链接）由内核按目标用户完成，文件属主自然为目标用户
+		cmd, err := g.newTaskCmd(ctx, name, args, "", env, ra)
+		if err != nil {
+			return fail(err)
+		}
+		cmd.Stdin = strings.NewReader(stdin)
+		return common.SyncExec(cmd)
+
+	case StepTypeWait:
+		d, _ := time.ParseDuration(st.Wait)
+		select {
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		case <-time.After(d):
+			return &xps.Body{}
+		}
+	}
+	return fail(fmt.Errorf("unknown step type %q", st.Type))
+}
+
+// fileOpCommand 文件操作对应的命令，write 的内容经 stdin 传入
+func fileOpCommand(f *StepFile, expand func(string) string) (name string, args []string, stdin string, err error) {
+	path := expand(f.Path)
+
+	mode := ""
+	if f.Mode != "" {
+		m, err := strconv.ParseUint(f.Mode, 8, 32)
+		if err != nil || m > 0o7777 {
+			return "", nil, "", fmt.Errorf("invalid mode %q", f.Mode)
+		}
+		mode = fmt.Sprintf("%04o", m)
+	}
+
+	switch f.Op {
+	case FileOpWrite:
+		if mode == "" {
+			mode = "0644"
+		}
+		// 新文件先以 0600 创建，写完再设置权限；已存在的文件同样修改权限
+		return "/bin/sh", []string{"-c", `umask 077 && cat > "$1" && chmod "$2" "$1"`, "sh", path, mode}, expand(f.Content), nil
+	case FileOpMkdir:
+		if mode == "" {
+			mode = "0755"
+		}
+		return "mkdir", []string{"-p", "-m", mode, "--", path}, "", nil
+	case FileOpDelete:
+		return "rm", []string{"-rf", "--", path}, "", nil
+	}
+	return "", nil, "", fmt.Errorf("unknown file op %q", f.Op)
+}
@@ -0,0 +1,253 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xulei1234/x-agent/module/sandbox"
+	"github.com/xulei1234/x-proto/xps"
+)
+
+// fakeExec 按步骤名返回预设退出码，stdout 为展开后的第一个参数
+func fakeExec(codes map[string][]int32, calls *[]string) func(context.Context, *WorkflowStep, func(string) string) *xps.Body {
+	return func(_ context.Context, st *WorkflowStep, expand func(string) string) *xps.Body {
+		*calls = append(*calls, st.ID)
+		var code int32
+		if seq := codes[st.ID]; len(seq) > 0 {
+			code = seq[0]
+			codes[st.ID] = seq[1:]
+		}
+		out := ""
+		if st.Cmd != nil && len(st.Cmd.Args) > 0 {
+			out = expand(st.Cmd.Args[0])
+		}
+		return &xps.Body{Code: code, Stdout: []byte(out + "\n")}
+	}
+}
+
+func cmdStep(id string, arg string, deps ...string) WorkflowStep {
+	return WorkflowStep{ID: id, Type: StepTypeCmd, DependsOn: deps, Cmd: &StepCmd{Name: "echo", Args: []string{arg}}}
+}
+
+func TestWorkflowOrder(t *testing.T) {
+	wf := &Workflow{Steps: []WorkflowStep{
+		cmdStep("start", "", "migrate"),
+		cmdStep("stop", ""),
+		cmdStep("migrate", "", "stop"),
+	}}
+	order, err := workflowOrder(wf)
+	if err != nil {
+		t.Fatalf("order: %v", err)
+	}
+	var ids []string
+	for _, st := range order {
+		ids = append(ids, st.ID)
+	}
+	if len(ids) != 3 || ids[0] != "stop" || ids[1] != "migrate" || ids[2] != "start" {
+		t.Fatalf("unexpected order: %v", ids)
+	}
+
+	for _, bad := range []*Workflow{
+		{},
+		{Steps: []WorkflowStep{cmdStep("a", "", "b"), cmdStep("b", "", "a")}},
+		{Steps: []WorkflowStep{cmdStep("a", ""), cmdStep("a", "")}},
+		{Steps: []WorkflowStep{cmdStep("a", "", "missing")}},
+		{Steps: []WorkflowStep{{ID: "w", Type: StepTypeWait, Wait: "soon"}}},
+	} {
+		if _, err := workflowOrder(bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestWorkflowRunner_OutputPassingAndRetry(t *testing.T) {
+	var calls []string
+	r := &workflowRunner{exec: fakeExec(map[string][]int32{"fetch": {1, 0}}, &calls)}
+
+	fetch := cmdStep("fetch", "v42")
+	fetch.Retry = 1
+	fetch.RetryDelay = "1ms"
+	res, err := r.Run(context.Background(), &Workflow{Steps: []WorkflowStep{
+		fetch,
+		cmdStep("deploy", "version=${steps.fetch.stdout} code=${steps.fetch.code}", "fetch"),
+	}})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Status != StepSucceeded || res.Steps[0].Attempts != 2 {
+		t.Fatalf("unexpected result: %+v", res.Steps[0])
+	}
+	if res.Steps[1].Stdout != "version=v42 code=0\n" {
+		t.Fatalf("output not passed, got=%q", res.Steps[1].Stdout)
+	}
+}
+
+func TestWorkflowResult_MarshalCapped(t *testing.T) {
+	big := strings.Repeat("x", 10000) + "END"
+	res := &workflowResult{Status: StepFailed}
+	for _, id := range []string{"a", "b", "c"} {
+		res.Steps = append(res.Steps, &stepResult{ID: id, Status: StepFailed, Stdout: "HEAD" + big, Stderr: big,
+			Rollback: []*stepResult{{ID: id + "-undo", Stdout: big}}})
+	}
+
+	b := res.marshal(4096)
+	if len(b) > 4096 {
+		t.Fatalf("result size %d exceeds cap", len(b))
+	}
+	var got workflowResult
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	out := got.Steps[2].Stdout
+	if len(got.Steps) != 3 || !strings.HasPrefix(out, "HEAD") || !strings.HasSuffix(out, "END") || !strings.Contains(out, "[truncated") {
+		t.Fatalf("steps=%d stdout=%q", len(got.Steps), out)
+	}
+	// 截断只作用于上报副本
+	if res.Steps[0].Stdout != "HEAD"+big {
+		t.Fatalf("original result modified")
+	}
+
+	// 进度行
+	line := res.Steps[0].trimmed(workflowLogOutputBytes)
+	if len(line.Stdout) > workflowLogOutputBytes || len(line.Rollback[0].Stdout) > workflowLogOutputBytes {
+		t.Fatalf("progress output not trimmed")
+	}
+}
+
+func TestWorkflowRunner_FailureRollbackAndConditions(t *testing.T) {
+	var calls []string
+	r := &workflowRunner{exec: fakeExec(map[string][]int32{"migrate": {3}}, &calls)}
+
+	migrate := cmdStep("migrate", "", "stop")
+	migrate.OnFailure = []WorkflowStep{cmdStep("restore", "")}
+	notify := cmdStep("notify", "")
+	notify.When = WhenFailure
+	cleanup := cmdStep("cleanup", "")
+	cleanup.When = WhenAlways
+
+	var progress []int
+	r.progress = func(_ *stepResult, done, total int) { progress = append(progress, done*100/total) }
+
+	res, err := r.Run(context.Background(), &Workflow{Steps: []WorkflowStep{
+		cmdStep("stop", ""),
+		migrate,
+		cmdStep("start", "", "migrate"),
+		notify,
+		cleanup,
+	}})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Status != StepFailed {
+		t.Fatalf("expected failed workflow, got=%s", res.Status)
+	}
+	want := []string{"stop", "migrate", "restore", "notify", "cleanup"}
+	if len(calls) != len(want) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+	}
+	if res.Steps[1].Status != StepFailed || len(res.Steps[1].Rollback) != 1 || res.Steps[2].Status != StepSkipped {
+		t.Fatalf("unexpected steps: %+v %+v", res.Steps[1], res.Steps[2])
+	}
+	if len(progress) != 5 || progress[4] != 100 {
+		t.Fatalf("unexpected progress: %v", progress)
+	}
+}
+
+func TestExecStep_File(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "conf")
+	id := func(s string) string { return s }
+	l := logrus.NewEntry(logrus.StandardLogger())
+	step := func(f StepFile, ra *runAs) *xps.Body {
+		return gMgr.execStep(context.Background(), &WorkflowStep{ID: "f", Type: StepTypeFile, File: &f}, id, nil, ra, l)
+	}
+
+	if b := step(StepFile{Op: FileOpMkdir, Path: dir}, nil); b.Code != 0 {
+		t.Fatalf("mkdir: %+v", b)
+	}
+	p := filepath.Join(dir, "app.conf")
+	if b := step(StepFile{Op: FileOpWrite, Path: p, Content: "k=v", Mode: "0600"}, nil); b.Code != 0 {
+		t.Fatalf("write: %s", b.Stderr)
+	}
+	fi, err := os.Stat(p)
+	if err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected file: %v %v", fi, err)
+	}
+	if b, _ := os.ReadFile(p); string(b) != "k=v" {
+		t.Fatalf("content=%q", b)
+	}
+	if b := step(StepFile{Op: FileOpDelete, Path: dir}, nil); b.Code != 0 {
+		t.Fatalf("delete: %s", b.Stderr)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected removed, err=%v", err)
+	}
+	if b := step(StepFile{Op: "chmod", Path: dir}, nil); b.Code == 0 {
+		t.Fatalf("expected unknown op error")
+	}
+	if b := step(StepFile{Op: FileOpMkdir, Path: dir}, &runAs{Sandbox: &sandbox.Spec{}}); b.Code == 0 {
+		t.Fatalf("expected sandbox mode to be rejected")
+	}
+}
+
+// 以目标用户执行：不能经符号链接改写该用户无权写入的文件
+func TestExecStep_FileRunAs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	// t.TempDir 的上级目录为 0700，目标用户无法进入
+	root, err := os.MkdirTemp("", "x-agent-workflow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Chmod(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "work")
+	if err := os.Mkdir(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "passwd")
+	if err := os.WriteFile(target, []byte("root"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	ra := &runAs{Cred: &syscall.Credential{Uid: 65534, Gid: 65534}, Umask: -1}
+	l := logrus.NewEntry(logrus.StandardLogger())
+	step := func(f StepFile) *xps.Body {
+		return gMgr.execStep(context.Background(), &WorkflowStep{ID: "f", Type: StepTypeFile, File: &f}, func(s string) string { return s }, nil, ra, l)
+	}
+	if b := step(StepFile{Op: FileOpWrite, Path: link, Content: "pwned"}); b.Code == 0 {
+		t.Fatalf("expected write through symlink to fail")
+	}
+	if b, _ := os.ReadFile(target); string(b) != "root" {
+		t.Fatalf("target modified: %q", b)
+	}
+
+	p := filepath.Join(dir, "own")
+	if b := step(StepFile{Op: FileOpWrite, Path: p, Content: "x"}); b.Code != 0 {
+		t.Fatalf("write: %s", b.Stderr)
+	}
+	fi, err := os.Stat(p)
+	if err != nil || fi.Sys().(*syscall.Stat_t).Uid != 65534 || fi.Mode().Perm() != 0o644 {
+		t.Fatalf("unexpected file: %+v %v", fi, err)
+	}
+}